@@ -6,28 +6,39 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/ilya-burinskiy/gophermart/internal/accrual"
+	"github.com/ilya-burinskiy/gophermart/internal/auth"
 	"github.com/ilya-burinskiy/gophermart/internal/configs"
 	"github.com/ilya-burinskiy/gophermart/internal/handlers"
 	"github.com/ilya-burinskiy/gophermart/internal/middlewares"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/notify"
 	"github.com/ilya-burinskiy/gophermart/internal/services"
+	"github.com/ilya-burinskiy/gophermart/internal/settlement"
 	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
 	"go.uber.org/zap"
 )
 
 func main() {
-	config := configs.Parse()
+	config, err := configs.Parse()
+	if err != nil {
+		panic(err)
+	}
 	db, err := storage.NewDBStorage(config.DSN)
 	if err != nil {
 		panic(err)
 	}
 	logger := configureLogger("info")
+	keys := configureKeys(config, logger)
 
 	router := chi.NewRouter()
 	router.Use(
+		middlewares.RealIP(config.TrustedProxies),
 		middlewares.LogResponse(logger),
 		middlewares.LogRequest(logger),
 		middlewares.GzipCompress,
@@ -38,10 +49,11 @@ func main() {
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	exitCh := make(chan struct{})
 
-	configureUserRouter(db, router)
-	configureOrderRouter(db, logger, config, exitCh, router)
-	configureBalanceRouter(db, router)
-	configureWithdrawalsRouter(db, router)
+	configureUserRouter(db, keys, logger, config, exitCh, router)
+	configureOrderRouter(db, keys, logger, config, exitCh, router)
+	configureBalanceRouter(db, keys, logger, config, exitCh, router)
+	configureWithdrawalsRouter(db, keys, logger, config, exitCh, router)
+	configureAdminRouter(db, keys, config, router)
 
 	server := http.Server{
 		Handler: router,
@@ -49,7 +61,7 @@ func main() {
 	}
 	go func() {
 		<-sigCh
-		exitCh <- struct{}{}
+		close(exitCh)
 		db.Close()
 		server.Shutdown(context.TODO())
 	}()
@@ -71,20 +83,129 @@ func configureLogger(level string) *zap.Logger {
 	return logger
 }
 
-func configureUserRouter(store storage.Storage, mainRouter chi.Router) {
+func configureKeys(config configs.Config, logger *zap.Logger) auth.KeySet {
+	if len(config.JWTKeys) == 0 && config.JWTKeysFile == "" {
+		logger.Warn("no JWT signing keys configured, issued tokens will not survive restart")
+		keys, err := auth.NewEphemeralKeySet()
+		if err != nil {
+			panic(err)
+		}
+		return keys
+	}
+
+	keys, err := auth.LoadKeySet(config.JWTKeys, config.JWTKeysFile)
+	if err != nil {
+		panic(err)
+	}
+
+	return keys
+}
+
+func configureExpiryPolicy(config configs.Config) services.ExpiryPolicy {
+	return services.ExpiryPolicy{
+		LifetimeMonths: config.PointsLifetimeMonths,
+		NoticePeriod:   configs.PointsExpiryNotice,
+	}
+}
+
+func configureLoginGuard() services.LoginGuardConfig {
+	return services.LoginGuardConfig{
+		PerLogin: services.LockoutPolicy{
+			FreeAttempts: 5,
+			BaseDelay:    time.Second,
+			MaxDelay:     15 * time.Minute,
+			Window:       time.Hour,
+		},
+		PerIP: services.LockoutPolicy{
+			FreeAttempts: 50,
+			BaseDelay:    time.Second,
+			MaxDelay:     15 * time.Minute,
+			Window:       time.Hour,
+		},
+	}
+}
+
+// configureStepUp throttles invalid step-up codes like failed logins, so the
+// login attempts cleaner keeps them for long enough
+func configureStepUp(config configs.Config) services.StepUpConfig {
+	return services.StepUpConfig{
+		Threshold: config.WithdrawalOTPThreshold,
+		Lockout:   configureLoginGuard().PerLogin,
+	}
+}
+
+func configureNotifier(config configs.Config, logger *zap.Logger) notify.Notifier {
+	switch config.Notifier {
+	case configs.FileNotifier:
+		return notify.NewFileNotifier(config.NotificationsFile)
+	case configs.LogNotifier:
+		return notify.NewLogNotifier(logger)
+	default:
+		return nil
+	}
+}
+
+func configureUserRouter(
+	store storage.Storage,
+	keys auth.KeySet,
+	logger *zap.Logger,
+	config configs.Config,
+	exitCh <-chan struct{},
+	mainRouter chi.Router) {
+
 	handlers := handlers.NewUserHandlers(store)
-	registerSrv := services.NewRegisterUserService(store)
-	authenticateSrv := services.NewAuthenticateUserService(store)
+	policy, err := validation.NewCredentialsPolicy(config.MinPasswordLength, config.PasswordBlocklistFile)
+	if err != nil {
+		panic(err)
+	}
+	registerSrv := services.NewRegisterUserService(store, keys, policy)
+	guard := configureLoginGuard()
+	authenticateSrv := services.NewAuthenticateUserService(store, keys, guard)
+	attemptsCleaner := services.NewLoginAttemptsCleaner(store, logger, guard, 10*time.Minute, exitCh)
+	go attemptsCleaner.Run()
+	changePasswordSrv := services.NewPasswordChanger(store, keys, policy)
+	resetSrv := services.NewPasswordResetter(store, policy)
+	enrollTOTPSrv := services.NewTOTPEnroller(store)
+	confirmTOTPSrv := services.NewTOTPConfirmer(store)
+	createAPIKeySrv := services.NewAPIKeyCreator(store)
+	fetchAPIKeysSrv := services.NewUserAPIKeysFetcher(store)
+	revokeAPIKeySrv := services.NewAPIKeyRevoker(store)
+	refreshSrv := services.NewTokenRefresher(store, keys)
+	logoutSrv := services.NewSessionTerminator(store)
 
 	mainRouter.Group(func(router chi.Router) {
 		router.Use(middleware.AllowContentType("application/json"))
 		router.Post("/api/user/register", handlers.Register(registerSrv))
 		router.Post("/api/user/login", handlers.Authenticate(authenticateSrv))
+		router.Post("/api/user/token/refresh", handlers.Refresh(refreshSrv))
+		router.Post("/api/user/logout", handlers.Logout(logoutSrv))
+		notifier := configureNotifier(config, logger)
+		if notifier == nil {
+			logger.Warn("password reset is disabled, no notifier is configured")
+			return
+		}
+		requestResetSrv := services.NewPasswordResetRequester(store, notifier, logger)
+		router.Post("/api/user/password/reset", handlers.RequestPasswordReset(requestResetSrv))
+		router.Post("/api/user/password/reset/confirm", handlers.ResetPassword(resetSrv))
+	})
+	// account management is available to sessions only, not to API keys
+	mainRouter.Group(func(router chi.Router) {
+		router.Use(
+			middlewares.Authenticate(keys, nil),
+			middleware.AllowContentType("application/json"),
+		)
+		router.Put("/api/user/password", handlers.ChangePassword(changePasswordSrv))
+		router.Post("/api/user/2fa/totp", handlers.EnrollTOTP(enrollTOTPSrv))
+		router.Post("/api/user/2fa/totp/confirm", handlers.ConfirmTOTP(confirmTOTPSrv))
+		router.Post("/api/user/api-keys", handlers.CreateAPIKey(createAPIKeySrv))
+		router.Get("/api/user/api-keys", handlers.GetAPIKeys(fetchAPIKeysSrv))
+		router.Delete("/api/user/api-keys/{id}", handlers.RevokeAPIKey(revokeAPIKeySrv))
 	})
 }
 
 func configureOrderRouter(
 	store storage.Storage,
+	keys auth.KeySet,
 	logger *zap.Logger,
 	config configs.Config,
 	exitCh <-chan struct{},
@@ -92,47 +213,165 @@ func configureOrderRouter(
 
 	handlers := handlers.NewOrderHandlers(store)
 	accrualApiClient := accrual.NewClient(config.AccrualBaseURL)
-	accrualSrv := services.NewAccrualWorker(accrualApiClient, store, logger, 16, exitCh)
+	accrualSrv := services.NewAccrualWorker(
+		accrualApiClient,
+		store,
+		logger,
+		services.AccrualWorkerConfig{
+			InstanceID:    config.InstanceID,
+			WorkersNum:    16,
+			PollInterval:  5 * time.Second,
+			LeaseDuration: time.Minute,
+			RetryPolicy: services.RetryPolicy{
+				MaxAttempts: 10,
+				BaseDelay:   5 * time.Second,
+				MaxDelay:    time.Hour,
+			},
+		},
+		exitCh,
+	)
 	go accrualSrv.Run()
 	createSrv := services.NewOrderCreateService(store)
 	fetchSrv := services.NewUserOrdersFetcher(store)
+	apiKeys := services.NewAPIKeyVerifier(store)
 	mainRouter.Group(func(router chi.Router) {
 		router.Use(
-			middlewares.Authenticate,
+			middlewares.Authenticate(keys, apiKeys),
+			middlewares.RequireScope(models.ScopeOrdersWrite),
 			middleware.AllowContentType("text/plain"),
+			middlewares.Idempotent(store, configs.IdempotencyKeyExp, logger),
 		)
 		router.Post("/api/user/orders", handlers.Create(createSrv))
 	})
 	mainRouter.Group(func(router chi.Router) {
 		router.Use(
-			middlewares.Authenticate,
+			middlewares.Authenticate(keys, apiKeys),
+			middlewares.RequireScope(models.ScopeOrdersRead),
 			middleware.AllowContentType("application/json"),
 		)
 		router.Get("/api/user/orders", handlers.Get(fetchSrv))
 	})
 }
 
-func configureBalanceRouter(store storage.Storage, mainRouter chi.Router) {
+func configureBalanceRouter(
+	store storage.Storage,
+	keys auth.KeySet,
+	logger *zap.Logger,
+	config configs.Config,
+	exitCh <-chan struct{},
+	mainRouter chi.Router) {
+
 	handlers := handlers.NewBalanceHandlers(store)
+	expiryPolicy := configureExpiryPolicy(config)
+	if expiryPolicy.Enabled() {
+		expirer := services.NewPointsExpirer(
+			store,
+			logger,
+			services.PointsExpirerConfig{
+				Policy:       expiryPolicy,
+				BatchSize:    100,
+				PollInterval: time.Minute,
+			},
+			exitCh,
+		)
+		go expirer.Run()
+	}
+	fetchSrv := services.NewUserBalanceFetcher(store, expiryPolicy)
+	historySrv := services.NewUserBalanceHistoryFetcher(store)
+	transferSrv := services.NewPointsTransferrer(store, config.TransferDailyCap, configureStepUp(config))
+	mainRouter.Group(func(router chi.Router) {
+		router.Use(
+			middlewares.Authenticate(keys, services.NewAPIKeyVerifier(store)),
+			middlewares.RequireScope(models.ScopeBalanceRead),
+			middleware.AllowContentType("application/json"),
+		)
+		router.Get("/api/user/balance", handlers.Get(fetchSrv))
+		router.Get("/api/user/balance/history", handlers.History(historySrv))
+	})
 	mainRouter.Group(func(router chi.Router) {
 		router.Use(
-			middlewares.Authenticate,
+			middlewares.Authenticate(keys, services.NewAPIKeyVerifier(store)),
+			middlewares.RequireScope(models.ScopeTransfersWrite),
 			middleware.AllowContentType("application/json"),
+			middlewares.Idempotent(store, configs.IdempotencyKeyExp, logger),
 		)
-		router.Get("/api/user/balance", handlers.Get)
+		router.Post("/api/user/balance/transfer", handlers.Transfer(transferSrv))
 	})
 }
 
-func configureWithdrawalsRouter(store storage.Storage, mainRouter chi.Router) {
+func configureWithdrawalsRouter(
+	store storage.Storage,
+	keys auth.KeySet,
+	logger *zap.Logger,
+	config configs.Config,
+	exitCh <-chan struct{},
+	mainRouter chi.Router) {
+
 	handlers := handlers.NewWithdrawalHanlers(store)
+	var settlementApiClient settlement.ApiClient
+	if config.SettlementBaseURL != "" {
+		settlementApiClient = settlement.NewClient(config.SettlementBaseURL)
+	} else {
+		logger.Warn("no settlement system configured, withdrawals will be confirmed at once")
+		settlementApiClient = settlement.NewAutoConfirmClient()
+	}
+	settlementSrv := services.NewSettlementWorker(
+		settlementApiClient,
+		store,
+		logger,
+		services.SettlementWorkerConfig{
+			InstanceID:    config.InstanceID,
+			WorkersNum:    4,
+			PollInterval:  5 * time.Second,
+			LeaseDuration: time.Minute,
+			RetryPolicy: services.RetryPolicy{
+				MaxAttempts: 10,
+				BaseDelay:   5 * time.Second,
+				MaxDelay:    time.Hour,
+			},
+		},
+		exitCh,
+	)
+	go settlementSrv.Run()
 	fetchSrv := services.NewUserWithdrawalsFetcher(store)
-	createSrv := services.NewWithdrawalCreator(store)
+	createSrv := services.NewWithdrawalCreator(store, configureStepUp(config))
 	mainRouter.Group(func(router chi.Router) {
 		router.Use(
-			middlewares.Authenticate,
+			middlewares.Authenticate(keys, services.NewAPIKeyVerifier(store)),
+			middleware.AllowContentType("application/json"),
+		)
+		router.With(middlewares.RequireScope(models.ScopeWithdrawalsRead)).
+			Get("/api/user/withdrawals", handlers.Get(fetchSrv))
+		router.With(
+			middlewares.RequireScope(models.ScopeWithdrawalsWrite),
+			middlewares.Idempotent(store, configs.IdempotencyKeyExp, logger),
+		).Post("/api/user/balance/withdraw", handlers.Create(createSrv))
+	})
+}
+
+func configureAdminRouter(store storage.Storage, keys auth.KeySet, config configs.Config, mainRouter chi.Router) {
+	handlers := handlers.NewAdminHandlers(store)
+	searchSrv := services.NewUsersSearcher(store)
+	ordersSrv := services.NewUserOrdersFetcher(store)
+	withdrawalsSrv := services.NewUserWithdrawalsFetcher(store)
+	balanceSrv := services.NewUserBalanceFetcher(store, configureExpiryPolicy(config))
+	resetSrv := services.NewOrderResetter(store)
+	adjustSrv := services.NewBalanceAdjuster(store)
+	adjustmentsSrv := services.NewUserBalanceAdjustmentsFetcher(store)
+	reverseSrv := services.NewWithdrawalReverser(store)
+	mainRouter.Route("/api/admin", func(router chi.Router) {
+		router.Use(
+			middlewares.Authenticate(keys, nil),
+			middlewares.RequireRole(store, models.AdminRole),
 			middleware.AllowContentType("application/json"),
 		)
-		router.Get("/api/user/withdrawals", handlers.Get(fetchSrv))
-		router.Post("/api/user/balance/withdraw", handlers.Create(createSrv))
+		router.Get("/users", handlers.SearchUsers(searchSrv))
+		router.Get("/users/{id}/orders", handlers.UserOrders(ordersSrv))
+		router.Get("/users/{id}/withdrawals", handlers.UserWithdrawals(withdrawalsSrv))
+		router.Get("/users/{id}/balance", handlers.UserBalance(balanceSrv))
+		router.Post("/users/{id}/balance/adjustments", handlers.AdjustBalance(adjustSrv))
+		router.Get("/users/{id}/balance/adjustments", handlers.UserBalanceAdjustments(adjustmentsSrv))
+		router.Post("/orders/{number}/reset", handlers.ResetOrder(resetSrv))
+		router.Post("/withdrawals/{number}/reverse", handlers.ReverseWithdrawal(reverseSrv))
 	})
 }
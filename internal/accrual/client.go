@@ -5,10 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/ilya-burinskiy/gophermart/internal/models"
 )
 
+const defaultRetryAfter = 60 * time.Second
+
 type ApiClient interface {
 	GetOrderInfo(ctx context.Context, orderNumber string) (OrderInfo, error)
 }
@@ -21,7 +25,15 @@ type apiClient struct {
 type OrderInfo struct {
 	Number  string             `json:"number"`
 	Status  models.OrderStatus `json:"status"`
-	Accrual int                `json:"accrual"`
+	Accrual models.Money       `json:"accrual"`
+}
+
+type ErrTooManyRequests struct {
+	RetryAfter time.Duration
+}
+
+func (err ErrTooManyRequests) Error() string {
+	return fmt.Sprintf("accrual service rate limit exceeded, retry after %s", err.RetryAfter)
 }
 
 func (info *OrderInfo) UnmarshalJSON(data []byte) error {
@@ -91,9 +103,31 @@ func (client apiClient) getOrderInfo(req *http.Request) (OrderInfo, error) {
 	case http.StatusNoContent:
 		return OrderInfo{}, fmt.Errorf("order with number not found")
 	case http.StatusTooManyRequests:
+		return OrderInfo{}, ErrTooManyRequests{RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"))}
 	case http.StatusInternalServerError:
 		return OrderInfo{}, fmt.Errorf("service is unavailable")
 	}
 
-	return orderInfo, nil
+	return OrderInfo{}, fmt.Errorf("unexpected response status %d", res.StatusCode)
+}
+
+// Retry-After is either a number of seconds or an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return defaultRetryAfter
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return defaultRetryAfter
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+		return 0
+	}
+
+	return defaultRetryAfter
 }
@@ -0,0 +1,90 @@
+package accrual_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ilya-burinskiy/gophermart/internal/accrual"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetOrderInfo(t *testing.T) {
+	testCases := []struct {
+		name           string
+		status         int
+		header         map[string]string
+		body           string
+		wantOrderInfo  accrual.OrderInfo
+		wantRetryAfter time.Duration
+		wantErr        bool
+	}{
+		{
+			name:          "returns order info",
+			status:        http.StatusOK,
+			body:          `{"status":"PROCESSED","accrual":729.98}`,
+			wantOrderInfo: accrual.OrderInfo{Status: models.ProcessedOrder, Accrual: 72998},
+		},
+		{
+			name:           "returns rate limit error with retry after seconds",
+			status:         http.StatusTooManyRequests,
+			header:         map[string]string{"Retry-After": "15"},
+			body:           "No more than N requests per minute allowed",
+			wantRetryAfter: 15 * time.Second,
+			wantErr:        true,
+		},
+		{
+			name:           "returns rate limit error with default retry after",
+			status:         http.StatusTooManyRequests,
+			body:           "No more than N requests per minute allowed",
+			wantRetryAfter: time.Minute,
+			wantErr:        true,
+		},
+		{
+			name:    "returns error if order is not registered",
+			status:  http.StatusNoContent,
+			wantErr: true,
+		},
+		{
+			name:    "returns error on unexpected status",
+			status:  http.StatusBadGateway,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/api/orders/12345", r.URL.Path)
+				for key, value := range tc.header {
+					w.Header().Set(key, value)
+				}
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			client := accrual.NewClient(server.URL)
+			orderInfo, err := client.GetOrderInfo(context.Background(), "12345")
+			if !tc.wantErr {
+				require.NoError(t, err)
+				assert.Equal(t, tc.wantOrderInfo, orderInfo)
+				return
+			}
+
+			require.Error(t, err)
+			var rateLimitErr accrual.ErrTooManyRequests
+			if tc.wantRetryAfter != 0 {
+				require.True(t, errors.As(err, &rateLimitErr))
+				assert.Equal(t, tc.wantRetryAfter, rateLimitErr.RetryAfter)
+			} else {
+				assert.False(t, errors.As(err, &rateLimitErr))
+			}
+		})
+	}
+}
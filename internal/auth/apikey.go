@@ -0,0 +1,20 @@
+package auth
+
+import "strings"
+
+// APIKeyPrefix tells personal API keys apart from JWT access tokens sent
+// in the same Authorization header
+const APIKeyPrefix = "gm_"
+
+func GenerateAPIKey() (string, error) {
+	token, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	return APIKeyPrefix + token, nil
+}
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
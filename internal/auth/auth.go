@@ -4,45 +4,70 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/ilya-burinskiy/gophermart/internal/configs"
 	"github.com/ilya-burinskiy/gophermart/internal/models"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 var ErrInvalidCreds = errors.New("invalid login or password")
 
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hash, err := DefaultPasswordHasher.Hash(password)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate hash from password: %w", err)
 	}
 
-	return string(bytes), nil
+	return hash, nil
 }
 
 func ValidatePasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	ok, err := verifyPassword(password, hash)
+	return err == nil && ok
+}
+
+func PasswordNeedsRehash(hash string) bool {
+	return DefaultPasswordHasher.NeedsRehash(hash)
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// SimulatePasswordCheck spends the same time as ValidatePasswordHash so that
+// unknown logins cannot be told apart from wrong passwords by response time
+func SimulatePasswordCheck(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = DefaultPasswordHasher.Hash("dummy password")
+	})
+	ValidatePasswordHash(password, dummyHash)
 }
 
-func BuildJWTString(user models.User) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+func (ks KeySet) BuildJWTString(user models.User) (string, error) {
+	tokenString, err := ks.sign(Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(configs.AuthTokenExp)),
 		},
 		UserID: user.ID,
 	})
-	tokenString, err := token.SignedString([]byte(configs.SecretKey))
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
 	return tokenString, nil
 }
 
+func (ks KeySet) ParseJWTString(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	if err := ks.parse(tokenString, claims); err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	return claims, nil
+}
+
 func SetJWTCookie(w http.ResponseWriter, token string) {
 	http.SetCookie(
 		w,
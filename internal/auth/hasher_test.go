@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	argon2Hash, err := DefaultPasswordHasher.Hash("password")
+	require.NoError(t, err)
+	bcryptHasher := PasswordHasher{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost}
+	bcryptHash, err := bcryptHasher.Hash("password")
+	require.NoError(t, err)
+	strongerHasher := DefaultPasswordHasher
+	strongerHasher.Argon2id.Iterations++
+
+	testCases := []struct {
+		name         string
+		hash         string
+		password     string
+		wantValid    bool
+		wantRehash   bool
+		rehashHasher PasswordHasher
+	}{
+		{name: "verifies argon2id hash", hash: argon2Hash, password: "password", wantValid: true, rehashHasher: DefaultPasswordHasher},
+		{name: "rejects wrong password for argon2id hash", hash: argon2Hash, password: "wrong", rehashHasher: DefaultPasswordHasher},
+		{name: "verifies legacy bcrypt hash", hash: bcryptHash, password: "password", wantValid: true, wantRehash: true, rehashHasher: DefaultPasswordHasher},
+		{name: "rejects wrong password for bcrypt hash", hash: bcryptHash, password: "wrong", wantRehash: true, rehashHasher: DefaultPasswordHasher},
+		{name: "detects outdated argon2id parameters", hash: argon2Hash, password: "password", wantValid: true, wantRehash: true, rehashHasher: strongerHasher},
+		{name: "detects outdated bcrypt cost", hash: bcryptHash, password: "password", wantValid: true, wantRehash: true, rehashHasher: PasswordHasher{Algorithm: Bcrypt, BcryptCost: bcrypt.DefaultCost}},
+		{name: "rejects unknown format", hash: "plain", password: "plain", wantRehash: true, rehashHasher: DefaultPasswordHasher},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantValid, ValidatePasswordHash(tc.password, tc.hash))
+			assert.Equal(t, tc.wantRehash, tc.rehashHasher.NeedsRehash(tc.hash))
+		})
+	}
+}
+
+func TestPasswordHasherLongPasswords(t *testing.T) {
+	password := strings.Repeat("a", 100)
+
+	hash, err := DefaultPasswordHasher.Hash(password)
+	require.NoError(t, err)
+	assert.True(t, ValidatePasswordHash(password, hash))
+	assert.False(t, ValidatePasswordHash(password[:72], hash))
+
+	_, err = PasswordHasher{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost}.Hash(password)
+	assert.Error(t, err)
+}
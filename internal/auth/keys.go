@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   interface{}
+	VerifyKey interface{}
+}
+
+// KeySet signs tokens with the current key and verifies tokens signed by any
+// of its keys, so a new key can be rolled out before the old one is retired
+type KeySet struct {
+	current SigningKey
+	keys    map[string]SigningKey
+}
+
+func NewKeySet(current SigningKey, others ...SigningKey) (KeySet, error) {
+	if current.SignKey == nil {
+		return KeySet{}, fmt.Errorf("key \"%s\" cannot sign tokens", current.ID)
+	}
+
+	keys := map[string]SigningKey{current.ID: current}
+	for _, key := range others {
+		if _, ok := keys[key.ID]; ok {
+			return KeySet{}, fmt.Errorf("duplicated key id \"%s\"", key.ID)
+		}
+		keys[key.ID] = key
+	}
+
+	return KeySet{current: current, keys: keys}, nil
+}
+
+func NewHMACKey(id string, secret []byte) SigningKey {
+	return SigningKey{
+		ID:        id,
+		Method:    jwt.SigningMethodHS256,
+		SignKey:   secret,
+		VerifyKey: secret,
+	}
+}
+
+func NewEphemeralKeySet() (KeySet, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return KeySet{}, fmt.Errorf("failed to generate secret: %w", err)
+	}
+
+	return NewKeySet(NewHMACKey("ephemeral", secret))
+}
+
+// LoadKeySet builds a key set from specs of the form "<kid>:<alg>:<value>",
+// where value is the secret for HS256 and a path to a PEM file for RS256 and
+// EdDSA. Specs are also read line by line from file when it is not empty.
+// The first spec is the signing key, the rest are only used for verification.
+func LoadKeySet(specs []string, file string) (KeySet, error) {
+	if file != "" {
+		fileSpecs, err := readKeySpecs(file)
+		if err != nil {
+			return KeySet{}, err
+		}
+		specs = append(specs, fileSpecs...)
+	}
+	if len(specs) == 0 {
+		return KeySet{}, errors.New("no signing keys configured")
+	}
+
+	keys := make([]SigningKey, 0, len(specs))
+	for _, spec := range specs {
+		key, err := parseKeySpec(spec)
+		if err != nil {
+			return KeySet{}, err
+		}
+		keys = append(keys, key)
+	}
+
+	return NewKeySet(keys[0], keys[1:]...)
+}
+
+func (ks KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.current.Method, claims)
+	token.Header["kid"] = ks.current.ID
+
+	return token.SignedString(ks.current.SignKey)
+}
+
+func (ks KeySet) parse(tokenString string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+
+		return key.VerifyKey, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return errors.New("invalid token")
+	}
+
+	return nil
+}
+
+func readKeySpecs(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open keys file: %w", err)
+	}
+	defer f.Close()
+
+	var specs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		specs = append(specs, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read keys file: %w", err)
+	}
+
+	return specs, nil
+}
+
+func parseKeySpec(spec string) (SigningKey, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return SigningKey{}, fmt.Errorf("invalid key spec, expected \"<kid>:<alg>:<value>\"")
+	}
+	id, alg, value := parts[0], parts[1], parts[2]
+
+	switch alg {
+	case jwt.SigningMethodHS256.Alg():
+		return NewHMACKey(id, []byte(value)), nil
+	case jwt.SigningMethodRS256.Alg():
+		pemBytes, err := os.ReadFile(value)
+		if err != nil {
+			return SigningKey{}, fmt.Errorf("failed to read key \"%s\": %w", id, err)
+		}
+		key := SigningKey{ID: id, Method: jwt.SigningMethodRS256}
+		if privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes); err == nil {
+			key.SignKey = privateKey
+			key.VerifyKey = &privateKey.PublicKey
+			return key, nil
+		}
+		publicKey, err := jwt.ParseRSAPublicKeyFromPEM(pemBytes)
+		if err != nil {
+			return SigningKey{}, fmt.Errorf("failed to parse key \"%s\": %w", id, err)
+		}
+		key.VerifyKey = publicKey
+		return key, nil
+	case jwt.SigningMethodEdDSA.Alg():
+		pemBytes, err := os.ReadFile(value)
+		if err != nil {
+			return SigningKey{}, fmt.Errorf("failed to read key \"%s\": %w", id, err)
+		}
+		key := SigningKey{ID: id, Method: jwt.SigningMethodEdDSA}
+		if privateKey, err := jwt.ParseEdPrivateKeyFromPEM(pemBytes); err == nil {
+			key.SignKey = privateKey
+			key.VerifyKey = privateKey.(ed25519.PrivateKey).Public()
+			return key, nil
+		}
+		publicKey, err := jwt.ParseEdPublicKeyFromPEM(pemBytes)
+		if err != nil {
+			return SigningKey{}, fmt.Errorf("failed to parse key \"%s\": %w", id, err)
+		}
+		key.VerifyKey = publicKey
+		return key, nil
+	}
+
+	return SigningKey{}, fmt.Errorf("unsupported signing method \"%s\" for key \"%s\"", alg, id)
+}
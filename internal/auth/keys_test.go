@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeySetRotation(t *testing.T) {
+	oldKey := NewHMACKey("old", []byte("old-secret"))
+	newKey := NewHMACKey("new", []byte("new-secret"))
+	user := models.User{ID: 42}
+
+	oldKeys, err := NewKeySet(oldKey)
+	require.NoError(t, err)
+	oldToken, err := oldKeys.BuildJWTString(user)
+	require.NoError(t, err)
+
+	rotatedKeys, err := NewKeySet(newKey, oldKey)
+	require.NoError(t, err)
+	claims, err := rotatedKeys.ParseJWTString(oldToken)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, claims.UserID)
+
+	newToken, err := rotatedKeys.BuildJWTString(user)
+	require.NoError(t, err)
+	_, err = oldKeys.ParseJWTString(newToken)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	retiredKeys, err := NewKeySet(newKey)
+	require.NoError(t, err)
+	_, err = retiredKeys.ParseJWTString(oldToken)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestKeySetRejectsMismatchedAlgorithm(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edKey := SigningKey{ID: "main", Method: jwt.SigningMethodEdDSA, SignKey: privateKey, VerifyKey: publicKey}
+	edKeys, err := NewKeySet(edKey)
+	require.NoError(t, err)
+
+	token, err := edKeys.BuildJWTString(models.User{ID: 1})
+	require.NoError(t, err)
+	_, err = edKeys.ParseJWTString(token)
+	require.NoError(t, err)
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: 1})
+	forged.Header["kid"] = "main"
+	forgedToken, err := forged.SignedString([]byte(publicKey))
+	require.NoError(t, err)
+	_, err = edKeys.ParseJWTString(forgedToken)
+	assert.Error(t, err)
+}
+
+func TestLoadKeySet(t *testing.T) {
+	keys, err := LoadKeySet([]string{"v2:HS256:second", "v1:HS256:first"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", keys.current.ID)
+	assert.Len(t, keys.keys, 2)
+
+	_, err = LoadKeySet(nil, "")
+	assert.Error(t, err)
+	_, err = LoadKeySet([]string{"v1:none:secret"}, "")
+	assert.Error(t, err)
+	_, err = LoadKeySet([]string{"v1:HS256:a", "v1:HS256:b"}, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ilya-burinskiy/gophermart/internal/configs"
+)
+
+const RefreshTokenCookie = "refresh_token"
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+)
+
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+func GenerateOpaqueToken() (string, error) {
+	return randomString(32)
+}
+
+func GenerateTokenFamilyID() (string, error) {
+	return randomString(16)
+}
+
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func SetRefreshTokenCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(
+		w,
+		&http.Cookie{
+			Name:     RefreshTokenCookie,
+			Value:    token,
+			Path:     "/api/user",
+			MaxAge:   int(configs.RefreshTokenExp / time.Second),
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		},
+	)
+}
+
+func SetSessionCookies(w http.ResponseWriter, tokens TokenPair) {
+	SetJWTCookie(w, tokens.AccessToken)
+	SetRefreshTokenCookie(w, tokens.RefreshToken)
+}
+
+func ClearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: "jwt", MaxAge: -1, HttpOnly: true})
+	http.SetCookie(w, &http.Cookie{Name: RefreshTokenCookie, Path: "/api/user", MaxAge: -1, HttpOnly: true})
+}
+
+func randomString(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random string: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTOTP(t *testing.T) {
+	// RFC 6238 test vectors for SHA1, truncated to six digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	testCases := []struct {
+		name     string
+		now      time.Time
+		code     string
+		wantStep int64
+		wantOk   bool
+	}{
+		{name: "accepts code for current step", now: time.Unix(59, 0), code: "287082", wantStep: 1, wantOk: true},
+		{name: "accepts code for previous step", now: time.Unix(1111111169, 0), code: "050471", wantStep: 37037037, wantOk: true},
+		{name: "accepts code with large counter", now: time.Unix(20000000000, 0), code: "353130", wantStep: 666666666, wantOk: true},
+		{name: "rejects code from distant step", now: time.Unix(1234567890+120, 0), code: "005924"},
+		{name: "rejects malformed code", now: time.Unix(59, 0), code: "28708"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(secret, tc.code, tc.now)
+			assert.Equal(t, tc.wantOk, ok)
+			assert.Equal(t, tc.wantStep, step)
+		})
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	assert.Equal(
+		t,
+		"otpauth://totp/Gophermart:john?algorithm=SHA1&digits=6&issuer=Gophermart&period=30&secret=ABC",
+		TOTPURI("Gophermart", "john", "ABC"),
+	)
+}
@@ -2,29 +2,106 @@ package configs
 
 import (
 	"flag"
+	"fmt"
+	"net/netip"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+)
+
+const (
+	AuthTokenExp          = 15 * time.Minute
+	RefreshTokenExp       = 30 * 24 * time.Hour
+	PasswordResetTokenExp = time.Hour
+	IdempotencyKeyExp     = 24 * time.Hour
+	PointsExpiryNotice    = 30 * 24 * time.Hour
 )
 
-const AuthTokenExp = 24 * time.Hour
-const SecretKey = "secret"
+// Notifiers delivering password reset tokens, password reset is disabled if
+// none is configured
+const (
+	FileNotifier = "file"
+	LogNotifier  = "log"
+)
 
 type Config struct {
-	RunAddr        string
-	DSN            string
-	AccrualBaseURL string
+	RunAddr           string
+	DSN               string
+	AccrualBaseURL    string
+	SettlementBaseURL string
+	InstanceID        string
+	JWTKeys           []string
+	JWTKeysFile       string
+	TrustedProxies    []netip.Prefix
+
+	MinPasswordLength     int
+	PasswordBlocklistFile string
+	Notifier              string
+	NotificationsFile     string
+
+	WithdrawalOTPThreshold models.Money
+	PointsLifetimeMonths   int
+	TransferDailyCap       models.Money
 }
 
-func Parse() Config {
+// Parse fails on malformed security settings instead of falling back to
+// their disabled zero value
+func Parse() (Config, error) {
+	var err error
 	config := Config{}
 	config.RunAddr = os.Getenv("RUN_ADDRESS")
 	config.DSN = os.Getenv("DATABASE_URI")
 	config.AccrualBaseURL = os.Getenv("ACCRUAL_SYSTEM_ADDRESS")
+	config.SettlementBaseURL = os.Getenv("SETTLEMENT_SYSTEM_ADDRESS")
+	config.InstanceID = os.Getenv("INSTANCE_ID")
+	config.JWTKeys = splitList(os.Getenv("JWT_KEYS"))
+	config.JWTKeysFile = os.Getenv("JWT_KEYS_FILE")
+	config.TrustedProxies, err = parseProxies("TRUSTED_PROXIES", os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return config, err
+	}
+	config.MinPasswordLength, err = parseCount("PASSWORD_MIN_LENGTH", os.Getenv("PASSWORD_MIN_LENGTH"))
+	if err != nil {
+		return config, err
+	}
+	config.PasswordBlocklistFile = os.Getenv("PASSWORD_BLOCKLIST_FILE")
+	config.Notifier = os.Getenv("NOTIFIER")
+	config.NotificationsFile = os.Getenv("NOTIFICATIONS_FILE")
+	config.WithdrawalOTPThreshold, err = parseAmount("WITHDRAWAL_OTP_THRESHOLD", os.Getenv("WITHDRAWAL_OTP_THRESHOLD"))
+	if err != nil {
+		return config, err
+	}
+	config.PointsLifetimeMonths, err = parseCount("POINTS_LIFETIME_MONTHS", os.Getenv("POINTS_LIFETIME_MONTHS"))
+	if err != nil {
+		return config, err
+	}
+	config.TransferDailyCap, err = parseAmount("TRANSFER_DAILY_CAP", os.Getenv("TRANSFER_DAILY_CAP"))
+	if err != nil {
+		return config, err
+	}
 
-	var flagRunAddr, flagDSN, flagAccrualBaseURL string
+	var flagRunAddr, flagDSN, flagAccrualBaseURL, flagInstanceID, flagJWTKeys, flagJWTKeysFile string
+	var flagSettlementBaseURL, flagTrustedProxies string
 	flag.StringVar(&flagRunAddr, "a", "", "server's address")
 	flag.StringVar(&flagDSN, "d", "", "database URI")
 	flag.StringVar(&flagAccrualBaseURL, "r", "", "accrual service address")
+	flag.StringVar(&flagSettlementBaseURL, "s", "", "payment partner settlement service address, withdrawals are confirmed at once if not set")
+	flag.StringVar(&flagInstanceID, "i", "", "instance ID used to lease orders")
+	flag.StringVar(&flagJWTKeys, "k", "", "comma separated JWT keys \"<kid>:<alg>:<secret or PEM path>\", the first one signs")
+	flag.StringVar(&flagJWTKeysFile, "kf", "", "file with one JWT key per line")
+	flag.StringVar(&flagTrustedProxies, "tp", "", "comma separated proxy addresses or CIDRs whose X-Forwarded-For is trusted")
+	var flagMinPasswordLength, flagPointsLifetimeMonths int
+	var flagPasswordBlocklistFile, flagNotifier, flagNotificationsFile, flagWithdrawalOTPThreshold, flagTransferDailyCap string
+	flag.IntVar(&flagMinPasswordLength, "pl", 0, "minimal password length")
+	flag.StringVar(&flagPasswordBlocklistFile, "pb", "", "file with one breached password per line")
+	flag.StringVar(&flagNotifier, "n", "", "notifier delivering password reset tokens: \"file\" or \"log\", password reset is disabled if not set")
+	flag.StringVar(&flagNotificationsFile, "nf", "", "file the file notifier writes user notifications to")
+	flag.StringVar(&flagWithdrawalOTPThreshold, "wt", "", "withdrawal or transfer sum above which users with 2FA must provide a TOTP code")
+	flag.StringVar(&flagTransferDailyCap, "tc", "", "sum a user can transfer to other users within 24 hours, not limited if not set")
+	flag.IntVar(&flagPointsLifetimeMonths, "pe", 0, "months after accrual when points expire, points do not expire if not set")
 	flag.Parse()
 
 	if flagRunAddr != "" {
@@ -36,6 +113,157 @@ func Parse() Config {
 	if flagAccrualBaseURL != "" {
 		config.AccrualBaseURL = flagAccrualBaseURL
 	}
+	if flagSettlementBaseURL != "" {
+		config.SettlementBaseURL = flagSettlementBaseURL
+	}
+	if flagInstanceID != "" {
+		config.InstanceID = flagInstanceID
+	}
+	if flagJWTKeys != "" {
+		config.JWTKeys = splitList(flagJWTKeys)
+	}
+	if flagJWTKeysFile != "" {
+		config.JWTKeysFile = flagJWTKeysFile
+	}
+	if flagTrustedProxies != "" {
+		config.TrustedProxies, err = parseProxies("-tp", flagTrustedProxies)
+		if err != nil {
+			return config, err
+		}
+	}
+	if flagMinPasswordLength < 0 {
+		return config, fmt.Errorf("invalid -pl: must not be negative")
+	}
+	if flagMinPasswordLength != 0 {
+		config.MinPasswordLength = flagMinPasswordLength
+	}
+	if flagPasswordBlocklistFile != "" {
+		config.PasswordBlocklistFile = flagPasswordBlocklistFile
+	}
+	if flagNotifier != "" {
+		config.Notifier = flagNotifier
+	}
+	if flagNotificationsFile != "" {
+		config.NotificationsFile = flagNotificationsFile
+	}
+	if err = validateNotifier(&config); err != nil {
+		return config, err
+	}
+	if flagWithdrawalOTPThreshold != "" {
+		config.WithdrawalOTPThreshold, err = parseAmount("-wt", flagWithdrawalOTPThreshold)
+		if err != nil {
+			return config, err
+		}
+	}
+	if flagTransferDailyCap != "" {
+		config.TransferDailyCap, err = parseAmount("-tc", flagTransferDailyCap)
+		if err != nil {
+			return config, err
+		}
+	}
+	if flagPointsLifetimeMonths < 0 {
+		return config, fmt.Errorf("invalid -pe: must not be negative")
+	}
+	if flagPointsLifetimeMonths != 0 {
+		config.PointsLifetimeMonths = flagPointsLifetimeMonths
+	}
+	if config.InstanceID == "" {
+		config.InstanceID = defaultInstanceID()
+	}
+
+	return config, nil
+}
+
+func parseAmount(name, value string) (models.Money, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	amount, err := models.ParseMoney(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if amount < 0 {
+		return 0, fmt.Errorf("invalid %s: amount must not be negative", name)
+	}
+
+	return amount, nil
+}
+
+func parseCount(name, value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if count < 0 {
+		return 0, fmt.Errorf("invalid %s: must not be negative", name)
+	}
+
+	return count, nil
+}
+
+// parseProxies accepts both single addresses and CIDRs
+func parseProxies(name, value string) ([]netip.Prefix, error) {
+	var result []netip.Prefix
+	for _, item := range splitList(value) {
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			result = append(result, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		result = append(result, prefix.Masked())
+	}
+
+	return result, nil
+}
+
+// validateNotifier picks the file notifier when only the file is given
+func validateNotifier(config *Config) error {
+	if config.Notifier == "" && config.NotificationsFile != "" {
+		config.Notifier = FileNotifier
+	}
+
+	switch config.Notifier {
+	case "", LogNotifier:
+		return nil
+	case FileNotifier:
+		if config.NotificationsFile == "" {
+			return fmt.Errorf("invalid NOTIFIER: %q requires NOTIFICATIONS_FILE", FileNotifier)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid NOTIFIER: unknown notifier %q", config.Notifier)
+	}
+}
+
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+func defaultInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "gophermart"
+	}
 
-	return config
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
 }
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ilya-burinskiy/gophermart/internal/middlewares"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/services"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+)
+
+type AdminHandlers struct {
+	store storage.Storage
+}
+
+func NewAdminHandlers(store storage.Storage) AdminHandlers {
+	return AdminHandlers{store: store}
+}
+
+func (ah AdminHandlers) SearchUsers(searchSrv services.UsersSearcher) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		users, err := searchSrv.Call(r.Context(), r.URL.Query().Get("login"))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if len(users) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		writeJSON(w, users)
+	}
+}
+
+func (ah AdminHandlers) UserOrders(fetchSrv services.UserOrdersFetcher) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		orders, err := fetchSrv.Call(r.Context(), userID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if len(orders) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		adminOrders := make([]models.AdminOrder, len(orders))
+		for i, order := range orders {
+			adminOrders[i] = models.AdminOrder(order)
+		}
+		writeJSON(w, adminOrders)
+	}
+}
+
+func (ah AdminHandlers) UserWithdrawals(fetchSrv services.UserWithdrawalsFetcher) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		withdrawals, err := fetchSrv.Call(r.Context(), userID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if len(withdrawals) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		writeJSON(w, withdrawals)
+	}
+}
+
+func (ah AdminHandlers) UserBalance(fetchSrv services.UserBalanceFetcher) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		balance, err := fetchSrv.Call(r.Context(), userID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, balance)
+	}
+}
+
+func (ah AdminHandlers) AdjustBalance(adjustSrv services.BalanceAdjuster) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type payload struct {
+			Amount models.Money `json:"amount"`
+			Reason string       `json:"reason"`
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var requestBody payload
+		if err = json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		operatorID, _ := middlewares.UserIDFromContext(r.Context())
+		adjustment, err := adjustSrv.Call(r.Context(), operatorID, userID, requestBody.Amount, requestBody.Reason)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidAdjustmentAmount) || errors.Is(err, services.ErrAdjustmentReasonRequired) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			}
+			var notFoundErr storage.ErrUserNotFound
+			if errors.As(err, &notFoundErr) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, services.ErrNotEnoughAmount) {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		responseBody, err := json.Marshal(adjustment)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write(responseBody)
+	}
+}
+
+func (ah AdminHandlers) UserBalanceAdjustments(fetchSrv services.UserBalanceAdjustmentsFetcher) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		adjustments, err := fetchSrv.Call(r.Context(), userID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if len(adjustments) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		writeJSON(w, adjustments)
+	}
+}
+
+func (ah AdminHandlers) ReverseWithdrawal(reverseSrv services.WithdrawalReverser) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type payload struct {
+			Reason string `json:"reason"`
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		var requestBody payload
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		operatorID, _ := middlewares.UserIDFromContext(r.Context())
+		withdrawal, err := reverseSrv.Call(r.Context(), operatorID, chi.URLParam(r, "number"), requestBody.Reason)
+		if err != nil {
+			if errors.Is(err, services.ErrReversalReasonRequired) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			}
+			var notFoundErr storage.ErrWithdrawalNotFound
+			if errors.As(err, &notFoundErr) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, services.ErrWithdrawalReversed) || errors.Is(err, services.ErrWithdrawalNotConfirmed) {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, withdrawal)
+	}
+}
+
+func (ah AdminHandlers) ResetOrder(resetSrv services.OrderResetter) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := resetSrv.Call(r.Context(), chi.URLParam(r, "number"))
+		if err != nil {
+			var notFoundErr storage.ErrOrderNotFound
+			if errors.As(err, &notFoundErr) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, services.ErrOrderFinalized) {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, val interface{}) {
+	responseBody, err := json.Marshal(val)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseBody)
+}
@@ -0,0 +1,360 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/ilya-burinskiy/gophermart/internal/handlers"
+	"github.com/ilya-burinskiy/gophermart/internal/middlewares"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/services"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/storage/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type usersSearcherMock struct{ mock.Mock }
+
+func (m *usersSearcherMock) Call(ctx context.Context, login string) ([]models.User, error) {
+	args := m.Called(ctx, login)
+	return args.Get(0).([]models.User), args.Error(1)
+}
+
+type orderResetterMock struct{ mock.Mock }
+
+func (m *orderResetterMock) Call(ctx context.Context, number string) error {
+	args := m.Called(ctx, number)
+	return args.Error(0)
+}
+
+type balanceAdjusterMock struct{ mock.Mock }
+
+func (m *balanceAdjusterMock) Call(ctx context.Context, operatorID, userID int, amount models.Money, reason string) (models.BalanceAdjustment, error) {
+	args := m.Called(ctx, operatorID, userID, amount, reason)
+	return args.Get(0).(models.BalanceAdjustment), args.Error(1)
+}
+
+type withdrawalReverserMock struct{ mock.Mock }
+
+func (m *withdrawalReverserMock) Call(ctx context.Context, operatorID int, orderNumber, reason string) (models.Withdrawal, error) {
+	args := m.Called(ctx, operatorID, orderNumber, reason)
+	return args.Get(0).(models.Withdrawal), args.Error(1)
+}
+
+func TestSearchUsersHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mocks.NewMockStorage(ctrl)
+	searchSrv := new(usersSearcherMock)
+
+	router := chi.NewRouter()
+	handlers := handlers.NewAdminHandlers(storageMock)
+	router.Use(
+		middlewares.Authenticate(testKeys, nil),
+		middlewares.RequireRole(storageMock, models.AdminRole),
+	)
+	router.Get("/api/admin/users", handlers.SearchUsers(searchSrv))
+	testServer := httptest.NewServer(router)
+	defer testServer.Close()
+
+	admin := models.User{ID: 1, Login: "admin", Role: models.AdminRole}
+	regular := models.User{ID: 2, Login: "login", Role: models.RegularRole}
+	storageMock.EXPECT().FindUserByID(gomock.Any(), admin.ID).AnyTimes().Return(admin, nil)
+	storageMock.EXPECT().FindUserByID(gomock.Any(), regular.ID).AnyTimes().Return(regular, nil)
+	testCases := []struct {
+		name        string
+		currentUser models.User
+		users       []models.User
+		callErr     error
+		want        want
+	}{
+		{
+			name:        "responses with found users",
+			currentUser: admin,
+			users:       []models.User{regular},
+			want: want{
+				code:        http.StatusOK,
+				response:    "[{\"id\":2,\"login\":\"login\",\"role\":\"user\",\"totp_enabled\":false}]",
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:        "responses with no content status if nothing found",
+			currentUser: admin,
+			want: want{
+				code:        http.StatusNoContent,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:        "responses with forbidden status if user is not admin",
+			currentUser: regular,
+			want: want{
+				code: http.StatusForbidden,
+			},
+		},
+		{
+			name:        "responses with internal server error status if an error occured",
+			currentUser: admin,
+			callErr:     errors.New("db error"),
+			want: want{
+				code:        http.StatusInternalServerError,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			searchMockCall := searchSrv.On("Call", mock.Anything, "log").Return(tc.users, tc.callErr)
+			defer searchMockCall.Unset()
+
+			request, err := http.NewRequest(http.MethodGet, testServer.URL+"/api/admin/users?login=log", nil)
+			require.NoError(t, err)
+			request.Header.Set("Accept-Encoding", "identity")
+			request.AddCookie(generateAuthCookie(tc.currentUser, t))
+
+			response, err := testServer.Client().Do(request)
+			require.NoError(t, err)
+			resBody, err := io.ReadAll(response.Body)
+			defer response.Body.Close()
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want.code, response.StatusCode)
+			assert.Equal(t, tc.want.response, string(resBody))
+			assert.Equal(t, tc.want.contentType, response.Header.Get("Content-Type"))
+		})
+	}
+}
+
+func TestResetOrderHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mocks.NewMockStorage(ctrl)
+	resetSrv := new(orderResetterMock)
+
+	router := chi.NewRouter()
+	handlers := handlers.NewAdminHandlers(storageMock)
+	router.Post("/api/admin/orders/{number}/reset", handlers.ResetOrder(resetSrv))
+	testServer := httptest.NewServer(router)
+	defer testServer.Close()
+
+	testCases := []struct {
+		name    string
+		callErr error
+		want    want
+	}{
+		{
+			name: "responses with accepted status",
+			want: want{code: http.StatusAccepted},
+		},
+		{
+			name:    "responses with not found status if order does not exist",
+			callErr: storage.ErrOrderNotFound{},
+			want:    want{code: http.StatusNotFound},
+		},
+		{
+			name:    "responses with conflict status if order is finalized",
+			callErr: services.ErrOrderFinalized,
+			want:    want{code: http.StatusConflict},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resetMockCall := resetSrv.On("Call", mock.Anything, "12345678903").Return(tc.callErr)
+			defer resetMockCall.Unset()
+
+			request, err := http.NewRequest(http.MethodPost, testServer.URL+"/api/admin/orders/12345678903/reset", nil)
+			require.NoError(t, err)
+
+			response, err := testServer.Client().Do(request)
+			require.NoError(t, err)
+			defer response.Body.Close()
+
+			assert.Equal(t, tc.want.code, response.StatusCode)
+		})
+	}
+}
+
+func TestAdjustBalanceHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mocks.NewMockStorage(ctrl)
+	adjustSrv := new(balanceAdjusterMock)
+
+	router := chi.NewRouter()
+	handlers := handlers.NewAdminHandlers(storageMock)
+	router.Use(middlewares.Authenticate(testKeys, nil))
+	router.Post("/api/admin/users/{id}/balance/adjustments", handlers.AdjustBalance(adjustSrv))
+	testServer := httptest.NewServer(router)
+	defer testServer.Close()
+
+	operator := models.User{ID: 1, Login: "admin", Role: models.AdminRole}
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	adjustment := models.BalanceAdjustment{ID: 3, UserID: 2, OperatorID: operator.ID, Amount: 1050, Reason: "lost accrual", CreatedAt: createdAt}
+	reqBody := `{"amount":10.5,"reason":"lost accrual"}`
+	testCases := []struct {
+		name    string
+		callErr error
+		want    want
+	}{
+		{
+			name: "responses with created adjustment",
+			want: want{
+				code:        http.StatusCreated,
+				response:    "{\"id\":3,\"user_id\":2,\"operator_id\":1,\"amount\":10.5,\"reason\":\"lost accrual\",\"created_at\":\"2024-01-01T00:00:00Z\"}",
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:    "responses with unprocessable entity status if reason is missing",
+			callErr: services.ErrAdjustmentReasonRequired,
+			want: want{
+				code:        http.StatusUnprocessableEntity,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:    "responses with not found status if user does not exist",
+			callErr: storage.ErrUserNotFound{},
+			want: want{
+				code:        http.StatusNotFound,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:    "responses with conflict status if debit exceeds balance",
+			callErr: services.ErrNotEnoughAmount,
+			want: want{
+				code:        http.StatusConflict,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			adjustMockCall := adjustSrv.
+				On("Call", mock.Anything, operator.ID, 2, models.Money(1050), "lost accrual").
+				Return(adjustment, tc.callErr)
+			defer adjustMockCall.Unset()
+
+			request, err := http.NewRequest(http.MethodPost, testServer.URL+"/api/admin/users/2/balance/adjustments", strings.NewReader(reqBody))
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("Accept-Encoding", "identity")
+			request.AddCookie(generateAuthCookie(operator, t))
+
+			response, err := testServer.Client().Do(request)
+			require.NoError(t, err)
+			resBody, err := io.ReadAll(response.Body)
+			defer response.Body.Close()
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want.code, response.StatusCode)
+			assert.Equal(t, tc.want.response, string(resBody))
+			assert.Equal(t, tc.want.contentType, response.Header.Get("Content-Type"))
+		})
+	}
+}
+
+func TestReverseWithdrawalHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mocks.NewMockStorage(ctrl)
+	reverseSrv := new(withdrawalReverserMock)
+
+	router := chi.NewRouter()
+	handlers := handlers.NewAdminHandlers(storageMock)
+	router.Use(middlewares.Authenticate(testKeys, nil))
+	router.Post("/api/admin/withdrawals/{number}/reverse", handlers.ReverseWithdrawal(reverseSrv))
+	testServer := httptest.NewServer(router)
+	defer testServer.Close()
+
+	operator := models.User{ID: 1, Login: "admin", Role: models.AdminRole}
+	processedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	reversedAt := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	withdrawal := models.Withdrawal{
+		OrderNumber:    "12345678903",
+		UserID:         2,
+		Sum:            500,
+		Status:         models.ConfirmedWithdrawal,
+		ProcessedAt:    processedAt,
+		ReversedAt:     &reversedAt,
+		ReversalReason: "order cancelled",
+	}
+	testCases := []struct {
+		name    string
+		callErr error
+		want    want
+	}{
+		{
+			name: "responses with reversed withdrawal",
+			want: want{
+				code:        http.StatusOK,
+				response:    "{\"number\":\"12345678903\",\"sum\":5,\"processed_at\":\"2024-01-01T00:00:00Z\",\"reversed_at\":\"2024-01-02T00:00:00Z\",\"reversal_reason\":\"order cancelled\",\"status\":\"CONFIRMED\"}",
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:    "responses with not found status if withdrawal does not exist",
+			callErr: storage.ErrWithdrawalNotFound{OrderNumber: "12345678903"},
+			want: want{
+				code:        http.StatusNotFound,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:    "responses with conflict status if withdrawal is already reversed",
+			callErr: services.ErrWithdrawalReversed,
+			want: want{
+				code:        http.StatusConflict,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:    "responses with conflict status if withdrawal is not confirmed",
+			callErr: services.ErrWithdrawalNotConfirmed,
+			want: want{
+				code:        http.StatusConflict,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reverseMockCall := reverseSrv.
+				On("Call", mock.Anything, operator.ID, "12345678903", "order cancelled").
+				Return(withdrawal, tc.callErr)
+			defer reverseMockCall.Unset()
+
+			request, err := http.NewRequest(
+				http.MethodPost,
+				testServer.URL+"/api/admin/withdrawals/12345678903/reverse",
+				strings.NewReader(`{"reason":"order cancelled"}`),
+			)
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("Accept-Encoding", "identity")
+			request.AddCookie(generateAuthCookie(operator, t))
+
+			response, err := testServer.Client().Do(request)
+			require.NoError(t, err)
+			resBody, err := io.ReadAll(response.Body)
+			defer response.Body.Close()
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want.code, response.StatusCode)
+			assert.Equal(t, tc.want.response, string(resBody))
+			assert.Equal(t, tc.want.contentType, response.Header.Get("Content-Type"))
+		})
+	}
+}
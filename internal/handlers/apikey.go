@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ilya-burinskiy/gophermart/internal/middlewares"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/services"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+)
+
+func (h UserHandlers) CreateAPIKey(createSrv services.APIKeyCreator) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type payload struct {
+			Name   string   `json:"name"`
+			Scopes []string `json:"scopes"`
+		}
+		type response struct {
+			models.APIKey
+			Key string `json:"key"`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		var requestBody payload
+		decoder := json.NewDecoder(r.Body)
+		encoder := json.NewEncoder(w)
+
+		err := decoder.Decode(&requestBody)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			encoder.Encode("invalid request body")
+			return
+		}
+
+		userID, _ := middlewares.UserIDFromContext(r.Context())
+		apiKey, plainKey, err := createSrv.Call(r.Context(), userID, requestBody.Name, requestBody.Scopes)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidAPIKeyName) || errors.Is(err, services.ErrInvalidAPIKeyScopes) {
+				w.WriteHeader(http.StatusBadRequest)
+				encoder.Encode(err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			encoder.Encode(err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		encoder.Encode(response{APIKey: apiKey, Key: plainKey})
+	}
+}
+
+func (h UserHandlers) GetAPIKeys(fetchSrv services.UserAPIKeysFetcher) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+
+		userID, _ := middlewares.UserIDFromContext(r.Context())
+		apiKeys, err := fetchSrv.Call(r.Context(), userID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			encoder.Encode(err.Error())
+			return
+		}
+		if len(apiKeys) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		encoder.Encode(apiKeys)
+	}
+}
+
+func (h UserHandlers) RevokeAPIKey(revokeSrv services.APIKeyRevoker) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+
+		keyID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			encoder.Encode("invalid api key id")
+			return
+		}
+
+		userID, _ := middlewares.UserIDFromContext(r.Context())
+		if err = revokeSrv.Call(r.Context(), userID, keyID); err != nil {
+			var notFoundErr storage.ErrAPIKeyNotFound
+			if errors.As(err, &notFoundErr) {
+				w.WriteHeader(http.StatusNotFound)
+				encoder.Encode(err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			encoder.Encode(err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
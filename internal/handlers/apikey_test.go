@@ -0,0 +1,196 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/ilya-burinskiy/gophermart/internal/handlers"
+	"github.com/ilya-burinskiy/gophermart/internal/middlewares"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/services"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/storage/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type apiKeyCreatorMock struct{ mock.Mock }
+
+func (m *apiKeyCreatorMock) Call(ctx context.Context, userID int, name string, scopes []string) (models.APIKey, string, error) {
+	args := m.Called(ctx, userID, name, scopes)
+	return args.Get(0).(models.APIKey), args.String(1), args.Error(2)
+}
+
+type apiKeyRevokerMock struct{ mock.Mock }
+
+func (m *apiKeyRevokerMock) Call(ctx context.Context, userID, keyID int) error {
+	args := m.Called(ctx, userID, keyID)
+	return args.Error(0)
+}
+
+func TestCreateAPIKeyHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mocks.NewMockStorage(ctrl)
+	createSrv := new(apiKeyCreatorMock)
+
+	router := chi.NewRouter()
+	handlers := handlers.NewUserHandlers(storageMock)
+	router.Use(middlewares.Authenticate(testKeys, nil))
+	router.Post("/api/user/api-keys", handlers.CreateAPIKey(createSrv))
+	testServer := httptest.NewServer(router)
+	defer testServer.Close()
+
+	currentUser := models.User{ID: 1, Login: "login"}
+	scopes := []string{models.ScopeOrdersWrite}
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	apiKey := models.APIKey{ID: 3, UserID: currentUser.ID, Name: "uploader", Prefix: "gm_abcdefgh", Scopes: scopes, CreatedAt: createdAt}
+	reqBody := marshalJSON(map[string]interface{}{"name": "uploader", "scopes": scopes}, t)
+	testCases := []struct {
+		name       string
+		authCookie *http.Cookie
+		callErr    error
+		want       want
+	}{
+		{
+			name:       "responses with created status and plain key",
+			authCookie: generateAuthCookie(currentUser, t),
+			want: want{
+				code:        http.StatusCreated,
+				response:    "{\"id\":3,\"name\":\"uploader\",\"prefix\":\"gm_abcdefgh\",\"scopes\":[\"orders:write\"],\"created_at\":\"2024-01-01T00:00:00Z\",\"key\":\"gm_abcdefgh_secret\"}\n",
+				contentType: "application/json",
+			},
+		},
+		{
+			name:       "responses with unauthorized status if user is not authenticated",
+			authCookie: &http.Cookie{},
+			want: want{
+				code: http.StatusUnauthorized,
+			},
+		},
+		{
+			name:       "responses with bad request status if scopes are invalid",
+			authCookie: generateAuthCookie(currentUser, t),
+			callErr:    services.ErrInvalidAPIKeyScopes,
+			want: want{
+				code:        http.StatusBadRequest,
+				response:    "\"api key must have at least one known scope\"\n",
+				contentType: "application/json",
+			},
+		},
+		{
+			name:       "responses with internal server error status if an error occured",
+			authCookie: generateAuthCookie(currentUser, t),
+			callErr:    errors.New("db error"),
+			want: want{
+				code:        http.StatusInternalServerError,
+				response:    "\"db error\"\n",
+				contentType: "application/json",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			createMockCall := createSrv.
+				On("Call", mock.Anything, currentUser.ID, "uploader", scopes).
+				Return(apiKey, "gm_abcdefgh_secret", tc.callErr)
+			defer createMockCall.Unset()
+
+			request, err := http.NewRequest(http.MethodPost, testServer.URL+"/api/user/api-keys", strings.NewReader(reqBody))
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("Accept-Encoding", "identity")
+			request.AddCookie(tc.authCookie)
+
+			response, err := testServer.Client().Do(request)
+			require.NoError(t, err)
+			resBody, err := io.ReadAll(response.Body)
+			defer response.Body.Close()
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want.code, response.StatusCode)
+			assert.Equal(t, tc.want.response, string(resBody))
+			assert.Equal(t, tc.want.contentType, response.Header.Get("Content-Type"))
+		})
+	}
+}
+
+func TestRevokeAPIKeyHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mocks.NewMockStorage(ctrl)
+	revokeSrv := new(apiKeyRevokerMock)
+
+	router := chi.NewRouter()
+	handlers := handlers.NewUserHandlers(storageMock)
+	router.Use(middlewares.Authenticate(testKeys, nil))
+	router.Delete("/api/user/api-keys/{id}", handlers.RevokeAPIKey(revokeSrv))
+	testServer := httptest.NewServer(router)
+	defer testServer.Close()
+
+	currentUser := models.User{ID: 1, Login: "login"}
+	testCases := []struct {
+		name    string
+		keyID   string
+		callErr error
+		want    want
+	}{
+		{
+			name:  "responses with no content status",
+			keyID: "3",
+			want: want{
+				code:        http.StatusNoContent,
+				contentType: "application/json",
+			},
+		},
+		{
+			name:    "responses with not found status if key does not belong to user",
+			keyID:   "3",
+			callErr: storage.ErrAPIKeyNotFound{ID: 3},
+			want: want{
+				code:        http.StatusNotFound,
+				response:    "\"api key id=3 not found\"\n",
+				contentType: "application/json",
+			},
+		},
+		{
+			name:  "responses with bad request status if id is invalid",
+			keyID: "abc",
+			want: want{
+				code:        http.StatusBadRequest,
+				response:    "\"invalid api key id\"\n",
+				contentType: "application/json",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			revokeMockCall := revokeSrv.On("Call", mock.Anything, currentUser.ID, 3).Return(tc.callErr)
+			defer revokeMockCall.Unset()
+
+			request, err := http.NewRequest(http.MethodDelete, testServer.URL+"/api/user/api-keys/"+tc.keyID, nil)
+			require.NoError(t, err)
+			request.Header.Set("Accept-Encoding", "identity")
+			request.AddCookie(generateAuthCookie(currentUser, t))
+
+			response, err := testServer.Client().Do(request)
+			require.NoError(t, err)
+			resBody, err := io.ReadAll(response.Body)
+			defer response.Body.Close()
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want.code, response.StatusCode)
+			assert.Equal(t, tc.want.response, string(resBody))
+			assert.Equal(t, tc.want.contentType, response.Header.Get("Content-Type"))
+		})
+	}
+}
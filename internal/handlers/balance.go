@@ -6,6 +6,8 @@ import (
 	"net/http"
 
 	"github.com/ilya-burinskiy/gophermart/internal/middlewares"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/services"
 	"github.com/ilya-burinskiy/gophermart/internal/storage"
 )
 
@@ -17,23 +19,102 @@ func NewBalanceHandlers(store storage.Storage) BalanceHandlers {
 	return BalanceHandlers{store: store}
 }
 
-func (bh BalanceHandlers) Get(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	userID, _ := middlewares.UserIDFromContext(r.Context())
-	balance, err := bh.store.FindBalanceByUserID(r.Context(), userID)
+func (bh BalanceHandlers) Get(fetchSrv services.UserBalanceFetcher) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		userID, _ := middlewares.UserIDFromContext(r.Context())
+		balance, err := fetchSrv.Call(r.Context(), userID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 
-	var notFoundErr storage.ErrBalanceNotFound
-	if err != nil && !errors.As(err, &notFoundErr) {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		responseBody, err := json.Marshal(balance)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseBody)
 	}
+}
+
+func (bh BalanceHandlers) History(fetchSrv services.UserBalanceHistoryFetcher) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		userID, _ := middlewares.UserIDFromContext(r.Context())
+		entries, err := fetchSrv.Call(r.Context(), userID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if len(entries) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
 
-	responseBody, err := json.Marshal(balance)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		responseBody, err := json.Marshal(entries)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseBody)
 	}
+}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write(responseBody)
+func (bh BalanceHandlers) Transfer(transferSrv services.PointsTransferrer) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type payload struct {
+			Recipient string       `json:"recipient"`
+			Sum       models.Money `json:"sum"`
+			OTP       string       `json:"otp"`
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		var requestBody payload
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		userID, _ := middlewares.UserIDFromContext(r.Context())
+		transfer, err := transferSrv.Call(r.Context(), userID, requestBody.Recipient, requestBody.Sum, requestBody.OTP)
+		if err != nil {
+			if errors.Is(err, services.ErrNotEnoughAmount) {
+				w.WriteHeader(http.StatusPaymentRequired)
+				return
+			}
+			if errors.Is(err, services.ErrTransferCapExceeded) ||
+				errors.Is(err, services.ErrOTPRequired) ||
+				errors.Is(err, services.ErrInvalidOTP) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			var lockedErr services.ErrStepUpLocked
+			if errors.As(err, &lockedErr) {
+				writeRetryAfter(w, lockedErr.RetryAfter)
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			if errors.Is(err, services.ErrInvalidSum) ||
+				errors.Is(err, services.ErrSelfTransfer) ||
+				errors.Is(err, services.ErrUnknownRecipient) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		responseBody, err := json.Marshal(transfer)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseBody)
+	}
 }
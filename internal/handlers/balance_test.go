@@ -1,36 +1,47 @@
 package handlers_test
 
 import (
+	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/golang/mock/gomock"
 	"github.com/ilya-burinskiy/gophermart/internal/handlers"
 	"github.com/ilya-burinskiy/gophermart/internal/middlewares"
 	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/services"
 	"github.com/ilya-burinskiy/gophermart/internal/storage/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
+type fetchBalanceMock struct{ mock.Mock }
+
+func (m *fetchBalanceMock) Call(ctx context.Context, userID int) (models.Balance, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(models.Balance), args.Error(1)
+}
+
 func TestGetBalanceHandler(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	storageMock := mocks.NewMockStorage(ctrl)
+	fetchSrv := new(fetchBalanceMock)
 
 	currentUser := models.User{ID: 1, Login: "login", EncryptedPassword: hashPassword("password", t)}
-	balance := models.Balance{ID: 1, UserID: currentUser.ID}
-	storageMock.EXPECT().
-		FindBalanceByUserID(gomock.Any(), gomock.Any()).
-		AnyTimes().
-		Return(balance, nil)
+	balance := models.Balance{ID: 1, UserID: currentUser.ID, CurrentAmount: 50000, ExpiringSoon: 1250}
+	fetchSrv.On("Call", mock.Anything, currentUser.ID).Return(balance, nil)
 
 	router := chi.NewRouter()
 	handlers := handlers.NewBalanceHandlers(storageMock)
-	router.Use(middlewares.Authenticate)
-	router.Get("/api/user/balance", handlers.Get)
+	router.Use(middlewares.Authenticate(testKeys, nil))
+	router.Get("/api/user/balance", handlers.Get(fetchSrv))
 	testServer := httptest.NewServer(router)
 	defer testServer.Close()
 
@@ -91,3 +102,246 @@ func TestGetBalanceHandler(t *testing.T) {
 		})
 	}
 }
+
+type fetchBalanceHistoryMock struct{ mock.Mock }
+
+func (m *fetchBalanceHistoryMock) Call(ctx context.Context, userID int) ([]models.LedgerEntry, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]models.LedgerEntry), args.Error(1)
+}
+
+type fetchBalanceHistoryCallResult struct {
+	returnValue []models.LedgerEntry
+	err         error
+}
+
+func TestGetBalanceHistoryHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mocks.NewMockStorage(ctrl)
+
+	router := chi.NewRouter()
+	handlers := handlers.NewBalanceHandlers(storageMock)
+	fetchSrv := new(fetchBalanceHistoryMock)
+	router.Use(middlewares.Authenticate(testKeys, nil))
+	router.Get("/api/user/balance/history", handlers.History(fetchSrv))
+	testServer := httptest.NewServer(router)
+	defer testServer.Close()
+
+	currentUser := models.User{ID: 1, Login: "login", EncryptedPassword: hashPassword("password", t)}
+	currentUserAuthCookie := generateAuthCookie(currentUser, t)
+	createdAt := time.Now()
+	entries := []models.LedgerEntry{
+		{ID: 2, UserID: currentUser.ID, Amount: -2000, Kind: models.WithdrawalEntry, OrderNumber: "456", CreatedAt: createdAt},
+		{ID: 1, UserID: currentUser.ID, Amount: 72998, Kind: models.AccrualEntry, OrderNumber: "123", CreatedAt: createdAt},
+	}
+	testCases := []struct {
+		name                          string
+		authCookie                    *http.Cookie
+		fetchBalanceHistoryCallResult fetchBalanceHistoryCallResult
+		want                          want
+	}{
+		{
+			name:       "responses with ok status",
+			authCookie: currentUserAuthCookie,
+			fetchBalanceHistoryCallResult: fetchBalanceHistoryCallResult{
+				returnValue: entries,
+			},
+			want: want{
+				code:        http.StatusOK,
+				response:    marshalJSON(entries, t),
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:       "responses with unauthorized status if user is not authenticated",
+			authCookie: &http.Cookie{},
+			want: want{
+				code: http.StatusUnauthorized,
+			},
+		},
+		{
+			name:       "responses with no content status if there are no entries",
+			authCookie: currentUserAuthCookie,
+			fetchBalanceHistoryCallResult: fetchBalanceHistoryCallResult{
+				returnValue: []models.LedgerEntry{},
+			},
+			want: want{
+				code:        http.StatusNoContent,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:       "responses with internal server error if error occured",
+			authCookie: currentUserAuthCookie,
+			fetchBalanceHistoryCallResult: fetchBalanceHistoryCallResult{
+				err: errors.New("error"),
+			},
+			want: want{
+				code:        http.StatusInternalServerError,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fetchSrvMockCall := fetchSrv.
+				On("Call", mock.Anything, mock.Anything).
+				Return(
+					tc.fetchBalanceHistoryCallResult.returnValue,
+					tc.fetchBalanceHistoryCallResult.err,
+				)
+			defer fetchSrvMockCall.Unset()
+
+			request, err := http.NewRequest(http.MethodGet, testServer.URL+"/api/user/balance/history", nil)
+			require.NoError(t, err)
+			request.Header.Set("Accept-Encoding", "identity")
+			request.AddCookie(tc.authCookie)
+
+			response, err := testServer.Client().Do(request)
+			require.NoError(t, err)
+			resBody, err := io.ReadAll(response.Body)
+			defer response.Body.Close()
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want.code, response.StatusCode)
+			assert.Equal(t, tc.want.response, string(resBody))
+			assert.Equal(t, tc.want.contentType, response.Header.Get("Content-Type"))
+		})
+	}
+}
+
+type transferPointsMock struct{ mock.Mock }
+
+func (m *transferPointsMock) Call(
+	ctx context.Context,
+	senderID int,
+	recipientLogin string,
+	sum models.Money,
+	otp string) (models.Transfer, error) {
+
+	args := m.Called(ctx, senderID, recipientLogin, sum, otp)
+	return args.Get(0).(models.Transfer), args.Error(1)
+}
+
+func TestTransferHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mocks.NewMockStorage(ctrl)
+	transferSrv := new(transferPointsMock)
+
+	router := chi.NewRouter()
+	handlers := handlers.NewBalanceHandlers(storageMock)
+	router.Use(middlewares.Authenticate(testKeys, nil))
+	router.Post("/api/user/balance/transfer", handlers.Transfer(transferSrv))
+	testServer := httptest.NewServer(router)
+	defer testServer.Close()
+
+	currentUser := models.User{ID: 1, Login: "login", EncryptedPassword: hashPassword("password", t)}
+	transfer := models.Transfer{
+		ID:          1,
+		SenderID:    currentUser.ID,
+		RecipientID: 2,
+		Recipient:   "relative",
+		Sum:         1500,
+		CreatedAt:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	testCases := []struct {
+		name    string
+		callErr error
+		want    want
+	}{
+		{
+			name: "responses with transfer",
+			want: want{
+				code:        http.StatusOK,
+				response:    "{\"recipient\":\"relative\",\"sum\":15,\"processed_at\":\"2024-01-01T00:00:00Z\"}",
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:    "responses with payment required status if there is not enough amount",
+			callErr: services.ErrNotEnoughAmount,
+			want: want{
+				code:        http.StatusPaymentRequired,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:    "responses with forbidden status if daily cap is exceeded",
+			callErr: services.ErrTransferCapExceeded,
+			want: want{
+				code:        http.StatusForbidden,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:    "responses with forbidden status if otp is required",
+			callErr: services.ErrOTPRequired,
+			want: want{
+				code:        http.StatusForbidden,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:    "responses with forbidden status if otp is invalid",
+			callErr: services.ErrInvalidOTP,
+			want: want{
+				code:        http.StatusForbidden,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:    "responses with too many requests status if step-up is locked",
+			callErr: services.ErrStepUpLocked{RetryAfter: time.Minute},
+			want: want{
+				code:        http.StatusTooManyRequests,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:    "responses with unprocessable entity status if recipient is sender",
+			callErr: services.ErrSelfTransfer,
+			want: want{
+				code:        http.StatusUnprocessableEntity,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:    "responses with unprocessable entity status if recipient does not exist",
+			callErr: services.ErrUnknownRecipient,
+			want: want{
+				code:        http.StatusUnprocessableEntity,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			transferMockCall := transferSrv.
+				On("Call", mock.Anything, currentUser.ID, "relative", models.Money(1500), "123456").
+				Return(transfer, tc.callErr)
+			defer transferMockCall.Unset()
+
+			request, err := http.NewRequest(
+				http.MethodPost,
+				testServer.URL+"/api/user/balance/transfer",
+				strings.NewReader(`{"recipient":"relative","sum":15,"otp":"123456"}`),
+			)
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("Accept-Encoding", "identity")
+			request.AddCookie(generateAuthCookie(currentUser, t))
+
+			response, err := testServer.Client().Do(request)
+			require.NoError(t, err)
+			resBody, err := io.ReadAll(response.Body)
+			defer response.Body.Close()
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want.code, response.StatusCode)
+			assert.Equal(t, tc.want.response, string(resBody))
+			assert.Equal(t, tc.want.contentType, response.Header.Get("Content-Type"))
+		})
+	}
+}
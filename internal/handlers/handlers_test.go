@@ -12,6 +12,8 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+var testKeys, _ = auth.NewKeySet(auth.NewHMACKey("test", []byte("secret")))
+
 type want struct {
 	code        int
 	response    string
@@ -33,7 +35,7 @@ func hashPassword(password string, t *testing.T) string {
 }
 
 func generateAuthCookie(user models.User, t *testing.T) *http.Cookie {
-	jwtStr, err := auth.BuildJWTString(user)
+	jwtStr, err := testKeys.BuildJWTString(user)
 	require.NoError(t, err)
 
 	return &http.Cookie{
@@ -5,10 +5,12 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/ilya-burinskiy/gophermart/internal/middlewares"
 	"github.com/ilya-burinskiy/gophermart/internal/services"
 	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
 )
 
 type OrderHandlers struct {
@@ -28,18 +30,21 @@ func (oh OrderHandlers) Create(createSrv services.OrderCreater) func(http.Respon
 			return
 		}
 
-		orderNumber := string(rawBody)
+		orderNumber := strings.TrimSpace(string(rawBody))
 		userID, _ := middlewares.UserIDFromContext(r.Context())
 		_, err = createSrv.Call(r.Context(), orderNumber, userID)
 
 		var duplicateErr services.ErrDuplicatedOrder
 		var conflictErr services.ErrConflicOrder
+		var invalidNumberErr validation.ErrInvalidOrderNumber
 		if err != nil {
 			switch {
 			case errors.As(err, &duplicateErr):
 				w.WriteHeader(http.StatusOK)
 			case errors.As(err, &conflictErr):
 				w.WriteHeader(http.StatusConflict)
+			case errors.As(err, &invalidNumberErr):
+				w.WriteHeader(http.StatusUnprocessableEntity)
 			default:
 				w.WriteHeader(http.StatusInternalServerError)
 			}
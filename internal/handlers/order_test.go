@@ -18,6 +18,7 @@ import (
 	"github.com/ilya-burinskiy/gophermart/internal/models"
 	"github.com/ilya-burinskiy/gophermart/internal/services"
 	"github.com/ilya-burinskiy/gophermart/internal/storage/mocks"
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -43,7 +44,7 @@ func TestCreateOrderHandler(t *testing.T) {
 	router := chi.NewRouter()
 	handlers := handlers.NewOrderHandlers(storageMock)
 	createSrvMock := new(orderCreaterMock)
-	router.Use(middlewares.Authenticate)
+	router.Use(middlewares.Authenticate(testKeys, nil))
 	router.Post("/api/user/orders", handlers.Create(createSrvMock))
 	testServer := httptest.NewServer(router)
 	defer testServer.Close()
@@ -130,6 +131,22 @@ func TestCreateOrderHandler(t *testing.T) {
 				contentType: "text/plain; charset=utf-8",
 			},
 		},
+		{
+			name:        "responses with unprocessable entity status if order number is invalid",
+			httpMethod:  http.MethodPost,
+			path:        "/api/user/orders",
+			reqBody:     "12345",
+			authCookie:  generateAuthCookie(currentUser, t),
+			contentType: "text/plain",
+			orderCreaterCallResult: orderCreaterCallResult{
+				err: validation.ErrInvalidOrderNumber{Number: "12345", Reason: "checksum mismatch"},
+			},
+			want: want{
+				code:        http.StatusUnprocessableEntity,
+				response:    "invalid order number \"12345\": checksum mismatch",
+				contentType: "text/plain; charset=utf-8",
+			},
+		},
 		{
 			name:        "responses with internal server status if error occured",
 			httpMethod:  http.MethodPost,
@@ -203,7 +220,7 @@ func TestGetOrdersHandler(t *testing.T) {
 	router := chi.NewRouter()
 	handlers := handlers.NewOrderHandlers(storageMock)
 	fetchSrv := new(getOrdersMock)
-	router.Use(middlewares.Authenticate)
+	router.Use(middlewares.Authenticate(testKeys, nil))
 	router.Get("/api/user/orders", handlers.Get(fetchSrv))
 	testServer := httptest.NewServer(router)
 	defer testServer.Close()
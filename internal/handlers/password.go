@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ilya-burinskiy/gophermart/internal/auth"
+	"github.com/ilya-burinskiy/gophermart/internal/middlewares"
+	"github.com/ilya-burinskiy/gophermart/internal/services"
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
+)
+
+func (h UserHandlers) ChangePassword(changeSrv services.PasswordChanger) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type payload struct {
+			CurrentPassword string `json:"current_password"`
+			NewPassword     string `json:"new_password"`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		var requestBody payload
+		decoder := json.NewDecoder(r.Body)
+		encoder := json.NewEncoder(w)
+
+		err := decoder.Decode(&requestBody)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			encoder.Encode("invalid request body")
+			return
+		}
+
+		userID, _ := middlewares.UserIDFromContext(r.Context())
+		tokens, err := changeSrv.Call(r.Context(), userID, requestBody.CurrentPassword, requestBody.NewPassword)
+		if err != nil {
+			var invalidErr validation.ErrInvalidCredentials
+			if errors.As(err, &invalidErr) {
+				w.WriteHeader(http.StatusBadRequest)
+				encoder.Encode(map[string][]validation.Violation{"errors": invalidErr.Violations})
+				return
+			}
+			if errors.Is(err, auth.ErrInvalidCreds) {
+				w.WriteHeader(http.StatusForbidden)
+				encoder.Encode("invalid current password")
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			encoder.Encode(err.Error())
+			return
+		}
+
+		writeSession(w, r, tokens)
+	}
+}
+
+func (h UserHandlers) RequestPasswordReset(requestSrv services.PasswordResetRequester) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type payload struct {
+			Login string `json:"login"`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		var requestBody payload
+		decoder := json.NewDecoder(r.Body)
+		encoder := json.NewEncoder(w)
+
+		err := decoder.Decode(&requestBody)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			encoder.Encode("invalid request body")
+			return
+		}
+
+		if err = requestSrv.Call(r.Context(), requestBody.Login); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			encoder.Encode(err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func (h UserHandlers) ResetPassword(resetSrv services.PasswordResetter) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type payload struct {
+			Token       string `json:"token"`
+			NewPassword string `json:"new_password"`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		var requestBody payload
+		decoder := json.NewDecoder(r.Body)
+		encoder := json.NewEncoder(w)
+
+		err := decoder.Decode(&requestBody)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			encoder.Encode("invalid request body")
+			return
+		}
+
+		err = resetSrv.Call(r.Context(), requestBody.Token, requestBody.NewPassword)
+		if err != nil {
+			var invalidErr validation.ErrInvalidCredentials
+			if errors.As(err, &invalidErr) {
+				w.WriteHeader(http.StatusBadRequest)
+				encoder.Encode(map[string][]validation.Violation{"errors": invalidErr.Violations})
+				return
+			}
+			if errors.Is(err, services.ErrInvalidResetToken) {
+				w.WriteHeader(http.StatusBadRequest)
+				encoder.Encode(services.ErrInvalidResetToken.Error())
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			encoder.Encode(err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,202 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/ilya-burinskiy/gophermart/internal/auth"
+	"github.com/ilya-burinskiy/gophermart/internal/handlers"
+	"github.com/ilya-burinskiy/gophermart/internal/middlewares"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/services"
+	"github.com/ilya-burinskiy/gophermart/internal/storage/mocks"
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type passwordChangerMock struct{ mock.Mock }
+
+func (m *passwordChangerMock) Call(ctx context.Context, userID int, currentPassword, newPassword string) (auth.TokenPair, error) {
+	args := m.Called(ctx, userID, currentPassword, newPassword)
+	return args.Get(0).(auth.TokenPair), args.Error(1)
+}
+
+func TestChangePasswordHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mocks.NewMockStorage(ctrl)
+	changeSrv := new(passwordChangerMock)
+
+	router := chi.NewRouter()
+	handlers := handlers.NewUserHandlers(storageMock)
+	router.Use(middlewares.Authenticate(testKeys, nil))
+	router.Put("/api/user/password", handlers.ChangePassword(changeSrv))
+	testServer := httptest.NewServer(router)
+	defer testServer.Close()
+
+	currentUser := models.User{ID: 1, Login: "login"}
+	reqBody := marshalJSON(map[string]string{"current_password": "old password", "new_password": "new password"}, t)
+	testCases := []struct {
+		name       string
+		authCookie *http.Cookie
+		callErr    error
+		want       want
+	}{
+		{
+			name:       "responses with ok status",
+			authCookie: generateAuthCookie(currentUser, t),
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+			},
+		},
+		{
+			name:       "responses with unauthorized status if user is not authenticated",
+			authCookie: &http.Cookie{},
+			want: want{
+				code: http.StatusUnauthorized,
+			},
+		},
+		{
+			name:       "responses with forbidden status if current password is wrong",
+			authCookie: generateAuthCookie(currentUser, t),
+			callErr:    auth.ErrInvalidCreds,
+			want: want{
+				code:        http.StatusForbidden,
+				response:    "\"invalid current password\"\n",
+				contentType: "application/json",
+			},
+		},
+		{
+			name:       "responses with bad request status if new password violates policy",
+			authCookie: generateAuthCookie(currentUser, t),
+			callErr: validation.ErrInvalidCredentials{
+				Violations: []validation.Violation{{Field: "password", Rule: "breached", Message: "password is known to be breached"}},
+			},
+			want: want{
+				code:        http.StatusBadRequest,
+				response:    "{\"errors\":[{\"field\":\"password\",\"rule\":\"breached\",\"message\":\"password is known to be breached\"}]}\n",
+				contentType: "application/json",
+			},
+		},
+		{
+			name:       "responses with internal server error status if an error occured",
+			authCookie: generateAuthCookie(currentUser, t),
+			callErr:    errors.New("db error"),
+			want: want{
+				code:        http.StatusInternalServerError,
+				response:    "\"db error\"\n",
+				contentType: "application/json",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			changeMockCall := changeSrv.
+				On("Call", mock.Anything, currentUser.ID, "old password", "new password").
+				Return(auth.TokenPair{AccessToken: "access", RefreshToken: "refresh"}, tc.callErr)
+			defer changeMockCall.Unset()
+
+			request, err := http.NewRequest(http.MethodPut, testServer.URL+"/api/user/password", strings.NewReader(reqBody))
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("Accept-Encoding", "identity")
+			request.AddCookie(tc.authCookie)
+
+			response, err := testServer.Client().Do(request)
+			require.NoError(t, err)
+			resBody, err := io.ReadAll(response.Body)
+			defer response.Body.Close()
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want.code, response.StatusCode)
+			assert.Equal(t, tc.want.response, string(resBody))
+			assert.Equal(t, tc.want.contentType, response.Header.Get("Content-Type"))
+		})
+	}
+}
+
+type passwordResetterMock struct{ mock.Mock }
+
+func (m *passwordResetterMock) Call(ctx context.Context, token, newPassword string) error {
+	args := m.Called(ctx, token, newPassword)
+	return args.Error(0)
+}
+
+func TestResetPasswordHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mocks.NewMockStorage(ctrl)
+	resetSrv := new(passwordResetterMock)
+
+	router := chi.NewRouter()
+	handlers := handlers.NewUserHandlers(storageMock)
+	router.Post("/api/user/password/reset/confirm", handlers.ResetPassword(resetSrv))
+	testServer := httptest.NewServer(router)
+	defer testServer.Close()
+
+	reqBody := marshalJSON(map[string]string{"token": "token", "new_password": "new password"}, t)
+	testCases := []struct {
+		name    string
+		callErr error
+		want    want
+	}{
+		{
+			name: "responses with ok status",
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+			},
+		},
+		{
+			name:    "responses with bad request status if token is invalid",
+			callErr: services.ErrInvalidResetToken,
+			want: want{
+				code:        http.StatusBadRequest,
+				response:    "\"invalid or expired password reset token\"\n",
+				contentType: "application/json",
+			},
+		},
+		{
+			name:    "responses with internal server error status if an error occured",
+			callErr: errors.New("db error"),
+			want: want{
+				code:        http.StatusInternalServerError,
+				response:    "\"db error\"\n",
+				contentType: "application/json",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resetMockCall := resetSrv.
+				On("Call", mock.Anything, "token", "new password").
+				Return(tc.callErr)
+			defer resetMockCall.Unset()
+
+			request, err := http.NewRequest(http.MethodPost, testServer.URL+"/api/user/password/reset/confirm", strings.NewReader(reqBody))
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("Accept-Encoding", "identity")
+
+			response, err := testServer.Client().Do(request)
+			require.NoError(t, err)
+			resBody, err := io.ReadAll(response.Body)
+			defer response.Body.Close()
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want.code, response.StatusCode)
+			assert.Equal(t, tc.want.response, string(resBody))
+			assert.Equal(t, tc.want.contentType, response.Header.Get("Content-Type"))
+		})
+	}
+}
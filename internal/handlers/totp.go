@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ilya-burinskiy/gophermart/internal/middlewares"
+	"github.com/ilya-burinskiy/gophermart/internal/services"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+)
+
+func (h UserHandlers) EnrollTOTP(enrollSrv services.TOTPEnroller) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+
+		userID, _ := middlewares.UserIDFromContext(r.Context())
+		enrollment, err := enrollSrv.Call(r.Context(), userID)
+		if err != nil {
+			var enabledErr storage.ErrTOTPAlreadyEnabled
+			if errors.As(err, &enabledErr) {
+				w.WriteHeader(http.StatusConflict)
+				encoder.Encode(err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			encoder.Encode(err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		encoder.Encode(enrollment)
+	}
+}
+
+func (h UserHandlers) ConfirmTOTP(confirmSrv services.TOTPConfirmer) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type payload struct {
+			Code string `json:"code"`
+		}
+		type response struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		var requestBody payload
+		decoder := json.NewDecoder(r.Body)
+		encoder := json.NewEncoder(w)
+
+		err := decoder.Decode(&requestBody)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			encoder.Encode("invalid request body")
+			return
+		}
+
+		userID, _ := middlewares.UserIDFromContext(r.Context())
+		codes, err := confirmSrv.Call(r.Context(), userID, requestBody.Code)
+		if err != nil {
+			var enabledErr storage.ErrTOTPAlreadyEnabled
+			if errors.As(err, &enabledErr) {
+				w.WriteHeader(http.StatusConflict)
+				encoder.Encode(err.Error())
+				return
+			}
+			if errors.Is(err, services.ErrInvalidOTP) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				encoder.Encode(err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			encoder.Encode(err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		encoder.Encode(response{RecoveryCodes: codes})
+	}
+}
@@ -3,12 +3,17 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/ilya-burinskiy/gophermart/internal/auth"
+	"github.com/ilya-burinskiy/gophermart/internal/configs"
 	"github.com/ilya-burinskiy/gophermart/internal/services"
 	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
 )
 
 type UserHandlers struct {
@@ -37,9 +42,15 @@ func (h UserHandlers) Register(registerSrv services.UserRegistrator) func(http.R
 			return
 		}
 
-		jwtStr, err := registerSrv.Call(r.Context(), requestBody.Login, requestBody.Password)
+		tokens, err := registerSrv.Call(r.Context(), requestBody.Login, requestBody.Password)
 		if err != nil {
 			var notUniqErr storage.ErrUserNotUniq
+			var invalidErr validation.ErrInvalidCredentials
+			if errors.As(err, &invalidErr) {
+				w.WriteHeader(http.StatusBadRequest)
+				encoder.Encode(map[string][]validation.Violation{"errors": invalidErr.Violations})
+				return
+			}
 			if errors.As(err, &notUniqErr) {
 				w.WriteHeader((http.StatusConflict))
 				encoder.Encode(err.Error())
@@ -50,8 +61,7 @@ func (h UserHandlers) Register(registerSrv services.UserRegistrator) func(http.R
 			return
 		}
 
-		auth.SetJWTCookie(w, jwtStr)
-		w.WriteHeader(http.StatusOK)
+		writeSession(w, r, tokens)
 	}
 }
 
@@ -60,6 +70,7 @@ func (h UserHandlers) Authenticate(authSrv services.UserAuthenticator) func(http
 		type payload struct {
 			Login    string `json:"login"`
 			Password string `json:"password"`
+			OTP      string `json:"otp"`
 		}
 		w.Header().Set("Content-Type", "application/json")
 		var requestBody payload
@@ -73,11 +84,57 @@ func (h UserHandlers) Authenticate(authSrv services.UserAuthenticator) func(http
 			return
 		}
 
-		jwtStr, err := authSrv.Call(r.Context(), requestBody.Login, requestBody.Password)
+		tokens, err := authSrv.Call(
+			r.Context(),
+			requestBody.Login,
+			requestBody.Password,
+			requestBody.OTP,
+			clientIP(r),
+		)
 		if err != nil {
 			var notFoundErr storage.ErrUserNotFound
-			fmt.Println(err.Error())
+			var lockedErr services.ErrLoginLocked
 			if errors.Is(err, auth.ErrInvalidCreds) || errors.As(err, &notFoundErr) {
+				w.WriteHeader(http.StatusUnauthorized)
+				encoder.Encode(auth.ErrInvalidCreds.Error())
+				return
+			}
+			if errors.Is(err, services.ErrOTPRequired) || errors.Is(err, services.ErrInvalidOTP) {
+				w.WriteHeader(http.StatusUnauthorized)
+				encoder.Encode(err.Error())
+				return
+			}
+			if errors.As(err, &lockedErr) {
+				writeRetryAfter(w, lockedErr.RetryAfter)
+				w.WriteHeader(http.StatusTooManyRequests)
+				encoder.Encode("too many failed login attempts")
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			encoder.Encode(err.Error())
+			return
+		}
+
+		writeSession(w, r, tokens)
+	}
+}
+
+func (h UserHandlers) Refresh(refreshSrv services.TokenRefresher) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+
+		refreshToken, ok := requestRefreshToken(r)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			encoder.Encode(auth.ErrInvalidRefreshToken.Error())
+			return
+		}
+
+		tokens, err := refreshSrv.Call(r.Context(), refreshToken)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+				auth.ClearSessionCookies(w)
 				w.WriteHeader(http.StatusUnauthorized)
 				encoder.Encode(err.Error())
 				return
@@ -87,7 +144,80 @@ func (h UserHandlers) Authenticate(authSrv services.UserAuthenticator) func(http
 			return
 		}
 
-		auth.SetJWTCookie(w, jwtStr)
+		writeSession(w, r, tokens)
+	}
+}
+
+func (h UserHandlers) Logout(logoutSrv services.SessionTerminator) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+
+		if refreshToken, ok := requestRefreshToken(r); ok {
+			err := logoutSrv.Call(r.Context(), refreshToken)
+			if err != nil && !errors.Is(err, auth.ErrInvalidRefreshToken) {
+				w.WriteHeader(http.StatusInternalServerError)
+				encoder.Encode(err.Error())
+				return
+			}
+		}
+
+		auth.ClearSessionCookies(w)
 		w.WriteHeader(http.StatusOK)
 	}
 }
+
+// writeSession always sets the session cookies for browsers and, when the
+// client asks for it with ?return_token=true, also returns the tokens in the
+// body for clients that send them in the Authorization header instead
+func writeSession(w http.ResponseWriter, r *http.Request, tokens auth.TokenPair) {
+	type response struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+
+	auth.SetSessionCookies(w, tokens)
+	w.WriteHeader(http.StatusOK)
+	if r.URL.Query().Get("return_token") != "true" {
+		return
+	}
+
+	json.NewEncoder(w).Encode(response{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(configs.AuthTokenExp / time.Second),
+	})
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func requestRefreshToken(r *http.Request) (string, bool) {
+	type payload struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if cookie, err := r.Cookie(auth.RefreshTokenCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, true
+	}
+
+	var requestBody payload
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.RefreshToken == "" {
+		return "", false
+	}
+
+	return requestBody.RefreshToken, true
+}
+
+func writeRetryAfter(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+}
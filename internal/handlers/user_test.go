@@ -6,16 +6,21 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/golang/mock/gomock"
 	"github.com/ilya-burinskiy/gophermart/internal/auth"
 	"github.com/ilya-burinskiy/gophermart/internal/handlers"
+	"github.com/ilya-burinskiy/gophermart/internal/middlewares"
 	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/services"
 	"github.com/ilya-burinskiy/gophermart/internal/storage"
 	"github.com/ilya-burinskiy/gophermart/internal/storage/mocks"
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -23,13 +28,13 @@ import (
 
 type userRegistratorMock struct{ mock.Mock }
 
-func (m *userRegistratorMock) Call(ctx context.Context, login, password string) (string, error) {
+func (m *userRegistratorMock) Call(ctx context.Context, login, password string) (auth.TokenPair, error) {
 	args := m.Called(ctx, login, password)
-	return args.String(0), args.Error(1)
+	return args.Get(0).(auth.TokenPair), args.Error(1)
 }
 
 type userRegistratorCallResult struct {
-	returnValue string
+	returnValue auth.TokenPair
 	err         error
 }
 
@@ -78,6 +83,25 @@ func TestRegisterHandler(t *testing.T) {
 				contentType: "application/json",
 			},
 		},
+		{
+			name:        "responses with bad request status if credentials violate policy",
+			httpMethod:  http.MethodPost,
+			path:        "/api/user/register",
+			reqBody:     marshalJSON(map[string]string{"login": "", "password": ""}, t),
+			contentType: "application/json",
+			userRegistratorCallResult: userRegistratorCallResult{
+				err: validation.ErrInvalidCredentials{
+					Violations: []validation.Violation{
+						{Field: "login", Rule: "length", Message: "login length must be between 3 and 255"},
+					},
+				},
+			},
+			want: want{
+				code:        http.StatusBadRequest,
+				response:    "{\"errors\":[{\"field\":\"login\",\"rule\":\"length\",\"message\":\"login length must be between 3 and 255\"}]}\n",
+				contentType: "application/json",
+			},
+		},
 		{
 			name:        "responses with conflict status if user already registered",
 			httpMethod:  http.MethodPost,
@@ -144,13 +168,13 @@ func TestRegisterHandler(t *testing.T) {
 
 type userAuthenticatorMock struct{ mock.Mock }
 
-func (m *userAuthenticatorMock) Call(ctx context.Context, login, password string) (string, error) {
-	args := m.Called(ctx, login, password)
-	return args.String(0), args.Error(1)
+func (m *userAuthenticatorMock) Call(ctx context.Context, login, password, otp, ip string) (auth.TokenPair, error) {
+	args := m.Called(ctx, login, password, otp, ip)
+	return args.Get(0).(auth.TokenPair), args.Error(1)
 }
 
 type userAuthenticatorCallResult struct {
-	returnValue string
+	returnValue auth.TokenPair
 	err         error
 }
 
@@ -193,6 +217,27 @@ func TestAuthenticateHandler(t *testing.T) {
 				contentType: "application/json",
 			},
 		},
+		{
+			name:       "responses with tokens in body if requested",
+			httpMethod: http.MethodPost,
+			path:       "/api/user/login?return_token=true",
+			reqBody: marshalJSON(
+				map[string]string{
+					"login":    "login",
+					"password": "password",
+				},
+				t,
+			),
+			contentType: "application/json",
+			userAuthenticatorCallResult: userAuthenticatorCallResult{
+				returnValue: auth.TokenPair{AccessToken: "access", RefreshToken: "refresh"},
+			},
+			want: want{
+				code:        http.StatusOK,
+				response:    "{\"access_token\":\"access\",\"refresh_token\":\"refresh\",\"token_type\":\"Bearer\",\"expires_in\":900}\n",
+				contentType: "application/json",
+			},
+		},
 		{
 			name:        "responses with bad request status if could not parse json body",
 			httpMethod:  http.MethodPost,
@@ -225,7 +270,7 @@ func TestAuthenticateHandler(t *testing.T) {
 			},
 			want: want{
 				code:        http.StatusUnauthorized,
-				response:    "\"failed to authenticate user: user with login \\\"login\\\" not found\"\n",
+				response:    "\"invalid login or password\"\n",
 				contentType: "application/json",
 			},
 		},
@@ -249,7 +294,49 @@ func TestAuthenticateHandler(t *testing.T) {
 			},
 			want: want{
 				code:        http.StatusUnauthorized,
-				response:    "\"failed to authenticate user: invalid login or password\"\n",
+				response:    "\"invalid login or password\"\n",
+				contentType: "application/json",
+			},
+		},
+		{
+			name:       "responses with not authorized status if one-time password is required",
+			httpMethod: http.MethodPost,
+			path:       "/api/user/login",
+			reqBody: marshalJSON(
+				map[string]string{
+					"login":    "login",
+					"password": "password",
+				},
+				t,
+			),
+			contentType: "application/json",
+			userAuthenticatorCallResult: userAuthenticatorCallResult{
+				err: services.ErrOTPRequired,
+			},
+			want: want{
+				code:        http.StatusUnauthorized,
+				response:    "\"one-time password is required\"\n",
+				contentType: "application/json",
+			},
+		},
+		{
+			name:       "responses with too many requests status if login is locked",
+			httpMethod: http.MethodPost,
+			path:       "/api/user/login",
+			reqBody: marshalJSON(
+				map[string]string{
+					"login":    "login",
+					"password": "password",
+				},
+				t,
+			),
+			contentType: "application/json",
+			userAuthenticatorCallResult: userAuthenticatorCallResult{
+				err: services.ErrLoginLocked{RetryAfter: 1500 * time.Millisecond},
+			},
+			want: want{
+				code:        http.StatusTooManyRequests,
+				response:    "\"too many failed login attempts\"\n",
 				contentType: "application/json",
 			},
 		},
@@ -279,7 +366,7 @@ func TestAuthenticateHandler(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			authenticateMockCall := userAuthenticatorMock.
-				On("Call", mock.Anything, mock.Anything, mock.Anything).
+				On("Call", mock.Anything, mock.Anything, mock.Anything, mock.Anything, "127.0.0.1").
 				Return(
 					tc.userAuthenticatorCallResult.returnValue,
 					tc.userAuthenticatorCallResult.err,
@@ -307,3 +394,260 @@ func TestAuthenticateHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthenticateHandlerBehindProxy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mocks.NewMockStorage(ctrl)
+	userAuthenticatorMock := new(userAuthenticatorMock)
+
+	router := chi.NewRouter()
+	handlers := handlers.NewUserHandlers(storageMock)
+	router.Use(middlewares.RealIP([]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}))
+	router.Post("/api/user/login", handlers.Authenticate(userAuthenticatorMock))
+	testServer := httptest.NewServer(router)
+	defer testServer.Close()
+
+	// the first client is locked out, the second one comes through the same
+	// proxy but is throttled on its own address
+	userAuthenticatorMock.
+		On("Call", mock.Anything, mock.Anything, mock.Anything, mock.Anything, "203.0.113.1").
+		Return(auth.TokenPair{}, services.ErrLoginLocked{RetryAfter: time.Minute})
+	userAuthenticatorMock.
+		On("Call", mock.Anything, mock.Anything, mock.Anything, mock.Anything, "203.0.113.2").
+		Return(auth.TokenPair{}, nil)
+
+	testCases := []struct {
+		clientIP string
+		wantCode int
+	}{
+		{clientIP: "203.0.113.1", wantCode: http.StatusTooManyRequests},
+		{clientIP: "203.0.113.2", wantCode: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		request, err := http.NewRequest(
+			http.MethodPost,
+			testServer.URL+"/api/user/login",
+			strings.NewReader(`{"login":"login","password":"password"}`),
+		)
+		require.NoError(t, err)
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("X-Forwarded-For", tc.clientIP)
+
+		response, err := testServer.Client().Do(request)
+		require.NoError(t, err)
+		response.Body.Close()
+
+		assert.Equal(t, tc.wantCode, response.StatusCode, tc.clientIP)
+	}
+}
+
+type tokenRefresherMock struct{ mock.Mock }
+
+func (m *tokenRefresherMock) Call(ctx context.Context, refreshToken string) (auth.TokenPair, error) {
+	args := m.Called(ctx, refreshToken)
+	return args.Get(0).(auth.TokenPair), args.Error(1)
+}
+
+type tokenRefresherCallResult struct {
+	returnValue auth.TokenPair
+	err         error
+}
+
+func TestRefreshHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mocks.NewMockStorage(ctrl)
+	tokenRefresherMock := new(tokenRefresherMock)
+
+	router := chi.NewRouter()
+	handlers := handlers.NewUserHandlers(storageMock)
+	router.Post("/api/user/token/refresh", handlers.Refresh(tokenRefresherMock))
+
+	testServer := httptest.NewServer(router)
+	defer testServer.Close()
+
+	testCases := []struct {
+		name                     string
+		refreshCookie            *http.Cookie
+		tokenRefresherCallResult tokenRefresherCallResult
+		wantCookies              map[string]string
+		want                     want
+	}{
+		{
+			name:          "responses with ok status and rotates tokens",
+			refreshCookie: &http.Cookie{Name: auth.RefreshTokenCookie, Value: "old"},
+			tokenRefresherCallResult: tokenRefresherCallResult{
+				returnValue: auth.TokenPair{AccessToken: "access", RefreshToken: "new"},
+			},
+			wantCookies: map[string]string{"jwt": "access", auth.RefreshTokenCookie: "new"},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+			},
+		},
+		{
+			name: "responses with unauthorized status if refresh token is missing",
+			want: want{
+				code:        http.StatusUnauthorized,
+				response:    "\"invalid refresh token\"\n",
+				contentType: "application/json",
+			},
+		},
+		{
+			name:          "responses with unauthorized status if refresh token is reused",
+			refreshCookie: &http.Cookie{Name: auth.RefreshTokenCookie, Value: "old"},
+			tokenRefresherCallResult: tokenRefresherCallResult{
+				err: fmt.Errorf("failed to refresh token: %w", auth.ErrRefreshTokenReused),
+			},
+			wantCookies: map[string]string{"jwt": "", auth.RefreshTokenCookie: ""},
+			want: want{
+				code:        http.StatusUnauthorized,
+				response:    "\"failed to refresh token: refresh token has already been used\"\n",
+				contentType: "application/json",
+			},
+		},
+		{
+			name:          "responses with internal server error status if an error occured",
+			refreshCookie: &http.Cookie{Name: auth.RefreshTokenCookie, Value: "old"},
+			tokenRefresherCallResult: tokenRefresherCallResult{
+				err: fmt.Errorf("failed to refresh token: db error"),
+			},
+			want: want{
+				code:        http.StatusInternalServerError,
+				response:    "\"failed to refresh token: db error\"\n",
+				contentType: "application/json",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			refreshMockCall := tokenRefresherMock.
+				On("Call", mock.Anything, mock.Anything).
+				Return(
+					tc.tokenRefresherCallResult.returnValue,
+					tc.tokenRefresherCallResult.err,
+				)
+			defer refreshMockCall.Unset()
+
+			request, err := http.NewRequest(http.MethodPost, testServer.URL+"/api/user/token/refresh", nil)
+			require.NoError(t, err)
+			request.Header.Set("Accept-Encoding", "identity")
+			if tc.refreshCookie != nil {
+				request.AddCookie(tc.refreshCookie)
+			}
+
+			response, err := testServer.Client().Do(request)
+			require.NoError(t, err)
+			resBody, err := io.ReadAll(response.Body)
+			defer response.Body.Close()
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want.code, response.StatusCode)
+			assert.Equal(t, tc.want.response, string(resBody))
+			assert.Equal(t, tc.want.contentType, response.Header.Get("Content-Type"))
+			cookies := make(map[string]string)
+			for _, cookie := range response.Cookies() {
+				cookies[cookie.Name] = cookie.Value
+			}
+			for name, value := range tc.wantCookies {
+				assert.Contains(t, cookies, name)
+				assert.Equal(t, value, cookies[name])
+			}
+		})
+	}
+}
+
+type sessionTerminatorMock struct{ mock.Mock }
+
+func (m *sessionTerminatorMock) Call(ctx context.Context, refreshToken string) error {
+	args := m.Called(ctx, refreshToken)
+	return args.Error(0)
+}
+
+func TestLogoutHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mocks.NewMockStorage(ctrl)
+	sessionTerminatorMock := new(sessionTerminatorMock)
+
+	router := chi.NewRouter()
+	handlers := handlers.NewUserHandlers(storageMock)
+	router.Post("/api/user/logout", handlers.Logout(sessionTerminatorMock))
+
+	testServer := httptest.NewServer(router)
+	defer testServer.Close()
+
+	testCases := []struct {
+		name          string
+		refreshCookie *http.Cookie
+		callErr       error
+		wantCall      bool
+		want          want
+	}{
+		{
+			name:          "responses with ok status and revokes session",
+			refreshCookie: &http.Cookie{Name: auth.RefreshTokenCookie, Value: "token"},
+			wantCall:      true,
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+			},
+		},
+		{
+			name: "responses with ok status if there is no session",
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+			},
+		},
+		{
+			name:          "responses with ok status if refresh token is unknown",
+			refreshCookie: &http.Cookie{Name: auth.RefreshTokenCookie, Value: "token"},
+			callErr:       fmt.Errorf("failed to log out: %w", auth.ErrInvalidRefreshToken),
+			wantCall:      true,
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+			},
+		},
+		{
+			name:          "responses with internal server error status if an error occured",
+			refreshCookie: &http.Cookie{Name: auth.RefreshTokenCookie, Value: "token"},
+			callErr:       fmt.Errorf("failed to log out: db error"),
+			wantCall:      true,
+			want: want{
+				code:        http.StatusInternalServerError,
+				response:    "\"failed to log out: db error\"\n",
+				contentType: "application/json",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logoutMockCall := sessionTerminatorMock.
+				On("Call", mock.Anything, "token").
+				Return(tc.callErr)
+			defer logoutMockCall.Unset()
+
+			request, err := http.NewRequest(http.MethodPost, testServer.URL+"/api/user/logout", nil)
+			require.NoError(t, err)
+			request.Header.Set("Accept-Encoding", "identity")
+			if tc.refreshCookie != nil {
+				request.AddCookie(tc.refreshCookie)
+			}
+
+			response, err := testServer.Client().Do(request)
+			require.NoError(t, err)
+			resBody, err := io.ReadAll(response.Body)
+			defer response.Body.Close()
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want.code, response.StatusCode)
+			assert.Equal(t, tc.want.response, string(resBody))
+			assert.Equal(t, tc.want.contentType, response.Header.Get("Content-Type"))
+			if tc.wantCall {
+				sessionTerminatorMock.AssertCalled(t, "Call", mock.Anything, "token")
+			}
+		})
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"net/http"
 
 	"github.com/ilya-burinskiy/gophermart/internal/middlewares"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
 	"github.com/ilya-burinskiy/gophermart/internal/services"
 	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
 )
 
 type WithdrawalHandlers struct {
@@ -21,8 +23,9 @@ func NewWithdrawalHanlers(store storage.Storage) WithdrawalHandlers {
 func (wh WithdrawalHandlers) Create(createSrv services.WithdrawalCreator) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		type payload struct {
-			Order string `json:"order"`
-			Sum   int    `json:"sum"`
+			Order string       `json:"order"`
+			Sum   models.Money `json:"sum"`
+			OTP   string       `json:"otp"`
 		}
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		decoder := json.NewDecoder(r.Body)
@@ -34,12 +37,27 @@ func (wh WithdrawalHandlers) Create(createSrv services.WithdrawalCreator) func(h
 		}
 
 		userID, _ := middlewares.UserIDFromContext(r.Context())
-		_, err = createSrv.Call(r.Context(), userID, requestBody.Order, requestBody.Sum)
+		_, err = createSrv.Call(r.Context(), userID, requestBody.Order, requestBody.Sum, requestBody.OTP)
 		if err != nil {
 			if errors.Is(err, services.ErrNotEnoughAmount) {
 				w.WriteHeader(http.StatusPaymentRequired)
 				return
 			}
+			if errors.Is(err, services.ErrOTPRequired) || errors.Is(err, services.ErrInvalidOTP) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			var lockedErr services.ErrStepUpLocked
+			if errors.As(err, &lockedErr) {
+				writeRetryAfter(w, lockedErr.RetryAfter)
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			var invalidNumberErr validation.ErrInvalidOrderNumber
+			if errors.Is(err, services.ErrInvalidSum) || errors.As(err, &invalidNumberErr) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			}
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
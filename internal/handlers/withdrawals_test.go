@@ -17,6 +17,7 @@ import (
 	"github.com/ilya-burinskiy/gophermart/internal/models"
 	"github.com/ilya-burinskiy/gophermart/internal/services"
 	"github.com/ilya-burinskiy/gophermart/internal/storage/mocks"
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -24,8 +25,8 @@ import (
 
 type withdrawalCreatorMock struct{ mock.Mock }
 
-func (m *withdrawalCreatorMock) Call(ctx context.Context, userID int, orderNumber string, sum int) (models.Withdrawal, error) {
-	args := m.Called(ctx, userID, orderNumber, sum)
+func (m *withdrawalCreatorMock) Call(ctx context.Context, userID int, orderNumber string, sum models.Money, otp string) (models.Withdrawal, error) {
+	args := m.Called(ctx, userID, orderNumber, sum, otp)
 	return args.Get(0).(models.Withdrawal), args.Error(1)
 }
 
@@ -36,8 +37,8 @@ type withdrawalCreatorCallResult struct {
 
 func TestCreateWithdrawalHandler(t *testing.T) {
 	type requestBody struct {
-		Order string `json:"order"`
-		Sum   int    `json:"sum"`
+		Order string       `json:"order"`
+		Sum   models.Money `json:"sum"`
 	}
 	ctrl := gomock.NewController(t)
 	storageMock := mocks.NewMockStorage(ctrl)
@@ -45,7 +46,7 @@ func TestCreateWithdrawalHandler(t *testing.T) {
 	router := chi.NewRouter()
 	handlers := handlers.NewWithdrawalHanlers(storageMock)
 	withdrawalCreatorMock := new(withdrawalCreatorMock)
-	router.Use(middlewares.Authenticate)
+	router.Use(middlewares.Authenticate(testKeys, nil))
 	router.Post("/api/user/balance/withdraw", handlers.Create(withdrawalCreatorMock))
 	testServer := httptest.NewServer(router)
 	defer testServer.Close()
@@ -108,6 +109,66 @@ func TestCreateWithdrawalHandler(t *testing.T) {
 				contentType: "application/json; charset=utf-8",
 			},
 		},
+		{
+			name:        "responses with unprocessable entity status if sum is not positive",
+			httpMethod:  http.MethodPost,
+			path:        "/api/user/balance/withdraw",
+			reqBody:     marshalJSON(requestBody{Order: "12345", Sum: -100}, t),
+			authCookie:  currentUserAuthCookie,
+			contentType: "application/json",
+			withdrawalCreatorCallResult: withdrawalCreatorCallResult{
+				err: services.ErrInvalidSum,
+			},
+			want: want{
+				code:        http.StatusUnprocessableEntity,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:        "responses with unprocessable entity status if order number is invalid",
+			httpMethod:  http.MethodPost,
+			path:        "/api/user/balance/withdraw",
+			reqBody:     marshalJSON(requestBody{Order: "12345", Sum: 100}, t),
+			authCookie:  currentUserAuthCookie,
+			contentType: "application/json",
+			withdrawalCreatorCallResult: withdrawalCreatorCallResult{
+				err: validation.ErrInvalidOrderNumber{Number: "12345", Reason: "checksum mismatch"},
+			},
+			want: want{
+				code:        http.StatusUnprocessableEntity,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:        "responses with forbidden status if one-time password is required",
+			httpMethod:  http.MethodPost,
+			path:        "/api/user/balance/withdraw",
+			reqBody:     marshalJSON(requestBody{Order: "12345", Sum: 100}, t),
+			authCookie:  currentUserAuthCookie,
+			contentType: "application/json",
+			withdrawalCreatorCallResult: withdrawalCreatorCallResult{
+				err: services.ErrOTPRequired,
+			},
+			want: want{
+				code:        http.StatusForbidden,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
+		{
+			name:        "responses with too many requests status if step-up is locked",
+			httpMethod:  http.MethodPost,
+			path:        "/api/user/balance/withdraw",
+			reqBody:     marshalJSON(requestBody{Order: "12345", Sum: 100}, t),
+			authCookie:  currentUserAuthCookie,
+			contentType: "application/json",
+			withdrawalCreatorCallResult: withdrawalCreatorCallResult{
+				err: services.ErrStepUpLocked{RetryAfter: time.Minute},
+			},
+			want: want{
+				code:        http.StatusTooManyRequests,
+				contentType: "application/json; charset=utf-8",
+			},
+		},
 		{
 			name:        "responses with internal server error",
 			httpMethod:  http.MethodPost,
@@ -124,7 +185,7 @@ func TestCreateWithdrawalHandler(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			withdrawalCreatorMockCall := withdrawalCreatorMock.
-				On("Call", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+				On("Call", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 				Return(
 					tc.withdrawalCreatorCallResult.returnValue,
 					tc.withdrawalCreatorCallResult.err,
@@ -173,7 +234,7 @@ func TestGetWithdrawalsHandlers(t *testing.T) {
 	router := chi.NewRouter()
 	handlers := handlers.NewWithdrawalHanlers(storageMock)
 	fetchSrv := new(fetchWithdrawalsMock)
-	router.Use(middlewares.Authenticate)
+	router.Use(middlewares.Authenticate(testKeys, nil))
 	router.Get("/api/user/withdrawals", handlers.Get(fetchSrv))
 	testServer := httptest.NewServer(router)
 	defer testServer.Close()
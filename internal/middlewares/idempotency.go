@@ -0,0 +1,135 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"go.uber.org/zap"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+type IdempotencyStore interface {
+	ClaimIdempotencyKey(ctx context.Context, record models.IdempotencyKey, ttl time.Duration) (models.IdempotencyKey, bool, error)
+	SaveIdempotentResponse(ctx context.Context, record models.IdempotencyKey) error
+	ReleaseIdempotencyKey(ctx context.Context, userID int, key string) error
+}
+
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) Write(bytes []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(bytes)
+
+	return rw.ResponseWriter.Write(bytes)
+}
+
+func (rw *recordingResponseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+// Idempotent replays the stored response to requests retried with the same
+// Idempotency-Key header and body. Keys are scoped to the authenticated user
+// and expire after ttl; server errors are not stored so that such requests
+// can be retried
+func Idempotent(store IdempotencyStore, ttl time.Duration, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+			userID, ok := UserIDFromContext(r.Context())
+			if !ok {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			record := models.IdempotencyKey{UserID: userID, Key: key, RequestHash: requestHash(r, body)}
+			existing, claimed, err := store.ClaimIdempotencyKey(r.Context(), record, ttl)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if !claimed {
+				replay(w, record, existing)
+				return
+			}
+
+			rw := recordingResponseWriter{ResponseWriter: w}
+			defer func() {
+				// the outcome must be stored even if the client has gone away
+				ctx := context.Background()
+				if rw.status == 0 || rw.status >= http.StatusInternalServerError {
+					if err := store.ReleaseIdempotencyKey(ctx, userID, key); err != nil {
+						logger.Error("failed to release idempotency key", zap.Error(err))
+					}
+					return
+				}
+
+				record.StatusCode = rw.status
+				record.ContentType = rw.Header().Get("Content-Type")
+				record.Body = rw.body.Bytes()
+				if err := store.SaveIdempotentResponse(ctx, record); err != nil {
+					logger.Error("failed to save idempotent response", zap.Error(err))
+				}
+			}()
+			h.ServeHTTP(&rw, r)
+		})
+	}
+}
+
+func replay(w http.ResponseWriter, record, existing models.IdempotencyKey) {
+	switch {
+	case existing.RequestHash != record.RequestHash:
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	case existing.StatusCode == 0:
+		w.WriteHeader(http.StatusConflict)
+	default:
+		if existing.ContentType != "" {
+			w.Header().Set("Content-Type", existing.ContentType)
+		}
+		w.Header().Set(IdempotentReplayedHeader, "true")
+		w.WriteHeader(existing.StatusCode)
+		w.Write(existing.Body)
+	}
+}
+
+func requestHash(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.Path+"\n")
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,125 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ilya-burinskiy/gophermart/internal/auth"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type idempotencyStoreStub struct {
+	mu      sync.Mutex
+	records map[string]models.IdempotencyKey
+}
+
+func (s *idempotencyStoreStub) ClaimIdempotencyKey(
+	ctx context.Context,
+	record models.IdempotencyKey,
+	ttl time.Duration) (models.IdempotencyKey, bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.records[record.Key]; ok {
+		return existing, false, nil
+	}
+	s.records[record.Key] = record
+
+	return record, true, nil
+}
+
+func (s *idempotencyStoreStub) SaveIdempotentResponse(ctx context.Context, record models.IdempotencyKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[record.Key] = record
+
+	return nil
+}
+
+func (s *idempotencyStoreStub) ReleaseIdempotencyKey(ctx context.Context, userID int, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+
+	return nil
+}
+
+func TestIdempotent(t *testing.T) {
+	keys, err := auth.NewKeySet(auth.NewHMACKey("test", []byte("secret")))
+	require.NoError(t, err)
+	token, err := keys.BuildJWTString(models.User{ID: 7})
+	require.NoError(t, err)
+
+	store := &idempotencyStoreStub{records: make(map[string]models.IdempotencyKey)}
+	calls := 0
+	status := http.StatusOK
+	handler := Authenticate(keys, nil)(Idempotent(store, time.Hour, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"call":` + strconv.Itoa(calls) + `}`))
+	})))
+	do := func(key, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer "+token)
+		if key != "" {
+			request.Header.Set(IdempotencyKeyHeader, key)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	t.Run("replays first response to identical retry", func(t *testing.T) {
+		first := do("key-1", `{"sum":10}`)
+		retry := do("key-1", `{"sum":10}`)
+
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, http.StatusOK, retry.Code)
+		assert.Equal(t, first.Body.String(), retry.Body.String())
+		assert.Equal(t, "application/json", retry.Header().Get("Content-Type"))
+		assert.Equal(t, "true", retry.Header().Get(IdempotentReplayedHeader))
+	})
+
+	t.Run("rejects key reused with different body", func(t *testing.T) {
+		recorder := do("key-1", `{"sum":20}`)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("rejects retry while first request is in progress", func(t *testing.T) {
+		store.records["key-2"] = models.IdempotencyKey{UserID: 7, Key: "key-2", RequestHash: store.records["key-1"].RequestHash}
+
+		recorder := do("key-2", `{"sum":10}`)
+
+		assert.Equal(t, http.StatusConflict, recorder.Code)
+	})
+
+	t.Run("does not store server errors", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		do("key-3", `{"sum":10}`)
+		status = http.StatusOK
+		recorder := do("key-3", `{"sum":10}`)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Empty(t, recorder.Header().Get(IdempotentReplayedHeader))
+	})
+
+	t.Run("passes requests without key through", func(t *testing.T) {
+		before := calls
+		do("", `{"sum":10}`)
+		do("", `{"sum":10}`)
+
+		assert.Equal(t, before+2, calls)
+	})
+}
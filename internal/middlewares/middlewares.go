@@ -2,14 +2,16 @@ package middlewares
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"net/netip"
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/ilya-burinskiy/gophermart/internal/auth"
 	"github.com/ilya-burinskiy/gophermart/internal/compress"
-	"github.com/ilya-burinskiy/gophermart/internal/configs"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
 	"go.uber.org/zap"
 )
 
@@ -21,7 +23,16 @@ type loggingResponseWriter struct {
 
 type contextKey string
 
-const userIDKey contextKey = "user_id"
+const (
+	userIDKey contextKey = "user_id"
+	apiKeyKey contextKey = "api_key"
+)
+
+// APIKeyVerifier resolves a personal API key to the key record with its
+// owner and scopes
+type APIKeyVerifier interface {
+	Call(ctx context.Context, key string) (models.APIKey, error)
+}
 
 func (lw *loggingResponseWriter) Write(bytes []byte) (int, error) {
 	size, err := lw.ResponseWriter.Write(bytes)
@@ -88,29 +99,172 @@ func GzipCompress(h http.Handler) http.Handler {
 	})
 }
 
-func Authenticate(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("jwt")
-		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
+// Authenticate accepts a JWT access token or, unless apiKeys is nil, a
+// personal API key; API key requests are limited to the key's scopes
+func Authenticate(keys auth.KeySet, apiKeys APIKeyVerifier) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := accessToken(r)
+			if !ok {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
 
-		claims := &auth.Claims{}
-		token, err := jwt.ParseWithClaims(cookie.Value, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(configs.SecretKey), nil
+			if auth.IsAPIKey(token) {
+				if apiKeys == nil {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				apiKey, err := apiKeys.Call(r.Context(), token)
+				if err != nil {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), userIDKey, apiKey.UserID)
+				ctx = context.WithValue(ctx, apiKeyKey, apiKey)
+				h.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			claims, err := keys.ParseJWTString(token)
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userIDKey, claims.UserID)
+			h.ServeHTTP(w, r.WithContext(ctx))
 		})
-		if err != nil || !token.Valid {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
+	}
+}
+
+func accessToken(r *http.Request) (string, bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		token = strings.TrimSpace(token)
+		if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return "", false
 		}
+		return token, true
+	}
 
-		ctx := context.WithValue(r.Context(), userIDKey, claims.UserID)
-		h.ServeHTTP(w, r.WithContext(ctx))
-	})
+	cookie, err := r.Cookie("jwt")
+	if err != nil {
+		return "", false
+	}
+
+	return cookie.Value, true
+}
+
+type UserFinder interface {
+	FindUserByID(ctx context.Context, userID int) (models.User, error)
+}
+
+// RequireRole looks the authenticated user up on every request, so that
+// a revoked role takes effect without waiting for the access token to expire
+func RequireRole(users UserFinder, role models.UserRole) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := UserIDFromContext(r.Context())
+			if !ok {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			user, err := users.FindUserByID(r.Context(), userID)
+			var notFoundErr storage.ErrUserNotFound
+			if err != nil && !errors.As(err, &notFoundErr) {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if err != nil || user.Role != role {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScope rejects API key requests lacking scope, session requests
+// are not restricted
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey, ok := APIKeyFromContext(r.Context())
+			if ok && !apiKey.HasScope(scope) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
 }
 
 func UserIDFromContext(ctx context.Context) (int, bool) {
 	userID, ok := ctx.Value(userIDKey).(int)
 	return userID, ok
 }
+
+func APIKeyFromContext(ctx context.Context) (models.APIKey, bool) {
+	apiKey, ok := ctx.Value(apiKeyKey).(models.APIKey)
+	return apiKey, ok
+}
+
+// RealIP replaces the remote address of requests coming through one of the
+// trusted proxies with the client address the proxy forwards, so that per-IP
+// login throttling does not lump all clients of the proxy together.
+// Forwarding headers from other peers are ignored, anyone could forge them
+func RealIP(trustedProxies []netip.Prefix) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip, ok := forwardedClientIP(r, trustedProxies); ok {
+				r.RemoteAddr = ip
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedClientIP takes the rightmost X-Forwarded-For address that is not
+// a trusted proxy, the ones to the left of it are set by the client
+func forwardedClientIP(r *http.Request, trustedProxies []netip.Prefix) (string, bool) {
+	isTrusted := func(addr netip.Addr) bool {
+		for _, prefix := range trustedProxies {
+			if prefix.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil || !isTrusted(peer.Addr()) {
+		return "", false
+	}
+
+	forwardedFor := strings.Join(r.Header.Values("X-Forwarded-For"), ",")
+	if strings.TrimSpace(forwardedFor) == "" {
+		addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+		if err != nil {
+			return "", false
+		}
+		return addr.Unmap().String(), true
+	}
+
+	hops := strings.Split(forwardedFor, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return "", false
+		}
+		if !isTrusted(addr) {
+			return addr.Unmap().String(), true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,230 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/ilya-burinskiy/gophermart/internal/auth"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	keys, err := auth.NewKeySet(auth.NewHMACKey("test", []byte("secret")))
+	require.NoError(t, err)
+	token, err := keys.BuildJWTString(models.User{ID: 7})
+	require.NoError(t, err)
+
+	handler := Authenticate(keys, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := UserIDFromContext(r.Context())
+		assert.True(t, ok)
+		assert.Equal(t, 7, userID)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	testCases := []struct {
+		name     string
+		header   string
+		cookie   *http.Cookie
+		wantCode int
+	}{
+		{name: "accepts jwt cookie", cookie: &http.Cookie{Name: "jwt", Value: token}, wantCode: http.StatusOK},
+		{name: "accepts bearer token", header: "Bearer " + token, wantCode: http.StatusOK},
+		{name: "accepts lowercase scheme", header: "bearer " + token, wantCode: http.StatusOK},
+		{name: "rejects missing credentials", wantCode: http.StatusUnauthorized},
+		{name: "rejects other schemes", header: "Basic " + token, wantCode: http.StatusUnauthorized},
+		{name: "rejects empty bearer token", header: "Bearer ", wantCode: http.StatusUnauthorized},
+		{name: "rejects invalid bearer token", header: "Bearer invalid", wantCode: http.StatusUnauthorized},
+		{
+			name:     "prefers authorization header over cookie",
+			header:   "Bearer invalid",
+			cookie:   &http.Cookie{Name: "jwt", Value: token},
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+			if tc.header != "" {
+				request.Header.Set("Authorization", tc.header)
+			}
+			if tc.cookie != nil {
+				request.AddCookie(tc.cookie)
+			}
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, request)
+
+			assert.Equal(t, tc.wantCode, recorder.Code)
+		})
+	}
+}
+
+type apiKeyVerifierStub map[string]models.APIKey
+
+func (s apiKeyVerifierStub) Call(ctx context.Context, key string) (models.APIKey, error) {
+	apiKey, ok := s[key]
+	if !ok {
+		return models.APIKey{}, errors.New("invalid api key")
+	}
+	return apiKey, nil
+}
+
+func TestAuthenticateWithAPIKey(t *testing.T) {
+	keys, err := auth.NewKeySet(auth.NewHMACKey("test", []byte("secret")))
+	require.NoError(t, err)
+	token, err := keys.BuildJWTString(models.User{ID: 7})
+	require.NoError(t, err)
+	verifier := apiKeyVerifierStub{
+		"gm_orders":  {UserID: 7, Scopes: []string{models.ScopeOrdersWrite}},
+		"gm_balance": {UserID: 7, Scopes: []string{models.ScopeBalanceRead}},
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := UserIDFromContext(r.Context())
+		assert.Equal(t, 7, userID)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name     string
+		verifier APIKeyVerifier
+		header   string
+		wantCode int
+	}{
+		{name: "accepts api key with required scope", verifier: verifier, header: "Bearer gm_orders", wantCode: http.StatusOK},
+		{name: "rejects api key without required scope", verifier: verifier, header: "Bearer gm_balance", wantCode: http.StatusForbidden},
+		{name: "rejects unknown api key", verifier: verifier, header: "Bearer gm_unknown", wantCode: http.StatusUnauthorized},
+		{name: "rejects api key where api keys are disabled", header: "Bearer gm_orders", wantCode: http.StatusUnauthorized},
+		{name: "does not restrict sessions", verifier: verifier, header: "Bearer " + token, wantCode: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := Authenticate(keys, tc.verifier)(RequireScope(models.ScopeOrdersWrite)(ok))
+			request := httptest.NewRequest(http.MethodPost, "/api/user/orders", nil)
+			request.Header.Set("Authorization", tc.header)
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, request)
+
+			assert.Equal(t, tc.wantCode, recorder.Code)
+		})
+	}
+}
+
+type userFinderStub map[int]models.User
+
+func (s userFinderStub) FindUserByID(ctx context.Context, userID int) (models.User, error) {
+	user, ok := s[userID]
+	if !ok {
+		return models.User{}, storage.ErrUserNotFound{User: models.User{ID: userID}}
+	}
+	return user, nil
+}
+
+func TestRequireRole(t *testing.T) {
+	keys, err := auth.NewKeySet(auth.NewHMACKey("test", []byte("secret")))
+	require.NoError(t, err)
+	users := userFinderStub{
+		1: {ID: 1, Role: models.AdminRole},
+		2: {ID: 2, Role: models.RegularRole},
+	}
+	handler := Authenticate(keys, nil)(RequireRole(users, models.AdminRole)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	testCases := []struct {
+		name     string
+		userID   int
+		wantCode int
+	}{
+		{name: "lets admin through", userID: 1, wantCode: http.StatusOK},
+		{name: "rejects regular user", userID: 2, wantCode: http.StatusForbidden},
+		{name: "rejects deleted user", userID: 3, wantCode: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := keys.BuildJWTString(models.User{ID: tc.userID})
+			require.NoError(t, err)
+			request := httptest.NewRequest(http.MethodGet, "/api/admin/users", nil)
+			request.Header.Set("Authorization", "Bearer "+token)
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, request)
+
+			assert.Equal(t, tc.wantCode, recorder.Code)
+		})
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	trustedProxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	handler := RealIP(trustedProxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RemoteAddr))
+	}))
+
+	testCases := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		realIP       string
+		wantAddr     string
+	}{
+		{
+			name:         "takes client address from trusted proxy",
+			remoteAddr:   "10.0.0.1:4000",
+			forwardedFor: []string{"203.0.113.7"},
+			wantAddr:     "203.0.113.7",
+		},
+		{
+			name:         "skips trusted proxies in chain",
+			remoteAddr:   "10.0.0.1:4000",
+			forwardedFor: []string{"198.51.100.1, 203.0.113.7", "10.0.0.2"},
+			wantAddr:     "203.0.113.7",
+		},
+		{
+			name:       "falls back to X-Real-IP",
+			remoteAddr: "10.0.0.1:4000",
+			realIP:     "203.0.113.7",
+			wantAddr:   "203.0.113.7",
+		},
+		{
+			name:         "ignores forwarding headers from untrusted peer",
+			remoteAddr:   "198.51.100.1:4000",
+			forwardedFor: []string{"203.0.113.7"},
+			wantAddr:     "198.51.100.1:4000",
+		},
+		{
+			name:         "ignores malformed forwarding header",
+			remoteAddr:   "10.0.0.1:4000",
+			forwardedFor: []string{"not an address"},
+			wantAddr:     "10.0.0.1:4000",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/user/login", nil)
+			request.RemoteAddr = tc.remoteAddr
+			for _, value := range tc.forwardedFor {
+				request.Header.Add("X-Forwarded-For", value)
+			}
+			if tc.realIP != "" {
+				request.Header.Set("X-Real-IP", tc.realIP)
+			}
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, request)
+
+			assert.Equal(t, tc.wantAddr, recorder.Body.String())
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// BalanceAdjustment is a manual credit (positive amount) or debit
+// (negative amount) made by an operator
+type BalanceAdjustment struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	OperatorID int       `json:"operator_id"`
+	Amount     Money     `json:"amount"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
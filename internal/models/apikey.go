@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+const (
+	ScopeOrdersRead       = "orders:read"
+	ScopeOrdersWrite      = "orders:write"
+	ScopeBalanceRead      = "balance:read"
+	ScopeWithdrawalsRead  = "withdrawals:read"
+	ScopeWithdrawalsWrite = "withdrawals:write"
+	ScopeTransfersWrite   = "transfers:write"
+)
+
+var APIKeyScopes = []string{
+	ScopeOrdersRead,
+	ScopeOrdersWrite,
+	ScopeBalanceRead,
+	ScopeWithdrawalsRead,
+	ScopeWithdrawalsWrite,
+	ScopeTransfersWrite,
+}
+
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func (key APIKey) HasScope(scope string) bool {
+	for _, s := range key.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
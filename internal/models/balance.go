@@ -1,8 +1,12 @@
 package models
 
+// Balance points of pending withdrawals are held: they are neither current
+// nor withdrawn until the payment partner settles the withdrawal
 type Balance struct {
-	ID              int `json:"-"`
-	UserID          int `json:"-"`
-	CurrentAmount   int `json:"current"`
-	WithdrawnAmount int `json:"withdrawn"`
+	ID              int   `json:"-"`
+	UserID          int   `json:"-"`
+	CurrentAmount   Money `json:"current"`
+	WithdrawnAmount Money `json:"withdrawn"`
+	HeldAmount      Money `json:"held"`
+	ExpiringSoon    Money `json:"expiring_soon"`
 }
@@ -0,0 +1,12 @@
+package models
+
+// IdempotencyKey holds the response given to the first request made with
+// the key, StatusCode is zero while that request is still being processed
+type IdempotencyKey struct {
+	UserID      int
+	Key         string
+	RequestHash string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
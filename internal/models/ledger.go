@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type LedgerAccount string
+
+const (
+	UserAccount        LedgerAccount = "user"
+	AccrualsAccount    LedgerAccount = "accruals"
+	WithdrawalsAccount LedgerAccount = "withdrawals"
+	AdjustmentsAccount LedgerAccount = "adjustments"
+	HoldsAccount       LedgerAccount = "holds"
+	ExpirationsAccount LedgerAccount = "expirations"
+)
+
+type LedgerEntryKind int
+
+const (
+	AccrualEntry LedgerEntryKind = iota
+	WithdrawalEntry
+	AdjustmentEntry
+	ReversalEntry
+	SettlementEntry
+	ReleaseEntry
+	ExpiryEntry
+	TransferEntry
+)
+
+type LedgerEntry struct {
+	ID            int             `json:"-"`
+	TransactionID int             `json:"-"`
+	Account       LedgerAccount   `json:"-"`
+	UserID        int             `json:"-"`
+	Amount        Money           `json:"amount"`
+	Kind          LedgerEntryKind `json:"type"`
+	OrderNumber   string          `json:"order,omitempty"`
+	CreatedAt     time.Time       `json:"processed_at"`
+}
+
+func (entry LedgerEntry) MarshalJSON() ([]byte, error) {
+	type LedgerEntryAlias LedgerEntry
+
+	entryKind2String := map[LedgerEntryKind]string{
+		AccrualEntry:    "ACCRUAL",
+		WithdrawalEntry: "WITHDRAWAL",
+		AdjustmentEntry: "ADJUSTMENT",
+		ReversalEntry:   "REVERSAL",
+		SettlementEntry: "SETTLEMENT",
+		ReleaseEntry:    "RELEASE",
+		ExpiryEntry:     "EXPIRY",
+		TransferEntry:   "TRANSFER",
+	}
+	aliasValue := struct {
+		LedgerEntryAlias
+		Kind string `json:"type"`
+	}{
+		LedgerEntryAlias: LedgerEntryAlias(entry),
+		Kind:             entryKind2String[entry.Kind],
+	}
+
+	return json.Marshal(aliasValue)
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount of loyalty points stored in hundredths
+type Money int64
+
+const moneyScale = 100
+
+func ParseMoney(value string) (Money, error) {
+	amount, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return 0, fmt.Errorf("invalid amount \"%s\"", value)
+	}
+
+	amount.Mul(amount, big.NewRat(moneyScale, 1))
+	if !amount.IsInt() {
+		return 0, fmt.Errorf("amount \"%s\" has more than two decimal places", value)
+	}
+	if !amount.Num().IsInt64() {
+		return 0, fmt.Errorf("amount \"%s\" is out of range", value)
+	}
+
+	return Money(amount.Num().Int64()), nil
+}
+
+func (m Money) String() string {
+	sign := ""
+	value := int64(m)
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	whole := strconv.FormatInt(value/moneyScale, 10)
+	fraction := value % moneyScale
+	if fraction == 0 {
+		return sign + whole
+	}
+
+	return sign + whole + "." + strings.TrimRight(fmt.Sprintf("%02d", fraction), "0")
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("failed to parse amount: %w", err)
+	}
+
+	amount, err := ParseMoney(number.String())
+	if err != nil {
+		return err
+	}
+
+	*m = amount
+	return nil
+}
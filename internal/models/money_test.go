@@ -0,0 +1,66 @@
+package models_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	testCases := []struct {
+		name    string
+		data    string
+		want    models.Money
+		wantErr bool
+	}{
+		{name: "parses integer", data: "500", want: 50000},
+		{name: "parses decimal", data: "729.98", want: 72998},
+		{name: "parses one decimal place", data: "0.5", want: 50},
+		{name: "parses exponent", data: "1.5e2", want: 15000},
+		{name: "parses trailing zeros", data: "10.500", want: 1050},
+		{name: "parses quoted number", data: `"42.01"`, want: 4201},
+		{name: "parses negative number", data: "-3.07", want: -307},
+		{name: "rejects fractions of hundredths", data: "0.001", wantErr: true},
+		{name: "rejects non numbers", data: `"abc"`, wantErr: true},
+		{name: "rejects out of range numbers", data: "1e30", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var amount models.Money
+			err := json.Unmarshal([]byte(tc.data), &amount)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, amount)
+		})
+	}
+}
+
+func TestMoneyMarshalJSON(t *testing.T) {
+	testCases := []struct {
+		amount models.Money
+		want   string
+	}{
+		{amount: 0, want: "0"},
+		{amount: 50000, want: "500"},
+		{amount: 72998, want: "729.98"},
+		{amount: 50, want: "0.5"},
+		{amount: 5, want: "0.05"},
+		{amount: -307, want: "-3.07"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.want, func(t *testing.T) {
+			data, err := json.Marshal(tc.amount)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(data))
+		})
+	}
+}
@@ -13,33 +13,80 @@ const (
 	ProcessingOrder
 	InvalidOrder
 	ProcessedOrder
+	FailedOrder
 )
 
+func (status OrderStatus) String() string {
+	orderStatus2String := map[OrderStatus]string{
+		NewOrder:        "NEW",
+		RegisteredOrder: "REGISTERED",
+		ProcessingOrder: "PROCESSING",
+		ProcessedOrder:  "PROCESSED",
+		InvalidOrder:    "INVALID",
+		FailedOrder:     "FAILED",
+	}
+
+	return orderStatus2String[status]
+}
+
+// public is the status shown to users, who only know the statuses of the
+// accrual system: an order the worker gave up on is still being processed
+// for them until an operator resets it
+func (status OrderStatus) public() string {
+	if status == FailedOrder {
+		return ProcessingOrder.String()
+	}
+
+	return status.String()
+}
+
+func (status OrderStatus) Final() bool {
+	return status == ProcessedOrder || status == InvalidOrder
+}
+
 type Order struct {
 	ID        int         `json:"-"`
 	UserID    int         `json:"-"`
 	Number    string      `json:"number"`
 	Status    OrderStatus `json:"status"`
-	Accrual   int         `json:"accrual"`
+	Accrual   Money       `json:"accrual"`
 	CreatedAt time.Time   `json:"uploaded_at"`
+
+	Attempts      int       `json:"-"`
+	LastError     string    `json:"-"`
+	NextAttemptAt time.Time `json:"-"`
 }
 
 func (order Order) MarshalJSON() ([]byte, error) {
 	type OrderAlias Order
 
-	orderStatus2String := map[OrderStatus]string{
-		NewOrder:        "NEW",
-		RegisteredOrder: "REGISTERED",
-		ProcessingOrder: "PROCESSING",
-		ProcessedOrder:  "PROCESSED",
-		InvalidOrder:    "INVALID",
-	}
 	aliasValue := struct {
 		OrderAlias
 		Status string `json:"status"`
 	}{
 		OrderAlias: OrderAlias(order),
-		Status:     orderStatus2String[order.Status],
+		Status:     order.Status.public(),
+	}
+
+	return json.Marshal(aliasValue)
+}
+
+// AdminOrder shows operators the internal processing state of an order
+type AdminOrder Order
+
+func (order AdminOrder) MarshalJSON() ([]byte, error) {
+	type OrderAlias Order
+
+	aliasValue := struct {
+		OrderAlias
+		Status    string `json:"status"`
+		Attempts  int    `json:"attempts"`
+		LastError string `json:"last_error,omitempty"`
+	}{
+		OrderAlias: OrderAlias(order),
+		Status:     order.Status.String(),
+		Attempts:   order.Attempts,
+		LastError:  order.LastError,
 	}
 
 	return json.Marshal(aliasValue)
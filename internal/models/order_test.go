@@ -0,0 +1,37 @@
+package models_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderMarshalJSON(t *testing.T) {
+	order := models.Order{
+		Number:    "12345678903",
+		Status:    models.FailedOrder,
+		CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Attempts:  10,
+		LastError: "service is unavailable",
+	}
+
+	t.Run("hides failed status from users", func(t *testing.T) {
+		data, err := json.Marshal(order)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"number":"12345678903","status":"PROCESSING","accrual":0,"uploaded_at":"2024-01-01T00:00:00Z"}`, string(data))
+	})
+
+	t.Run("shows failed status to operators", func(t *testing.T) {
+		data, err := json.Marshal(models.AdminOrder(order))
+		require.NoError(t, err)
+		assert.JSONEq(
+			t,
+			`{"number":"12345678903","status":"FAILED","accrual":0,"uploaded_at":"2024-01-01T00:00:00Z","attempts":10,"last_error":"service is unavailable"}`,
+			string(data),
+		)
+	})
+}
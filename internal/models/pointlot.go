@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// PointLot is a single accrual of points; points expire lot by lot, oldest
+// first, a configured number of months after AccruedAt
+type PointLot struct {
+	ID          int
+	UserID      int
+	OrderNumber string
+	Amount      Money
+	Remaining   Money
+	AccruedAt   time.Time
+}
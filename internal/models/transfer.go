@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Transfer moves points from one user's balance to another's
+type Transfer struct {
+	ID          int       `json:"-"`
+	SenderID    int       `json:"-"`
+	RecipientID int       `json:"-"`
+	Recipient   string    `json:"recipient"`
+	Sum         Money     `json:"sum"`
+	CreatedAt   time.Time `json:"processed_at"`
+}
@@ -1,7 +1,17 @@
 package models
 
+type UserRole string
+
+const (
+	RegularRole UserRole = "user"
+	AdminRole   UserRole = "admin"
+)
+
 type User struct {
-	ID                int
-	Login             string
-	EncryptedPassword string
+	ID                int      `json:"id"`
+	Login             string   `json:"login"`
+	EncryptedPassword string   `json:"-"`
+	Role              UserRole `json:"role"`
+	TOTPSecret        string   `json:"-"`
+	TOTPEnabled       bool     `json:"totp_enabled"`
 }
@@ -1,11 +1,61 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
+type WithdrawalStatus int
+
+const (
+	PendingWithdrawal WithdrawalStatus = iota
+	ConfirmedWithdrawal
+	FailedWithdrawal
+)
+
+func (status WithdrawalStatus) String() string {
+	withdrawalStatus2String := map[WithdrawalStatus]string{
+		PendingWithdrawal:   "PENDING",
+		ConfirmedWithdrawal: "CONFIRMED",
+		FailedWithdrawal:    "FAILED",
+	}
+
+	return withdrawalStatus2String[status]
+}
+
+// Withdrawal points stay held while the payment partner settles it: they
+// are spent once it is confirmed and returned to the balance if it fails
 type Withdrawal struct {
-	ID          int       `json:"-"`
-	OrderNumber string    `json:"number"`
-	UserID      int       `json:"-"`
-	Sum         int       `json:"sum"`
-	ProcessedAt time.Time `json:"processed_at"`
+	ID             int              `json:"-"`
+	OrderNumber    string           `json:"number"`
+	UserID         int              `json:"-"`
+	Sum            Money            `json:"sum"`
+	Status         WithdrawalStatus `json:"status"`
+	ProcessedAt    time.Time        `json:"processed_at"`
+	SettledAt      *time.Time       `json:"settled_at,omitempty"`
+	ReversedAt     *time.Time       `json:"reversed_at,omitempty"`
+	ReversedBy     int              `json:"-"`
+	ReversalReason string           `json:"reversal_reason,omitempty"`
+
+	Attempts      int       `json:"-"`
+	LastError     string    `json:"-"`
+	NextAttemptAt time.Time `json:"-"`
+}
+
+func (w Withdrawal) Reversed() bool {
+	return w.ReversedAt != nil
+}
+
+func (w Withdrawal) MarshalJSON() ([]byte, error) {
+	type WithdrawalAlias Withdrawal
+
+	aliasValue := struct {
+		WithdrawalAlias
+		Status string `json:"status"`
+	}{
+		WithdrawalAlias: WithdrawalAlias(w),
+		Status:          w.Status.String(),
+	}
+
+	return json.Marshal(aliasValue)
 }
@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"go.uber.org/zap"
+)
+
+type Notifier interface {
+	NotifyPasswordReset(ctx context.Context, user models.User, token string, expiresAt time.Time) error
+}
+
+type logNotifier struct {
+	logger *zap.Logger
+}
+
+// NewLogNotifier only records that a notification was due: tokens never go to
+// the log, anyone reading it could take over the accounts otherwise
+func NewLogNotifier(logger *zap.Logger) Notifier {
+	return logNotifier{logger: logger}
+}
+
+func (n logNotifier) NotifyPasswordReset(ctx context.Context, user models.User, token string, expiresAt time.Time) error {
+	n.logger.Info(
+		"password reset requested",
+		zap.String("login", user.Login),
+		zap.Time("expires_at", expiresAt),
+	)
+
+	return nil
+}
+
+type fileNotifier struct {
+	mu   *sync.Mutex
+	path string
+}
+
+// NewFileNotifier appends every notification to path as a JSON line
+func NewFileNotifier(path string) Notifier {
+	return fileNotifier{mu: &sync.Mutex{}, path: path}
+}
+
+func (n fileNotifier) NotifyPasswordReset(ctx context.Context, user models.User, token string, expiresAt time.Time) error {
+	type notification struct {
+		Kind      string    `json:"kind"`
+		Login     string    `json:"login"`
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	line, err := json.Marshal(notification{Kind: "password_reset", Login: user.Login, Token: token, ExpiresAt: expiresAt})
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	f, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open notifications file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write notification: %w", err)
+	}
+
+	return nil
+}
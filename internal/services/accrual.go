@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/ilya-burinskiy/gophermart/internal/accrual"
@@ -17,43 +18,108 @@ type AccrualWorker interface {
 	Run()
 }
 
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	return delay
+}
+
+type AccrualWorkerConfig struct {
+	InstanceID    string
+	WorkersNum    int
+	PollInterval  time.Duration
+	LeaseDuration time.Duration
+	RetryPolicy   RetryPolicy
+}
+
 type accrualWorker struct {
-	client     accrual.ApiClient
-	store      storage.Storage
-	logger     *zap.Logger
-	workersNum int
-	exitCh     <-chan struct{}
+	client accrual.ApiClient
+	store  storage.Storage
+	logger *zap.Logger
+	config AccrualWorkerConfig
+	exitCh <-chan struct{}
+	pause  *pause
+}
+
+type pause struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+func (p *pause) extend(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(p.until) {
+		p.until = until
+	}
+}
+
+func (p *pause) remaining() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return time.Until(p.until)
+}
+
+func (p *pause) wait() {
+	for d := p.remaining(); d > 0; d = p.remaining() {
+		time.Sleep(d)
+	}
 }
 
 func NewAccrualWorker(
 	accrualApiClient accrual.ApiClient,
 	store storage.Storage,
 	logger *zap.Logger,
-	workersNum int,
+	config AccrualWorkerConfig,
 	exitCh <-chan struct{}) AccrualWorker {
 
 	return accrualWorker{
-		client:     accrualApiClient,
-		store:      store,
-		logger:     logger,
-		workersNum: workersNum,
-		exitCh:     exitCh,
+		client: accrualApiClient,
+		store:  store,
+		logger: logger,
+		config: config,
+		exitCh: exitCh,
+		pause:  &pause{},
 	}
 }
 
 func (wrk accrualWorker) Run() {
-	jobsChannel := make(chan models.Order, wrk.workersNum)
-	ticker := time.NewTicker(5 * time.Second)
+	jobsChannel := make(chan models.Order, wrk.config.WorkersNum)
+	ticker := time.NewTicker(wrk.config.PollInterval)
 	ctx := context.TODO()
 
-	for w := 1; w <= wrk.workersNum; w++ {
+	for w := 1; w <= wrk.config.WorkersNum; w++ {
 		go wrk.processOrder(jobsChannel)
 	}
 
 	for {
 		select {
 		case <-ticker.C:
-			orders, err := wrk.store.NewOrders(ctx)
+			if wrk.pause.remaining() > 0 {
+				continue
+			}
+
+			orders, err := wrk.store.ClaimOrders(
+				ctx,
+				wrk.config.InstanceID,
+				wrk.config.WorkersNum,
+				wrk.config.LeaseDuration,
+			)
 			if err != nil {
 				wrk.logger.Info("run accrual worker", zap.Error(err))
 				continue
@@ -73,10 +139,27 @@ func (wrk accrualWorker) Run() {
 func (wrk accrualWorker) processOrder(jobsChannel <-chan models.Order) {
 	ctx := context.TODO()
 	for order := range jobsChannel {
+		wrk.pause.wait()
 		orderInfo, err := wrk.client.GetOrderInfo(ctx, order.Number)
 		if err != nil {
 			wrk.logger.Info("accrual worker error", zap.Error(err))
-			err = wrk.store.DeleteOrder(ctx, order.ID)
+			var rateLimitErr accrual.ErrTooManyRequests
+			if errors.As(err, &rateLimitErr) {
+				// the order is not to blame, so the attempt is not counted, but
+				// the lease is handed back as it may outlive the pause
+				wrk.pause.extend(rateLimitErr.RetryAfter)
+				err = wrk.store.RescheduleOrder(
+					ctx,
+					order.ID,
+					wrk.config.InstanceID,
+					time.Now().Add(rateLimitErr.RetryAfter),
+				)
+				if err != nil {
+					wrk.logger.Info("accrual worker error", zap.Error(err))
+				}
+				continue
+			}
+			err = wrk.recordFailure(ctx, order, err)
 			if err != nil {
 				wrk.logger.Info("accrual worker error", zap.Error(err))
 			}
@@ -89,36 +172,79 @@ func (wrk accrualWorker) processOrder(jobsChannel <-chan models.Order) {
 	}
 }
 
+func (wrk accrualWorker) recordFailure(ctx context.Context, order models.Order, cause error) error {
+	attempts := order.Attempts + 1
+	status := order.Status
+	if attempts >= wrk.config.RetryPolicy.MaxAttempts {
+		status = models.FailedOrder
+		wrk.logger.Warn(
+			"giving up on order",
+			zap.String("number", order.Number),
+			zap.Int("attempts", attempts),
+			zap.Error(cause),
+		)
+	}
+
+	return wrk.store.RecordOrderFailure(
+		ctx,
+		order.ID,
+		wrk.config.InstanceID,
+		status,
+		cause.Error(),
+		time.Now().Add(wrk.config.RetryPolicy.Backoff(attempts)),
+	)
+}
+
 func (wrk accrualWorker) updateOrderWithBalance(
 	ctx context.Context,
 	order models.Order,
 	orderInfo accrual.OrderInfo) error {
 
 	err := wrk.store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
-		err := wrk.store.UpdateOrderTx(ctx, tx, order.ID, orderInfo.Status, orderInfo.Accrual)
-		if err != nil {
-			return fmt.Errorf("failed to update order: %w", err)
+		if !orderInfo.Status.Final() {
+			err := wrk.store.UpdateOrderTx(
+				ctx,
+				tx,
+				order.ID,
+				wrk.config.InstanceID,
+				orderInfo.Status,
+				orderInfo.Accrual,
+				time.Now().Add(wrk.config.PollInterval),
+			)
+			if err != nil {
+				return fmt.Errorf("failed to update order: %w", err)
+			}
+
+			return nil
 		}
 
-		balance, err := wrk.store.FindBalanceByUserIDTx(ctx, tx, order.UserID)
+		completed, err := wrk.store.CompleteOrderTx(ctx, tx, order.ID, wrk.config.InstanceID, orderInfo.Status, orderInfo.Accrual)
 		if err != nil {
-			var notFoundErr storage.ErrBalanceNotFound
-			if errors.As(err, &notFoundErr) {
-				balance, err = wrk.store.CreateBalanceTx(ctx, tx, order.UserID, orderInfo.Accrual)
-				if err != nil {
-					return fmt.Errorf("failed to create balance: %w", err)
-				}
-			}
-
-			return fmt.Errorf("an unexpted error occured while trying to find balance: %w", err)
+			return fmt.Errorf("failed to complete order: %w", err)
+		}
+		if !completed || orderInfo.Status != models.ProcessedOrder || orderInfo.Accrual == 0 {
+			return nil
 		}
 
-		err = wrk.store.UpdateBalanceCurrentAmountTx(ctx, tx, balance.ID, balance.CurrentAmount+orderInfo.Accrual)
+		err = wrk.store.CreditBalanceTx(ctx, tx, order.UserID, orderInfo.Accrual)
 		if err != nil {
-			return fmt.Errorf("failed to updage balance current amount: %w", err)
+			return fmt.Errorf("failed to credit balance: %w", err)
+		}
+		lot := models.PointLot{UserID: order.UserID, OrderNumber: order.Number, Amount: orderInfo.Accrual}
+		if err = wrk.store.CreatePointLotTx(ctx, tx, lot); err != nil {
+			return fmt.Errorf("failed to create point lot: %w", err)
 		}
 
-		return nil
+		return recordLedgerTx(
+			ctx,
+			wrk.store,
+			tx,
+			models.AccrualEntry,
+			order.Number,
+			order.UserID,
+			orderInfo.Accrual,
+			models.AccrualsAccount,
+		)
 	})
 
 	return err
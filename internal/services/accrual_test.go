@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/ilya-burinskiy/gophermart/internal/accrual"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type accrualClientStub struct {
+	orderInfo accrual.OrderInfo
+	err       error
+}
+
+func (c accrualClientStub) GetOrderInfo(ctx context.Context, orderNumber string) (accrual.OrderInfo, error) {
+	return c.orderInfo, c.err
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	assert.Equal(t, time.Second, policy.Backoff(1))
+	assert.Equal(t, 2*time.Second, policy.Backoff(2))
+	assert.Equal(t, 8*time.Second, policy.Backoff(4))
+	assert.Equal(t, 10*time.Second, policy.Backoff(5))
+	assert.Equal(t, 10*time.Second, policy.Backoff(100))
+}
+
+func TestAccrualWorkerProcessOrderFailure(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute}
+	testCases := []struct {
+		name           string
+		order          models.Order
+		clientErr      error
+		wantStatus     models.OrderStatus
+		wantRecord     bool
+		wantReschedule bool
+	}{
+		{
+			name:       "schedules retry on transient error",
+			order:      models.Order{ID: 1, Number: "12345", Status: models.NewOrder},
+			clientErr:  errors.New("service is unavailable"),
+			wantStatus: models.NewOrder,
+			wantRecord: true,
+		},
+		{
+			name:       "marks order as failed after max attempts",
+			order:      models.Order{ID: 1, Number: "12345", Status: models.NewOrder, Attempts: 2},
+			clientErr:  errors.New("service is unavailable"),
+			wantStatus: models.FailedOrder,
+			wantRecord: true,
+		},
+		{
+			name:           "does not count rate limit as attempt but hands lease back",
+			order:          models.Order{ID: 1, Number: "12345", Status: models.NewOrder},
+			clientErr:      accrual.ErrTooManyRequests{RetryAfter: time.Millisecond},
+			wantReschedule: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			storageMock := mocks.NewMockStorage(ctrl)
+			if tc.wantRecord {
+				storageMock.EXPECT().
+					RecordOrderFailure(gomock.Any(), tc.order.ID, "instance", tc.wantStatus, tc.clientErr.Error(), gomock.Any()).
+					Return(nil)
+			}
+			if tc.wantReschedule {
+				storageMock.EXPECT().RescheduleOrder(gomock.Any(), tc.order.ID, "instance", gomock.Any()).Return(nil)
+			}
+
+			wrk := NewAccrualWorker(
+				accrualClientStub{err: tc.clientErr},
+				storageMock,
+				zap.NewNop(),
+				AccrualWorkerConfig{
+					InstanceID:   "instance",
+					WorkersNum:   1,
+					PollInterval: time.Second,
+					RetryPolicy:  policy,
+				},
+				nil,
+			).(accrualWorker)
+			jobs := make(chan models.Order, 1)
+			jobs <- tc.order
+			close(jobs)
+			wrk.processOrder(jobs)
+		})
+	}
+}
+
+func TestAccrualWorkerProcessOrderSuccess(t *testing.T) {
+	testCases := []struct {
+		name         string
+		orderInfo    accrual.OrderInfo
+		wantComplete bool
+		alreadyFinal bool
+		wantBalance  bool
+	}{
+		{
+			name:      "keeps polling registered order",
+			orderInfo: accrual.OrderInfo{Status: models.RegisteredOrder},
+		},
+		{
+			name:      "keeps polling processing order",
+			orderInfo: accrual.OrderInfo{Status: models.ProcessingOrder},
+		},
+		{
+			name:         "does not credit balance for invalid order",
+			orderInfo:    accrual.OrderInfo{Status: models.InvalidOrder},
+			wantComplete: true,
+		},
+		{
+			name:         "credits balance for processed order",
+			orderInfo:    accrual.OrderInfo{Status: models.ProcessedOrder, Accrual: 500},
+			wantComplete: true,
+			wantBalance:  true,
+		},
+		{
+			name:         "does not credit balance twice for replayed processed order",
+			orderInfo:    accrual.OrderInfo{Status: models.ProcessedOrder, Accrual: 500},
+			wantComplete: true,
+			alreadyFinal: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			storageMock := mocks.NewMockStorage(ctrl)
+			txMock := mocks.NewMockTx(ctrl)
+			order := models.Order{ID: 1, UserID: 2, Number: "12345", Status: models.NewOrder}
+			storageMock.EXPECT().
+				WithinTranscaction(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, f func(context.Context, pgx.Tx) error) error {
+					return f(ctx, txMock)
+				})
+			if tc.wantComplete {
+				storageMock.EXPECT().
+					CompleteOrderTx(gomock.Any(), txMock, order.ID, "instance", tc.orderInfo.Status, tc.orderInfo.Accrual).
+					Return(!tc.alreadyFinal, nil)
+			} else {
+				storageMock.EXPECT().
+					UpdateOrderTx(gomock.Any(), txMock, order.ID, "instance", tc.orderInfo.Status, tc.orderInfo.Accrual, gomock.Any()).
+					Return(nil)
+			}
+			if tc.wantBalance {
+				storageMock.EXPECT().
+					CreditBalanceTx(gomock.Any(), txMock, order.UserID, tc.orderInfo.Accrual).
+					Return(nil)
+				storageMock.EXPECT().
+					CreatePointLotTx(gomock.Any(), txMock, models.PointLot{
+						UserID: order.UserID, OrderNumber: order.Number, Amount: tc.orderInfo.Accrual,
+					}).
+					Return(nil)
+				storageMock.EXPECT().
+					CreateLedgerTransactionTx(
+						gomock.Any(),
+						txMock,
+						models.AccrualEntry,
+						order.Number,
+						[]models.LedgerEntry{
+							{Account: models.UserAccount, UserID: order.UserID, Amount: tc.orderInfo.Accrual},
+							{Account: models.AccrualsAccount, Amount: -tc.orderInfo.Accrual},
+						},
+					).
+					Return(nil)
+			}
+
+			wrk := NewAccrualWorker(
+				accrualClientStub{orderInfo: tc.orderInfo},
+				storageMock,
+				zap.NewNop(),
+				AccrualWorkerConfig{
+					InstanceID:   "instance",
+					WorkersNum:   1,
+					PollInterval: time.Second,
+					RetryPolicy:  RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute},
+				},
+				nil,
+			).(accrualWorker)
+			jobs := make(chan models.Order, 1)
+			jobs <- order
+			close(jobs)
+			wrk.processOrder(jobs)
+		})
+	}
+}
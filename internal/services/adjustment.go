@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrInvalidAdjustmentAmount  = errors.New("adjustment amount must not be zero")
+	ErrAdjustmentReasonRequired = errors.New("adjustment reason is required")
+)
+
+type BalanceAdjuster interface {
+	Call(ctx context.Context, operatorID, userID int, amount models.Money, reason string) (models.BalanceAdjustment, error)
+}
+
+type UserBalanceAdjustmentsFetcher interface {
+	Call(ctx context.Context, userID int) ([]models.BalanceAdjustment, error)
+}
+
+type balanceAdjuster struct {
+	store storage.Storage
+}
+
+type userBalanceAdjustmentsFetcher struct {
+	store storage.Storage
+}
+
+func NewBalanceAdjuster(store storage.Storage) BalanceAdjuster {
+	return balanceAdjuster{
+		store: store,
+	}
+}
+
+func NewUserBalanceAdjustmentsFetcher(store storage.Storage) UserBalanceAdjustmentsFetcher {
+	return userBalanceAdjustmentsFetcher{
+		store: store,
+	}
+}
+
+// Call credits a positive amount to the user's balance or debits a negative
+// one, recording the operator and the reason in the audit trail
+func (a balanceAdjuster) Call(
+	ctx context.Context,
+	operatorID int,
+	userID int,
+	amount models.Money,
+	reason string) (models.BalanceAdjustment, error) {
+
+	if amount == 0 {
+		return models.BalanceAdjustment{}, ErrInvalidAdjustmentAmount
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return models.BalanceAdjustment{}, ErrAdjustmentReasonRequired
+	}
+	if _, err := a.store.FindUserByID(ctx, userID); err != nil {
+		return models.BalanceAdjustment{}, err
+	}
+
+	var adjustment models.BalanceAdjustment
+	err := a.store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		var err error
+		adjustment, err = a.store.CreateBalanceAdjustmentTx(ctx, tx, models.BalanceAdjustment{
+			UserID:     userID,
+			OperatorID: operatorID,
+			Amount:     amount,
+			Reason:     reason,
+		})
+		if err != nil {
+			return err
+		}
+
+		if amount > 0 {
+			err = a.store.CreditBalanceTx(ctx, tx, userID, amount)
+		} else {
+			err = a.store.DebitBalanceTx(ctx, tx, userID, -amount)
+		}
+		if err != nil {
+			var insufficientErr storage.ErrInsufficientBalance
+			if errors.As(err, &insufficientErr) {
+				return ErrNotEnoughAmount
+			}
+			return err
+		}
+		if amount > 0 {
+			err = a.store.CreatePointLotTx(ctx, tx, models.PointLot{UserID: userID, Amount: amount})
+		} else {
+			_, err = a.store.ConsumePointLotsTx(ctx, tx, userID, "", -amount)
+		}
+		if err != nil {
+			return err
+		}
+
+		return recordLedgerTx(ctx, a.store, tx, models.AdjustmentEntry, "", userID, amount, models.AdjustmentsAccount)
+	})
+
+	return adjustment, err
+}
+
+func (f userBalanceAdjustmentsFetcher) Call(ctx context.Context, userID int) ([]models.BalanceAdjustment, error) {
+	return f.store.UserBalanceAdjustments(ctx, userID)
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/storage/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBalanceAdjusterCall(t *testing.T) {
+	user := models.User{ID: 2, Login: "login"}
+	operatorID := 1
+
+	testCases := []struct {
+		name        string
+		amount      models.Money
+		reason      string
+		expect      func(storageMock *mocks.MockStorage, txMock *mocks.MockTx)
+		expectedErr error
+	}{
+		{
+			name:   "credits balance and records ledger transaction",
+			amount: 1050,
+			reason: "lost accrual",
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+				storageMock.EXPECT().FindUserByID(gomock.Any(), user.ID).Return(user, nil)
+				expectTransaction(storageMock, txMock)
+				storageMock.EXPECT().
+					CreateBalanceAdjustmentTx(gomock.Any(), txMock, models.BalanceAdjustment{
+						UserID: user.ID, OperatorID: operatorID, Amount: 1050, Reason: "lost accrual",
+					}).
+					Return(models.BalanceAdjustment{ID: 1}, nil)
+				storageMock.EXPECT().CreditBalanceTx(gomock.Any(), txMock, user.ID, models.Money(1050)).Return(nil)
+				storageMock.EXPECT().
+					CreatePointLotTx(gomock.Any(), txMock, models.PointLot{UserID: user.ID, Amount: 1050}).
+					Return(nil)
+				storageMock.EXPECT().
+					CreateLedgerTransactionTx(gomock.Any(), txMock, models.AdjustmentEntry, "", []models.LedgerEntry{
+						{Account: models.UserAccount, UserID: user.ID, Amount: 1050},
+						{Account: models.AdjustmentsAccount, Amount: -1050},
+					}).
+					Return(nil)
+			},
+		},
+		{
+			name:   "debits balance",
+			amount: -500,
+			reason: "duplicate accrual",
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+				storageMock.EXPECT().FindUserByID(gomock.Any(), user.ID).Return(user, nil)
+				expectTransaction(storageMock, txMock)
+				storageMock.EXPECT().CreateBalanceAdjustmentTx(gomock.Any(), txMock, gomock.Any()).Return(models.BalanceAdjustment{ID: 1}, nil)
+				storageMock.EXPECT().DebitBalanceTx(gomock.Any(), txMock, user.ID, models.Money(500)).Return(nil)
+				storageMock.EXPECT().
+					ConsumePointLotsTx(gomock.Any(), txMock, user.ID, "", models.Money(500)).
+					Return([]models.PointLot{{ID: 1, UserID: user.ID, Amount: 500}}, nil)
+				storageMock.EXPECT().
+					CreateLedgerTransactionTx(gomock.Any(), txMock, models.AdjustmentEntry, "", gomock.Any()).
+					Return(nil)
+			},
+		},
+		{
+			name:   "rejects debit exceeding balance",
+			amount: -500,
+			reason: "duplicate accrual",
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+				storageMock.EXPECT().FindUserByID(gomock.Any(), user.ID).Return(user, nil)
+				expectTransaction(storageMock, txMock)
+				storageMock.EXPECT().CreateBalanceAdjustmentTx(gomock.Any(), txMock, gomock.Any()).Return(models.BalanceAdjustment{ID: 1}, nil)
+				storageMock.EXPECT().
+					DebitBalanceTx(gomock.Any(), txMock, user.ID, models.Money(500)).
+					Return(storage.ErrInsufficientBalance{UserID: user.ID, Amount: 500})
+			},
+			expectedErr: ErrNotEnoughAmount,
+		},
+		{
+			name:        "rejects zero amount",
+			reason:      "nothing",
+			expect:      func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {},
+			expectedErr: ErrInvalidAdjustmentAmount,
+		},
+		{
+			name:        "requires reason",
+			amount:      100,
+			reason:      "  ",
+			expect:      func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {},
+			expectedErr: ErrAdjustmentReasonRequired,
+		},
+		{
+			name:   "rejects unknown user",
+			amount: 100,
+			reason: "lost accrual",
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+				storageMock.EXPECT().FindUserByID(gomock.Any(), user.ID).Return(models.User{}, storage.ErrUserNotFound{})
+			},
+			expectedErr: storage.ErrUserNotFound{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			storageMock := mocks.NewMockStorage(ctrl)
+			txMock := mocks.NewMockTx(ctrl)
+			tc.expect(storageMock, txMock)
+
+			_, err := NewBalanceAdjuster(storageMock).Call(context.Background(), operatorID, user.ID, tc.amount, tc.reason)
+
+			if tc.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+)
+
+const usersSearchLimit = 50
+
+var ErrOrderFinalized = errors.New("order has already been processed")
+
+type UsersSearcher interface {
+	Call(ctx context.Context, login string) ([]models.User, error)
+}
+
+type OrderResetter interface {
+	Call(ctx context.Context, number string) error
+}
+
+type usersSearcher struct {
+	store storage.Storage
+}
+
+type orderResetter struct {
+	store storage.Storage
+}
+
+func NewUsersSearcher(store storage.Storage) UsersSearcher {
+	return usersSearcher{
+		store: store,
+	}
+}
+
+func NewOrderResetter(store storage.Storage) OrderResetter {
+	return orderResetter{
+		store: store,
+	}
+}
+
+func (s usersSearcher) Call(ctx context.Context, login string) ([]models.User, error) {
+	return s.store.SearchUsers(ctx, login, usersSearchLimit)
+}
+
+// Call returns a not finalized order to the accrual polling queue, processed
+// and invalid orders are never polled again
+func (r orderResetter) Call(ctx context.Context, number string) error {
+	order, err := r.store.FindOrderByNumber(ctx, number)
+	if err != nil {
+		return err
+	}
+	if order.Status.Final() {
+		return ErrOrderFinalized
+	}
+
+	reset, err := r.store.ResetOrder(ctx, order.ID)
+	if err != nil {
+		return fmt.Errorf("failed to reset order: %w", err)
+	}
+	if !reset {
+		return ErrOrderFinalized
+	}
+
+	return nil
+}
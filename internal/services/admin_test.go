@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/storage/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderResetterCall(t *testing.T) {
+	testCases := []struct {
+		name        string
+		expect      func(storageMock *mocks.MockStorage)
+		expectedErr error
+	}{
+		{
+			name: "resets stuck order",
+			expect: func(storageMock *mocks.MockStorage) {
+				storageMock.EXPECT().
+					FindOrderByNumber(gomock.Any(), "12345678903").
+					Return(models.Order{ID: 1, Number: "12345678903", Status: models.FailedOrder}, nil)
+				storageMock.EXPECT().ResetOrder(gomock.Any(), 1).Return(true, nil)
+			},
+		},
+		{
+			name: "does not reset processed order",
+			expect: func(storageMock *mocks.MockStorage) {
+				storageMock.EXPECT().
+					FindOrderByNumber(gomock.Any(), "12345678903").
+					Return(models.Order{ID: 1, Number: "12345678903", Status: models.ProcessedOrder}, nil)
+			},
+			expectedErr: ErrOrderFinalized,
+		},
+		{
+			name: "does not reset order finalized concurrently",
+			expect: func(storageMock *mocks.MockStorage) {
+				storageMock.EXPECT().
+					FindOrderByNumber(gomock.Any(), "12345678903").
+					Return(models.Order{ID: 1, Number: "12345678903", Status: models.ProcessingOrder}, nil)
+				storageMock.EXPECT().ResetOrder(gomock.Any(), 1).Return(false, nil)
+			},
+			expectedErr: ErrOrderFinalized,
+		},
+		{
+			name: "returns not found error",
+			expect: func(storageMock *mocks.MockStorage) {
+				storageMock.EXPECT().
+					FindOrderByNumber(gomock.Any(), "12345678903").
+					Return(models.Order{}, storage.ErrOrderNotFound{})
+			},
+			expectedErr: storage.ErrOrderNotFound{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			storageMock := mocks.NewMockStorage(ctrl)
+			tc.expect(storageMock)
+
+			err := NewOrderResetter(storageMock).Call(context.Background(), "12345678903")
+
+			if tc.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
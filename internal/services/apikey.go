@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ilya-burinskiy/gophermart/internal/auth"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+)
+
+const (
+	maxAPIKeyNameLength = 64
+	apiKeyDisplayLength = 8
+)
+
+var (
+	ErrInvalidAPIKeyName   = errors.New("api key name must be from 1 to 64 characters long")
+	ErrInvalidAPIKeyScopes = errors.New("api key must have at least one known scope")
+	ErrInvalidAPIKey       = errors.New("invalid api key")
+)
+
+type APIKeyCreator interface {
+	Call(ctx context.Context, userID int, name string, scopes []string) (models.APIKey, string, error)
+}
+
+type UserAPIKeysFetcher interface {
+	Call(ctx context.Context, userID int) ([]models.APIKey, error)
+}
+
+type APIKeyRevoker interface {
+	Call(ctx context.Context, userID, keyID int) error
+}
+
+type APIKeyVerifier interface {
+	Call(ctx context.Context, key string) (models.APIKey, error)
+}
+
+type apiKeyCreator struct {
+	store storage.Storage
+}
+
+type userAPIKeysFetcher struct {
+	store storage.Storage
+}
+
+type apiKeyRevoker struct {
+	store storage.Storage
+}
+
+type apiKeyVerifier struct {
+	store storage.Storage
+}
+
+func NewAPIKeyCreator(store storage.Storage) APIKeyCreator {
+	return apiKeyCreator{
+		store: store,
+	}
+}
+
+func NewUserAPIKeysFetcher(store storage.Storage) UserAPIKeysFetcher {
+	return userAPIKeysFetcher{
+		store: store,
+	}
+}
+
+func NewAPIKeyRevoker(store storage.Storage) APIKeyRevoker {
+	return apiKeyRevoker{
+		store: store,
+	}
+}
+
+func NewAPIKeyVerifier(store storage.Storage) APIKeyVerifier {
+	return apiKeyVerifier{
+		store: store,
+	}
+}
+
+// Call returns the created key along with its plain value, which is not
+// stored and cannot be shown again
+func (c apiKeyCreator) Call(ctx context.Context, userID int, name string, scopes []string) (models.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxAPIKeyNameLength {
+		return models.APIKey{}, "", ErrInvalidAPIKeyName
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+
+	plainKey, err := auth.GenerateAPIKey()
+	if err != nil {
+		return models.APIKey{}, "", fmt.Errorf("failed to create api key: %w", err)
+	}
+	key, err := c.store.CreateAPIKey(ctx, models.APIKey{
+		UserID:  userID,
+		Name:    name,
+		Prefix:  plainKey[:len(auth.APIKeyPrefix)+apiKeyDisplayLength],
+		KeyHash: auth.HashOpaqueToken(plainKey),
+		Scopes:  scopes,
+	})
+	if err != nil {
+		return models.APIKey{}, "", fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return key, plainKey, nil
+}
+
+func (f userAPIKeysFetcher) Call(ctx context.Context, userID int) ([]models.APIKey, error) {
+	return f.store.UserAPIKeys(ctx, userID)
+}
+
+func (r apiKeyRevoker) Call(ctx context.Context, userID, keyID int) error {
+	return r.store.RevokeAPIKey(ctx, userID, keyID)
+}
+
+func (v apiKeyVerifier) Call(ctx context.Context, key string) (models.APIKey, error) {
+	if !auth.IsAPIKey(key) {
+		return models.APIKey{}, ErrInvalidAPIKey
+	}
+
+	apiKey, err := v.store.UseAPIKey(ctx, auth.HashOpaqueToken(key))
+	if err != nil {
+		var notFoundErr storage.ErrAPIKeyNotFound
+		if errors.As(err, &notFoundErr) {
+			return models.APIKey{}, ErrInvalidAPIKey
+		}
+		return models.APIKey{}, fmt.Errorf("failed to verify api key: %w", err)
+	}
+
+	return apiKey, nil
+}
+
+func normalizeScopes(scopes []string) ([]string, error) {
+	known := make(map[string]bool, len(models.APIKeyScopes))
+	for _, scope := range models.APIKeyScopes {
+		known[scope] = true
+	}
+
+	result := make([]string, 0, len(scopes))
+	seen := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		if !known[scope] {
+			return nil, ErrInvalidAPIKeyScopes
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	if len(result) == 0 {
+		return nil, ErrInvalidAPIKeyScopes
+	}
+
+	return result, nil
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/ilya-burinskiy/gophermart/internal/auth"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/storage/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyCreatorCall(t *testing.T) {
+	t.Run("stores hashed key with deduplicated scopes", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		var stored models.APIKey
+		storageMock.EXPECT().
+			CreateAPIKey(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+				stored = key
+				key.ID = 1
+				return key, nil
+			})
+
+		scopes := []string{models.ScopeOrdersWrite, models.ScopeBalanceRead, models.ScopeOrdersWrite}
+		apiKey, plainKey, err := NewAPIKeyCreator(storageMock).Call(context.Background(), 7, " uploader ", scopes)
+
+		require.NoError(t, err)
+		assert.True(t, auth.IsAPIKey(plainKey))
+		assert.Equal(t, 1, apiKey.ID)
+		assert.Equal(t, 7, stored.UserID)
+		assert.Equal(t, "uploader", stored.Name)
+		assert.Equal(t, auth.HashOpaqueToken(plainKey), stored.KeyHash)
+		assert.True(t, strings.HasPrefix(plainKey, stored.Prefix))
+		assert.NotEqual(t, plainKey, stored.Prefix)
+		assert.Equal(t, []string{models.ScopeOrdersWrite, models.ScopeBalanceRead}, stored.Scopes)
+	})
+
+	testCases := []struct {
+		name        string
+		keyName     string
+		scopes      []string
+		expectedErr error
+	}{
+		{name: "rejects empty name", keyName: " ", scopes: []string{models.ScopeOrdersRead}, expectedErr: ErrInvalidAPIKeyName},
+		{name: "rejects too long name", keyName: strings.Repeat("a", 65), scopes: []string{models.ScopeOrdersRead}, expectedErr: ErrInvalidAPIKeyName},
+		{name: "rejects empty scopes", keyName: "uploader", expectedErr: ErrInvalidAPIKeyScopes},
+		{name: "rejects unknown scope", keyName: "uploader", scopes: []string{"admin"}, expectedErr: ErrInvalidAPIKeyScopes},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			storageMock := mocks.NewMockStorage(ctrl)
+
+			_, _, err := NewAPIKeyCreator(storageMock).Call(context.Background(), 7, tc.keyName, tc.scopes)
+
+			assert.ErrorIs(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestAPIKeyVerifierCall(t *testing.T) {
+	t.Run("resolves key by its hash", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		storageMock.EXPECT().
+			UseAPIKey(gomock.Any(), auth.HashOpaqueToken("gm_key")).
+			Return(models.APIKey{ID: 1, UserID: 7}, nil)
+
+		apiKey, err := NewAPIKeyVerifier(storageMock).Call(context.Background(), "gm_key")
+
+		require.NoError(t, err)
+		assert.Equal(t, 7, apiKey.UserID)
+	})
+
+	t.Run("rejects unknown or revoked key", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		storageMock.EXPECT().UseAPIKey(gomock.Any(), gomock.Any()).Return(models.APIKey{}, storage.ErrAPIKeyNotFound{})
+
+		_, err := NewAPIKeyVerifier(storageMock).Call(context.Background(), "gm_key")
+
+		assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	})
+
+	t.Run("rejects tokens without api key prefix", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+
+		_, err := NewAPIKeyVerifier(storageMock).Call(context.Background(), "key")
+
+		assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	})
+}
@@ -2,38 +2,238 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
+	"unicode/utf8"
 
 	"github.com/ilya-burinskiy/gophermart/internal/auth"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
 	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
 )
 
 type UserAuthenticator interface {
-	Call(ctx context.Context, login, password string) (string, error)
+	Call(ctx context.Context, login, password, otp, ip string) (auth.TokenPair, error)
+}
+
+type ErrLoginLocked struct {
+	RetryAfter time.Duration
+}
+
+func (err ErrLoginLocked) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry after %s", err.RetryAfter)
+}
+
+// LockoutPolicy lets FreeAttempts failures within Window pass and then locks
+// the key for a delay that doubles with every further failure
+type LockoutPolicy struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Window       time.Duration
+}
+
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	return delay
+}
+
+type LoginGuardConfig struct {
+	PerLogin LockoutPolicy
+	PerIP    LockoutPolicy
+}
+
+// Retention is how long a login attempt can still affect a lockout
+func (c LoginGuardConfig) Retention() time.Duration {
+	if c.PerLogin.Window > c.PerIP.Window {
+		return c.PerLogin.Window
+	}
+
+	return c.PerIP.Window
 }
 
 type AuthenticateUserService struct {
-	store storage.Storage
+	sessionIssuer
+	guard LoginGuardConfig
 }
 
-func NewAuthenticateUserService(store storage.Storage) AuthenticateUserService {
-	return AuthenticateUserService{store: store}
+func NewAuthenticateUserService(store storage.Storage, keys auth.KeySet, guard LoginGuardConfig) AuthenticateUserService {
+	return AuthenticateUserService{
+		sessionIssuer: sessionIssuer{store: store, keys: keys},
+		guard:         guard,
+	}
 }
 
-func (srv AuthenticateUserService) Call(ctx context.Context, login, password string) (string, error) {
+// Call requires otp only from users with two-factor authentication enabled
+func (srv AuthenticateUserService) Call(ctx context.Context, login, password, otp, ip string) (auth.TokenPair, error) {
+	// no account can have a longer login, and such keys would not fit the
+	// login attempts table
+	if utf8.RuneCountInString(login) > validation.DefaultMaxLoginLength {
+		return auth.TokenPair{}, auth.ErrInvalidCreds
+	}
+	loginKey, ipKey := "login:"+login, "ip:"+ip
+	lockedUntil, err := srv.store.FindLoginLockout(ctx, []string{loginKey, ipKey})
+	if err != nil {
+		return auth.TokenPair{}, fmt.Errorf("failed to authenticate user: %w", err)
+	}
+	if retryAfter := time.Until(lockedUntil); retryAfter > 0 {
+		return auth.TokenPair{}, ErrLoginLocked{RetryAfter: retryAfter}
+	}
+
 	user, err := srv.store.FindUserByLogin(ctx, login)
 	if err != nil {
-		return "", fmt.Errorf("failed to authenticate user: %w", err)
+		var notFoundErr storage.ErrUserNotFound
+		if !errors.As(err, &notFoundErr) {
+			return auth.TokenPair{}, fmt.Errorf("failed to authenticate user: %w", err)
+		}
+		auth.SimulatePasswordCheck(password)
+		return auth.TokenPair{}, srv.recordFailure(ctx, auth.ErrInvalidCreds, loginKey, ipKey)
 	}
 
 	if !auth.ValidatePasswordHash(password, user.EncryptedPassword) {
-		return "", auth.ErrInvalidCreds
+		return auth.TokenPair{}, srv.recordFailure(ctx, auth.ErrInvalidCreds, loginKey, ipKey)
+	}
+	if user.TOTPEnabled {
+		if otp == "" {
+			return auth.TokenPair{}, ErrOTPRequired
+		}
+		if err = verifySecondFactor(ctx, srv.store, user, otp); err != nil {
+			if errors.Is(err, ErrInvalidOTP) {
+				return auth.TokenPair{}, srv.recordFailure(ctx, ErrInvalidOTP, loginKey, ipKey)
+			}
+			return auth.TokenPair{}, fmt.Errorf("failed to authenticate user: %w", err)
+		}
+	}
+
+	if err = srv.store.ResetLoginFailures(ctx, loginKey); err != nil {
+		return auth.TokenPair{}, fmt.Errorf("failed to authenticate user: %w", err)
 	}
 
-	jwtStr, err := auth.BuildJWTString(user)
+	tokens, err := srv.startWithRehash(ctx, user, password)
 	if err != nil {
-		return "", fmt.Errorf("failed to authenticate user: %w", err)
+		return auth.TokenPair{}, fmt.Errorf("failed to authenticate user: %w", err)
 	}
 
-	return jwtStr, nil
+	return tokens, nil
+}
+
+// recordFailure counts the failed attempt and returns cause unless the
+// attempt could not be recorded
+func (srv AuthenticateUserService) recordFailure(ctx context.Context, cause error, loginKey, ipKey string) error {
+	keys := []string{loginKey, ipKey}
+	policies := []LockoutPolicy{srv.guard.PerLogin, srv.guard.PerIP}
+	for i, key := range keys {
+		failures, err := srv.store.RecordLoginFailure(ctx, key, policies[i].Window)
+		if err != nil {
+			return fmt.Errorf("failed to authenticate user: %w", err)
+		}
+		if delay := policies[i].Delay(failures); delay > 0 {
+			if err = srv.store.LockLogin(ctx, key, time.Now().Add(delay)); err != nil {
+				return fmt.Errorf("failed to authenticate user: %w", err)
+			}
+		}
+	}
+
+	return cause
+}
+
+// startWithRehash upgrades a hash made with outdated parameters while the
+// plain password is at hand
+func (srv AuthenticateUserService) startWithRehash(ctx context.Context, user models.User, password string) (auth.TokenPair, error) {
+	familyID, err := auth.GenerateTokenFamilyID()
+	if err != nil {
+		return auth.TokenPair{}, err
+	}
+
+	var tokens auth.TokenPair
+	err = srv.store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		if auth.PasswordNeedsRehash(user.EncryptedPassword) {
+			encryptedPassword, err := auth.HashPassword(password)
+			if err != nil {
+				return err
+			}
+			// losing to a concurrent password change is fine, the session is
+			// still issued for the password that was just verified
+			_, err = srv.store.RehashUserPasswordTx(ctx, tx, user.ID, user.EncryptedPassword, encryptedPassword)
+			if err != nil {
+				return err
+			}
+		}
+
+		tokens, err = srv.issueTx(ctx, tx, user, familyID)
+		return err
+	})
+
+	return tokens, err
+}
+
+type LoginAttemptsCleaner interface {
+	Run()
+}
+
+type loginAttemptsCleaner struct {
+	store        storage.Storage
+	logger       *zap.Logger
+	retention    time.Duration
+	pollInterval time.Duration
+	exitCh       <-chan struct{}
+}
+
+// NewLoginAttemptsCleaner periodically drops login attempts older than the
+// guard's retention, otherwise a row is left behind for every login and IP
+// that has ever failed
+func NewLoginAttemptsCleaner(
+	store storage.Storage,
+	logger *zap.Logger,
+	guard LoginGuardConfig,
+	pollInterval time.Duration,
+	exitCh <-chan struct{}) LoginAttemptsCleaner {
+
+	return loginAttemptsCleaner{
+		store:        store,
+		logger:       logger,
+		retention:    guard.Retention(),
+		pollInterval: pollInterval,
+		exitCh:       exitCh,
+	}
+}
+
+func (cln loginAttemptsCleaner) Run() {
+	ticker := time.NewTicker(cln.pollInterval)
+	ctx := context.TODO()
+
+	for {
+		select {
+		case <-ticker.C:
+			cln.clean(ctx)
+		case <-cln.exitCh:
+			cln.logger.Info("finishing login attempts cleaner")
+			return
+		}
+	}
+}
+
+func (cln loginAttemptsCleaner) clean(ctx context.Context) {
+	deleted, err := cln.store.DeleteStaleLoginAttempts(ctx, cln.retention)
+	if err != nil {
+		cln.logger.Info("run login attempts cleaner", zap.Error(err))
+		return
+	}
+	if deleted > 0 {
+		cln.logger.Info("deleted stale login attempts", zap.Int64("count", deleted))
+	}
 }
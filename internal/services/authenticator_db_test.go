@@ -0,0 +1,88 @@
+package services_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ilya-burinskiy/gophermart/internal/auth"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRehashLosesToConcurrentPasswordChange(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+
+	ctx := context.Background()
+	store, err := storage.NewDBStorage(dsn)
+	require.NoError(t, err)
+	defer store.Close()
+
+	legacyHash, err := bcrypt.GenerateFromPassword([]byte("old password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user, err := store.CreateUser(ctx, fmt.Sprintf("rehashed-%d", time.Now().UnixNano()), string(legacyHash))
+	require.NoError(t, err)
+
+	// the password is reset after the login has read the legacy hash
+	resetHash, err := auth.HashPassword("new password")
+	require.NoError(t, err)
+	err = store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		return store.UpdateUserPasswordTx(ctx, tx, user.ID, resetHash)
+	})
+	require.NoError(t, err)
+
+	rehashedOld, err := auth.HashPassword("old password")
+	require.NoError(t, err)
+	var rehashed bool
+	err = store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		rehashed, err = store.RehashUserPasswordTx(ctx, tx, user.ID, string(legacyHash), rehashedOld)
+		return err
+	})
+	require.NoError(t, err)
+	assert.False(t, rehashed)
+
+	user, err = store.FindUserByLogin(ctx, user.Login)
+	require.NoError(t, err)
+	assert.True(t, auth.ValidatePasswordHash("new password", user.EncryptedPassword))
+	assert.False(t, auth.ValidatePasswordHash("old password", user.EncryptedPassword))
+}
+
+func TestDeleteStaleLoginAttempts(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+
+	ctx := context.Background()
+	store, err := storage.NewDBStorage(dsn)
+	require.NoError(t, err)
+	defer store.Close()
+
+	suffix := time.Now().UnixNano()
+	staleKey := fmt.Sprintf("login:stale-%d", suffix)
+	freshKey := fmt.Sprintf("login:fresh-%d", suffix)
+	_, err = store.RecordLoginFailure(ctx, staleKey, time.Hour)
+	require.NoError(t, err)
+	time.Sleep(time.Second)
+	_, err = store.RecordLoginFailure(ctx, freshKey, time.Hour)
+	require.NoError(t, err)
+
+	// only the first failure is older than the retention
+	_, err = store.DeleteStaleLoginAttempts(ctx, 500*time.Millisecond)
+	require.NoError(t, err)
+
+	failures, err := store.RecordLoginFailure(ctx, staleKey, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, failures)
+	failures, err = store.RecordLoginFailure(ctx, freshKey, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 2, failures)
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/ilya-burinskiy/gophermart/internal/auth"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/storage/mocks"
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLockoutPolicyDelay(t *testing.T) {
+	policy := LockoutPolicy{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	assert.Equal(t, time.Duration(0), policy.Delay(3))
+	assert.Equal(t, time.Second, policy.Delay(4))
+	assert.Equal(t, 2*time.Second, policy.Delay(5))
+	assert.Equal(t, 8*time.Second, policy.Delay(7))
+	assert.Equal(t, 10*time.Second, policy.Delay(8))
+	assert.Equal(t, 10*time.Second, policy.Delay(100))
+}
+
+func TestAuthenticateUserServiceCall(t *testing.T) {
+	keys, err := auth.NewKeySet(auth.NewHMACKey("test", []byte("secret")))
+	require.NoError(t, err)
+	hash, err := auth.HashPassword("password")
+	require.NoError(t, err)
+	user := models.User{ID: 1, Login: "login", EncryptedPassword: hash}
+	guard := LoginGuardConfig{
+		PerLogin: LockoutPolicy{FreeAttempts: 2, BaseDelay: time.Second, MaxDelay: time.Minute, Window: time.Hour},
+		PerIP:    LockoutPolicy{FreeAttempts: 10, BaseDelay: time.Second, MaxDelay: time.Minute, Window: time.Hour},
+	}
+	lockoutKeys := []string{"login:login", "ip:10.0.0.1"}
+
+	t.Run("rejects locked login without checking password", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		storageMock.EXPECT().FindLoginLockout(gomock.Any(), lockoutKeys).Return(time.Now().Add(time.Minute), nil)
+
+		_, err := NewAuthenticateUserService(storageMock, keys, guard).Call(context.Background(), "login", "password", "", "10.0.0.1")
+
+		var lockedErr ErrLoginLocked
+		require.True(t, errors.As(err, &lockedErr))
+		assert.Greater(t, lockedErr.RetryAfter, 50*time.Second)
+	})
+
+	t.Run("rejects too long login without lookup", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		login := strings.Repeat("a", validation.DefaultMaxLoginLength+1)
+
+		_, err := NewAuthenticateUserService(storageMock, keys, guard).Call(context.Background(), login, "password", "", "10.0.0.1")
+
+		assert.ErrorIs(t, err, auth.ErrInvalidCreds)
+	})
+
+	t.Run("records failure for unknown login", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		storageMock.EXPECT().FindLoginLockout(gomock.Any(), lockoutKeys).Return(time.Time{}, nil)
+		storageMock.EXPECT().FindUserByLogin(gomock.Any(), "login").Return(models.User{}, storage.ErrUserNotFound{})
+		storageMock.EXPECT().RecordLoginFailure(gomock.Any(), "login:login", time.Hour).Return(1, nil)
+		storageMock.EXPECT().RecordLoginFailure(gomock.Any(), "ip:10.0.0.1", time.Hour).Return(1, nil)
+
+		_, err := NewAuthenticateUserService(storageMock, keys, guard).Call(context.Background(), "login", "password", "", "10.0.0.1")
+
+		assert.ErrorIs(t, err, auth.ErrInvalidCreds)
+	})
+
+	t.Run("locks login after free attempts are exhausted", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		storageMock.EXPECT().FindLoginLockout(gomock.Any(), lockoutKeys).Return(time.Time{}, nil)
+		storageMock.EXPECT().FindUserByLogin(gomock.Any(), "login").Return(user, nil)
+		storageMock.EXPECT().RecordLoginFailure(gomock.Any(), "login:login", time.Hour).Return(3, nil)
+		storageMock.EXPECT().LockLogin(gomock.Any(), "login:login", gomock.Any()).Return(nil)
+		storageMock.EXPECT().RecordLoginFailure(gomock.Any(), "ip:10.0.0.1", time.Hour).Return(3, nil)
+
+		_, err := NewAuthenticateUserService(storageMock, keys, guard).Call(context.Background(), "login", "wrong", "", "10.0.0.1")
+
+		assert.ErrorIs(t, err, auth.ErrInvalidCreds)
+	})
+
+	t.Run("resets failures on success", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		txMock := mocks.NewMockTx(ctrl)
+		storageMock.EXPECT().FindLoginLockout(gomock.Any(), lockoutKeys).Return(time.Time{}, nil)
+		storageMock.EXPECT().FindUserByLogin(gomock.Any(), "login").Return(user, nil)
+		storageMock.EXPECT().ResetLoginFailures(gomock.Any(), "login:login").Return(nil)
+		storageMock.EXPECT().
+			WithinTranscaction(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, f func(context.Context, pgx.Tx) error) error {
+				return f(ctx, txMock)
+			})
+		storageMock.EXPECT().CreateRefreshTokenTx(gomock.Any(), txMock, gomock.Any()).Return(nil)
+
+		tokens, err := NewAuthenticateUserService(storageMock, keys, guard).Call(context.Background(), "login", "password", "", "10.0.0.1")
+
+		require.NoError(t, err)
+		claims, err := keys.ParseJWTString(tokens.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, claims.UserID)
+	})
+	t.Run("rehashes outdated password hash on success", func(t *testing.T) {
+		legacyHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+		require.NoError(t, err)
+		legacyUser := models.User{ID: 1, Login: "login", EncryptedPassword: string(legacyHash)}
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		txMock := mocks.NewMockTx(ctrl)
+		storageMock.EXPECT().FindLoginLockout(gomock.Any(), lockoutKeys).Return(time.Time{}, nil)
+		storageMock.EXPECT().FindUserByLogin(gomock.Any(), "login").Return(legacyUser, nil)
+		storageMock.EXPECT().ResetLoginFailures(gomock.Any(), "login:login").Return(nil)
+		expectTransaction(storageMock, txMock)
+		storageMock.EXPECT().
+			RehashUserPasswordTx(gomock.Any(), txMock, legacyUser.ID, legacyUser.EncryptedPassword, gomock.Any()).
+			DoAndReturn(func(ctx context.Context, tx pgx.Tx, userID int, oldHash, newHash string) (bool, error) {
+				assert.False(t, auth.PasswordNeedsRehash(newHash))
+				assert.True(t, auth.ValidatePasswordHash("password", newHash))
+				return true, nil
+			})
+		storageMock.EXPECT().CreateRefreshTokenTx(gomock.Any(), txMock, gomock.Any()).Return(nil)
+
+		_, err = NewAuthenticateUserService(storageMock, keys, guard).Call(context.Background(), "login", "password", "", "10.0.0.1")
+
+		require.NoError(t, err)
+	})
+	t.Run("keeps password changed concurrently with rehash", func(t *testing.T) {
+		legacyHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+		require.NoError(t, err)
+		legacyUser := models.User{ID: 1, Login: "login", EncryptedPassword: string(legacyHash)}
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		txMock := mocks.NewMockTx(ctrl)
+		storageMock.EXPECT().FindLoginLockout(gomock.Any(), lockoutKeys).Return(time.Time{}, nil)
+		storageMock.EXPECT().FindUserByLogin(gomock.Any(), "login").Return(legacyUser, nil)
+		storageMock.EXPECT().ResetLoginFailures(gomock.Any(), "login:login").Return(nil)
+		expectTransaction(storageMock, txMock)
+		storageMock.EXPECT().
+			RehashUserPasswordTx(gomock.Any(), txMock, legacyUser.ID, legacyUser.EncryptedPassword, gomock.Any()).
+			Return(false, nil)
+		storageMock.EXPECT().CreateRefreshTokenTx(gomock.Any(), txMock, gomock.Any()).Return(nil)
+
+		_, err = NewAuthenticateUserService(storageMock, keys, guard).Call(context.Background(), "login", "password", "", "10.0.0.1")
+
+		require.NoError(t, err)
+	})
+}
+
+func TestLoginAttemptsCleanerClean(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	storageMock := mocks.NewMockStorage(ctrl)
+	guard := LoginGuardConfig{
+		PerLogin: LockoutPolicy{Window: time.Hour},
+		PerIP:    LockoutPolicy{Window: 2 * time.Hour},
+	}
+	cleaner := NewLoginAttemptsCleaner(storageMock, zap.NewNop(), guard, time.Minute, nil).(loginAttemptsCleaner)
+
+	storageMock.EXPECT().DeleteStaleLoginAttempts(gomock.Any(), 2*time.Hour).Return(int64(3), nil)
+	cleaner.clean(context.Background())
+}
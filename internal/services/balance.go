@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+)
+
+type UserBalanceFetcher interface {
+	Call(ctx context.Context, userID int) (models.Balance, error)
+}
+
+type userBalanceFetcher struct {
+	store  storage.Storage
+	policy ExpiryPolicy
+}
+
+func NewUserBalanceFetcher(store storage.Storage, policy ExpiryPolicy) UserBalanceFetcher {
+	return userBalanceFetcher{
+		store:  store,
+		policy: policy,
+	}
+}
+
+// Call returns an empty balance for users that have not accrued anything yet
+func (f userBalanceFetcher) Call(ctx context.Context, userID int) (models.Balance, error) {
+	balance, err := f.store.FindBalanceByUserID(ctx, userID)
+	if err != nil {
+		var notFoundErr storage.ErrBalanceNotFound
+		if errors.As(err, &notFoundErr) {
+			return balance, nil
+		}
+		return balance, err
+	}
+	if !f.policy.Enabled() {
+		return balance, nil
+	}
+
+	balance.ExpiringSoon, err = f.store.ExpiringPoints(ctx, userID, f.policy.LifetimeMonths, f.policy.NoticePeriod)
+	if err != nil {
+		return balance, fmt.Errorf("failed to fetch balance: %w", err)
+	}
+
+	return balance, nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/ilya-burinskiy/gophermart/internal/models"
 	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
 )
 
 type OrderCreater interface {
@@ -40,7 +41,10 @@ func (err ErrConflicOrder) Error() string {
 }
 
 func (srv OrderCreateService) Call(ctx context.Context, number string, userID int) (models.Order, error) {
-	// TODO: add number validation
+	if err := validation.ValidateOrderNumber(number); err != nil {
+		return models.Order{}, err
+	}
+
 	order, err := srv.store.CreateOrder(
 		ctx,
 		userID,
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// ExpiryPolicy expires accrued points LifetimeMonths after the accrual, a
+// zero lifetime disables expiry. Points expiring within NoticePeriod are
+// reported to the user
+type ExpiryPolicy struct {
+	LifetimeMonths int
+	NoticePeriod   time.Duration
+}
+
+func (p ExpiryPolicy) Enabled() bool {
+	return p.LifetimeMonths > 0
+}
+
+type PointsExpirer interface {
+	Run()
+}
+
+type PointsExpirerConfig struct {
+	Policy       ExpiryPolicy
+	BatchSize    int
+	PollInterval time.Duration
+}
+
+type pointsExpirer struct {
+	store  storage.Storage
+	logger *zap.Logger
+	config PointsExpirerConfig
+	exitCh <-chan struct{}
+}
+
+func NewPointsExpirer(
+	store storage.Storage,
+	logger *zap.Logger,
+	config PointsExpirerConfig,
+	exitCh <-chan struct{}) PointsExpirer {
+
+	return pointsExpirer{
+		store:  store,
+		logger: logger,
+		config: config,
+		exitCh: exitCh,
+	}
+}
+
+func (exp pointsExpirer) Run() {
+	ticker := time.NewTicker(exp.config.PollInterval)
+	ctx := context.TODO()
+
+	for {
+		select {
+		case <-ticker.C:
+			userIDs, err := exp.store.UsersWithExpiredPoints(ctx, exp.config.Policy.LifetimeMonths, exp.config.BatchSize)
+			if err != nil {
+				exp.logger.Info("run points expirer", zap.Error(err))
+				continue
+			}
+
+			for _, userID := range userIDs {
+				if err = exp.expire(ctx, userID); err != nil {
+					exp.logger.Info("points expirer error", zap.Int("user_id", userID), zap.Error(err))
+				}
+			}
+		case <-exp.exitCh:
+			exp.logger.Info("finishing points expirer")
+			return
+		}
+	}
+}
+
+func (exp pointsExpirer) expire(ctx context.Context, userID int) error {
+	return exp.store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		amount, err := exp.store.ExpirePointLotsTx(ctx, tx, userID, exp.config.Policy.LifetimeMonths)
+		if err != nil {
+			return err
+		}
+		if amount == 0 {
+			return nil
+		}
+
+		if err = exp.store.DebitBalanceTx(ctx, tx, userID, amount); err != nil {
+			return fmt.Errorf("failed to debit expired points: %w", err)
+		}
+
+		return recordLedgerTx(ctx, exp.store, tx, models.ExpiryEntry, "", userID, -amount, models.ExpirationsAccount)
+	})
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/storage/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestPointsExpirerExpire(t *testing.T) {
+	policy := ExpiryPolicy{LifetimeMonths: 12, NoticePeriod: 30 * 24 * time.Hour}
+	testCases := []struct {
+		name    string
+		expired models.Money
+		expect  func(storageMock *mocks.MockStorage, txMock *mocks.MockTx)
+	}{
+		{
+			name:    "debits expired points",
+			expired: 1250,
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+				storageMock.EXPECT().DebitBalanceTx(gomock.Any(), txMock, 2, models.Money(1250)).Return(nil)
+				storageMock.EXPECT().
+					CreateLedgerTransactionTx(gomock.Any(), txMock, models.ExpiryEntry, "", []models.LedgerEntry{
+						{Account: models.UserAccount, UserID: 2, Amount: -1250},
+						{Account: models.ExpirationsAccount, Amount: 1250},
+					}).
+					Return(nil)
+			},
+		},
+		{
+			name:   "does nothing if lots were already expired",
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			storageMock := mocks.NewMockStorage(ctrl)
+			txMock := mocks.NewMockTx(ctrl)
+			expectTransaction(storageMock, txMock)
+			storageMock.EXPECT().ExpirePointLotsTx(gomock.Any(), txMock, 2, policy.LifetimeMonths).Return(tc.expired, nil)
+			tc.expect(storageMock, txMock)
+
+			exp := NewPointsExpirer(
+				storageMock,
+				zap.NewNop(),
+				PointsExpirerConfig{Policy: policy, BatchSize: 10, PollInterval: time.Minute},
+				nil,
+			).(pointsExpirer)
+			err := exp.expire(context.Background(), 2)
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestUserBalanceFetcherCall(t *testing.T) {
+	notice := 30 * 24 * time.Hour
+	testCases := []struct {
+		name   string
+		policy ExpiryPolicy
+		expect func(storageMock *mocks.MockStorage)
+		want   models.Balance
+	}{
+		{
+			name:   "reports points expiring soon",
+			policy: ExpiryPolicy{LifetimeMonths: 12, NoticePeriod: notice},
+			expect: func(storageMock *mocks.MockStorage) {
+				storageMock.EXPECT().
+					FindBalanceByUserID(gomock.Any(), 2).
+					Return(models.Balance{ID: 1, UserID: 2, CurrentAmount: 5000}, nil)
+				storageMock.EXPECT().ExpiringPoints(gomock.Any(), 2, 12, notice).Return(models.Money(1250), nil)
+			},
+			want: models.Balance{ID: 1, UserID: 2, CurrentAmount: 5000, ExpiringSoon: 1250},
+		},
+		{
+			name:   "does not look for expiring points if expiry is disabled",
+			policy: ExpiryPolicy{NoticePeriod: notice},
+			expect: func(storageMock *mocks.MockStorage) {
+				storageMock.EXPECT().
+					FindBalanceByUserID(gomock.Any(), 2).
+					Return(models.Balance{ID: 1, UserID: 2, CurrentAmount: 5000}, nil)
+			},
+			want: models.Balance{ID: 1, UserID: 2, CurrentAmount: 5000},
+		},
+		{
+			name:   "returns empty balance if user has none",
+			policy: ExpiryPolicy{LifetimeMonths: 12, NoticePeriod: notice},
+			expect: func(storageMock *mocks.MockStorage) {
+				storageMock.EXPECT().
+					FindBalanceByUserID(gomock.Any(), 2).
+					Return(models.Balance{UserID: 2}, storage.ErrBalanceNotFound{Balance: models.Balance{UserID: 2}})
+			},
+			want: models.Balance{UserID: 2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			storageMock := mocks.NewMockStorage(ctrl)
+			tc.expect(storageMock)
+
+			balance, err := NewUserBalanceFetcher(storageMock, tc.policy).Call(context.Background(), 2)
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, balance)
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+type UserBalanceHistoryFetcher interface {
+	Call(ctx context.Context, userID int) ([]models.LedgerEntry, error)
+}
+
+type userBalanceHistoryFetcher struct {
+	store storage.Storage
+}
+
+func NewUserBalanceHistoryFetcher(store storage.Storage) UserBalanceHistoryFetcher {
+	return userBalanceHistoryFetcher{
+		store: store,
+	}
+}
+
+func (f userBalanceHistoryFetcher) Call(ctx context.Context, userID int) ([]models.LedgerEntry, error) {
+	return f.store.UserLedgerEntries(ctx, userID)
+}
+
+func recordLedgerTx(
+	ctx context.Context,
+	store storage.Storage,
+	tx pgx.Tx,
+	kind models.LedgerEntryKind,
+	orderNumber string,
+	userID int,
+	amount models.Money,
+	counterAccount models.LedgerAccount) error {
+
+	err := store.CreateLedgerTransactionTx(ctx, tx, kind, orderNumber, []models.LedgerEntry{
+		{Account: models.UserAccount, UserID: userID, Amount: amount},
+		{Account: counterAccount, Amount: -amount},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record ledger transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ilya-burinskiy/gophermart/internal/auth"
+	"github.com/ilya-burinskiy/gophermart/internal/configs"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/notify"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+type PasswordChanger interface {
+	Call(ctx context.Context, userID int, currentPassword, newPassword string) (auth.TokenPair, error)
+}
+
+type PasswordResetRequester interface {
+	Call(ctx context.Context, login string) error
+}
+
+type PasswordResetter interface {
+	Call(ctx context.Context, token, newPassword string) error
+}
+
+type passwordChanger struct {
+	sessionIssuer
+	policy validation.CredentialsPolicy
+}
+
+type passwordResetRequester struct {
+	store    storage.Storage
+	notifier notify.Notifier
+	logger   *zap.Logger
+}
+
+type passwordResetter struct {
+	store  storage.Storage
+	policy validation.CredentialsPolicy
+}
+
+func NewPasswordChanger(store storage.Storage, keys auth.KeySet, policy validation.CredentialsPolicy) PasswordChanger {
+	return passwordChanger{
+		sessionIssuer: sessionIssuer{store: store, keys: keys},
+		policy:        policy,
+	}
+}
+
+func NewPasswordResetRequester(store storage.Storage, notifier notify.Notifier, logger *zap.Logger) PasswordResetRequester {
+	return passwordResetRequester{
+		store:    store,
+		notifier: notifier,
+		logger:   logger,
+	}
+}
+
+func NewPasswordResetter(store storage.Storage, policy validation.CredentialsPolicy) PasswordResetter {
+	return passwordResetter{
+		store:  store,
+		policy: policy,
+	}
+}
+
+// Call replaces the password, revokes every session of the user and starts a
+// new one for the caller. API keys are kept: the caller knows the current
+// password, and keys are revoked one by one
+func (c passwordChanger) Call(ctx context.Context, userID int, currentPassword, newPassword string) (auth.TokenPair, error) {
+	user, err := c.store.FindUserByID(ctx, userID)
+	if err != nil {
+		return auth.TokenPair{}, fmt.Errorf("failed to change password: %w", err)
+	}
+	if !auth.ValidatePasswordHash(currentPassword, user.EncryptedPassword) {
+		return auth.TokenPair{}, auth.ErrInvalidCreds
+	}
+	if err = c.policy.Validate(user.Login, newPassword); err != nil {
+		return auth.TokenPair{}, err
+	}
+
+	encryptedPassword, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return auth.TokenPair{}, fmt.Errorf("failed to change password: %w", err)
+	}
+	familyID, err := auth.GenerateTokenFamilyID()
+	if err != nil {
+		return auth.TokenPair{}, fmt.Errorf("failed to change password: %w", err)
+	}
+
+	var tokens auth.TokenPair
+	err = c.store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		if err := c.store.UpdateUserPasswordTx(ctx, tx, user.ID, encryptedPassword); err != nil {
+			return err
+		}
+		if err := c.store.RevokeUserRefreshTokensTx(ctx, tx, user.ID); err != nil {
+			return err
+		}
+
+		tokens, err = c.issueTx(ctx, tx, user, familyID)
+		return err
+	})
+	if err != nil {
+		return auth.TokenPair{}, fmt.Errorf("failed to change password: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// Call does not report unknown logins so that the endpoint cannot be used to
+// find out which logins are registered. The token is issued in background,
+// otherwise the response time would still tell registered logins apart
+func (r passwordResetRequester) Call(ctx context.Context, login string) error {
+	user, err := r.store.FindUserByLogin(ctx, login)
+	if err != nil {
+		var notFoundErr storage.ErrUserNotFound
+		if errors.As(err, &notFoundErr) {
+			return nil
+		}
+		return fmt.Errorf("failed to request password reset: %w", err)
+	}
+
+	go func() {
+		if err := r.issueToken(context.Background(), user); err != nil {
+			r.logger.Info("password reset requester error", zap.Int("user_id", user.ID), zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+func (r passwordResetRequester) issueToken(ctx context.Context, user models.User) error {
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("failed to request password reset: %w", err)
+	}
+	expiresAt := time.Now().Add(configs.PasswordResetTokenExp)
+	if err = r.store.CreatePasswordResetToken(ctx, user.ID, auth.HashOpaqueToken(token), expiresAt); err != nil {
+		return fmt.Errorf("failed to request password reset: %w", err)
+	}
+	if err = r.notifier.NotifyPasswordReset(ctx, user, token, expiresAt); err != nil {
+		return fmt.Errorf("failed to request password reset: %w", err)
+	}
+
+	return nil
+}
+
+func (r passwordResetter) Call(ctx context.Context, token, newPassword string) error {
+	err := r.store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		userID, err := r.store.UsePasswordResetTokenTx(ctx, tx, auth.HashOpaqueToken(token))
+		if err != nil {
+			var notFoundErr storage.ErrPasswordResetTokenNotFound
+			if errors.As(err, &notFoundErr) {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+
+		user, err := r.store.FindUserByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if err = r.policy.Validate(user.Login, newPassword); err != nil {
+			return err
+		}
+		encryptedPassword, err := auth.HashPassword(newPassword)
+		if err != nil {
+			return err
+		}
+		if err = r.store.UpdateUserPasswordTx(ctx, tx, user.ID, encryptedPassword); err != nil {
+			return err
+		}
+
+		if err = r.store.RevokeUserRefreshTokensTx(ctx, tx, user.ID); err != nil {
+			return err
+		}
+
+		// unlike a password change, a reset is how a compromised account is
+		// recovered, so API keys issued by whoever had access go as well
+		return r.store.RevokeUserAPIKeysTx(ctx, tx, user.ID)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reset password: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/ilya-burinskiy/gophermart/internal/auth"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/storage/mocks"
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type notifierStub struct {
+	user  models.User
+	token string
+	sent  chan struct{}
+}
+
+func (n *notifierStub) NotifyPasswordReset(ctx context.Context, user models.User, token string, expiresAt time.Time) error {
+	n.user = user
+	n.token = token
+	if n.sent != nil {
+		close(n.sent)
+	}
+	return nil
+}
+
+func expectTransaction(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+	storageMock.EXPECT().
+		WithinTranscaction(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, f func(context.Context, pgx.Tx) error) error {
+			return f(ctx, txMock)
+		})
+}
+
+func TestPasswordChangerCall(t *testing.T) {
+	keys, err := auth.NewKeySet(auth.NewHMACKey("test", []byte("secret")))
+	require.NoError(t, err)
+	policy, err := validation.NewCredentialsPolicy(0, "")
+	require.NoError(t, err)
+	hash, err := auth.HashPassword("old password")
+	require.NoError(t, err)
+	user := models.User{ID: 1, Login: "login", EncryptedPassword: hash}
+
+	t.Run("rejects wrong current password", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		storageMock.EXPECT().FindUserByID(gomock.Any(), user.ID).Return(user, nil)
+
+		_, err := NewPasswordChanger(storageMock, keys, policy).Call(context.Background(), user.ID, "wrong", "new password")
+
+		assert.ErrorIs(t, err, auth.ErrInvalidCreds)
+	})
+
+	t.Run("rejects new password violating policy", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		storageMock.EXPECT().FindUserByID(gomock.Any(), user.ID).Return(user, nil)
+
+		_, err := NewPasswordChanger(storageMock, keys, policy).Call(context.Background(), user.ID, "old password", "short")
+
+		var invalidErr validation.ErrInvalidCredentials
+		assert.True(t, errors.As(err, &invalidErr))
+	})
+
+	t.Run("updates password and revokes other sessions", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		txMock := mocks.NewMockTx(ctrl)
+		storageMock.EXPECT().FindUserByID(gomock.Any(), user.ID).Return(user, nil)
+		expectTransaction(storageMock, txMock)
+		storageMock.EXPECT().
+			UpdateUserPasswordTx(gomock.Any(), txMock, user.ID, gomock.Any()).
+			DoAndReturn(func(ctx context.Context, tx pgx.Tx, userID int, encryptedPassword string) error {
+				assert.True(t, auth.ValidatePasswordHash("new password", encryptedPassword))
+				return nil
+			})
+		revoke := storageMock.EXPECT().RevokeUserRefreshTokensTx(gomock.Any(), txMock, user.ID).Return(nil)
+		storageMock.EXPECT().CreateRefreshTokenTx(gomock.Any(), txMock, gomock.Any()).Return(nil).After(revoke)
+
+		tokens, err := NewPasswordChanger(storageMock, keys, policy).Call(context.Background(), user.ID, "old password", "new password")
+
+		require.NoError(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.NotEmpty(t, tokens.RefreshToken)
+	})
+}
+
+func TestPasswordResetFlow(t *testing.T) {
+	policy, err := validation.NewCredentialsPolicy(0, "")
+	require.NoError(t, err)
+	user := models.User{ID: 1, Login: "login"}
+
+	t.Run("does not reveal unknown login", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		storageMock.EXPECT().FindUserByLogin(gomock.Any(), "unknown").Return(models.User{}, storage.ErrUserNotFound{})
+		notifier := &notifierStub{}
+
+		err := NewPasswordResetRequester(storageMock, notifier, zap.NewNop()).Call(context.Background(), "unknown")
+
+		assert.NoError(t, err)
+		assert.Empty(t, notifier.token)
+	})
+
+	t.Run("stores hashed token and notifies user", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		notifier := &notifierStub{sent: make(chan struct{})}
+		var storedHash string
+		storageMock.EXPECT().FindUserByLogin(gomock.Any(), user.Login).Return(user, nil)
+		storageMock.EXPECT().
+			CreatePasswordResetToken(gomock.Any(), user.ID, gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+				storedHash = tokenHash
+				return nil
+			})
+
+		err := NewPasswordResetRequester(storageMock, notifier, zap.NewNop()).Call(context.Background(), user.Login)
+
+		require.NoError(t, err)
+		select {
+		case <-notifier.sent:
+		case <-time.After(time.Second):
+			require.FailNow(t, "user was not notified")
+		}
+		assert.Equal(t, user, notifier.user)
+		assert.Equal(t, auth.HashOpaqueToken(notifier.token), storedHash)
+	})
+
+	t.Run("rejects used or expired token", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		txMock := mocks.NewMockTx(ctrl)
+		expectTransaction(storageMock, txMock)
+		storageMock.EXPECT().
+			UsePasswordResetTokenTx(gomock.Any(), txMock, auth.HashOpaqueToken("token")).
+			Return(0, storage.ErrPasswordResetTokenNotFound{})
+
+		err := NewPasswordResetter(storageMock, policy).Call(context.Background(), "token", "new password")
+
+		assert.ErrorIs(t, err, ErrInvalidResetToken)
+	})
+
+	t.Run("resets password and revokes sessions and api keys", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		txMock := mocks.NewMockTx(ctrl)
+		expectTransaction(storageMock, txMock)
+		storageMock.EXPECT().
+			UsePasswordResetTokenTx(gomock.Any(), txMock, auth.HashOpaqueToken("token")).
+			Return(user.ID, nil)
+		storageMock.EXPECT().FindUserByID(gomock.Any(), user.ID).Return(user, nil)
+		storageMock.EXPECT().UpdateUserPasswordTx(gomock.Any(), txMock, user.ID, gomock.Any()).Return(nil)
+		storageMock.EXPECT().RevokeUserRefreshTokensTx(gomock.Any(), txMock, user.ID).Return(nil)
+		storageMock.EXPECT().RevokeUserAPIKeysTx(gomock.Any(), txMock, user.ID).Return(nil)
+
+		err := NewPasswordResetter(storageMock, policy).Call(context.Background(), "token", "new password")
+
+		assert.NoError(t, err)
+	})
+}
@@ -6,35 +6,44 @@ import (
 
 	"github.com/ilya-burinskiy/gophermart/internal/auth"
 	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
 )
 
 type UserRegistrator interface {
-	Call(ctx context.Context, login, password string) (string, error)
+	Call(ctx context.Context, login, password string) (auth.TokenPair, error)
 }
 
 type RegisterUserService struct {
-	store storage.Storage
+	sessionIssuer
+	policy validation.CredentialsPolicy
 }
 
-func NewRegisterUserService(store storage.Storage) RegisterUserService {
-	return RegisterUserService{store: store}
+func NewRegisterUserService(store storage.Storage, keys auth.KeySet, policy validation.CredentialsPolicy) RegisterUserService {
+	return RegisterUserService{
+		sessionIssuer: sessionIssuer{store: store, keys: keys},
+		policy:        policy,
+	}
 }
 
-func (srv RegisterUserService) Call(ctx context.Context, login, password string) (string, error) {
+func (srv RegisterUserService) Call(ctx context.Context, login, password string) (auth.TokenPair, error) {
+	if err := srv.policy.Validate(login, password); err != nil {
+		return auth.TokenPair{}, err
+	}
+
 	encryptedPassword, err := auth.HashPassword(password)
 	if err != nil {
-		return "", fmt.Errorf("failed to register user: %w", err)
+		return auth.TokenPair{}, fmt.Errorf("failed to register user: %w", err)
 	}
 
 	user, err := srv.store.CreateUser(ctx, login, encryptedPassword)
 	if err != nil {
-		return "", fmt.Errorf("failed to register user: %w", err)
+		return auth.TokenPair{}, fmt.Errorf("failed to register user: %w", err)
 	}
 
-	jwtStr, err := auth.BuildJWTString(user)
+	tokens, err := srv.start(ctx, user)
 	if err != nil {
-		return "", fmt.Errorf("failed to register user: %w", err)
+		return auth.TokenPair{}, fmt.Errorf("failed to register user: %w", err)
 	}
 
-	return jwtStr, nil
+	return tokens, nil
 }
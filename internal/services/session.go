@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ilya-burinskiy/gophermart/internal/auth"
+	"github.com/ilya-burinskiy/gophermart/internal/configs"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+type TokenRefresher interface {
+	Call(ctx context.Context, refreshToken string) (auth.TokenPair, error)
+}
+
+type SessionTerminator interface {
+	Call(ctx context.Context, refreshToken string) error
+}
+
+type sessionIssuer struct {
+	store storage.Storage
+	keys  auth.KeySet
+}
+
+type tokenRefresher struct {
+	sessionIssuer
+}
+
+type sessionTerminator struct {
+	store storage.Storage
+}
+
+func NewTokenRefresher(store storage.Storage, keys auth.KeySet) TokenRefresher {
+	return tokenRefresher{
+		sessionIssuer: sessionIssuer{store: store, keys: keys},
+	}
+}
+
+func NewSessionTerminator(store storage.Storage) SessionTerminator {
+	return sessionTerminator{
+		store: store,
+	}
+}
+
+func (i sessionIssuer) start(ctx context.Context, user models.User) (auth.TokenPair, error) {
+	familyID, err := auth.GenerateTokenFamilyID()
+	if err != nil {
+		return auth.TokenPair{}, err
+	}
+
+	var tokens auth.TokenPair
+	err = i.store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		tokens, err = i.issueTx(ctx, tx, user, familyID)
+		return err
+	})
+
+	return tokens, err
+}
+
+func (i sessionIssuer) issueTx(ctx context.Context, tx pgx.Tx, user models.User, familyID string) (auth.TokenPair, error) {
+	accessToken, err := i.keys.BuildJWTString(user)
+	if err != nil {
+		return auth.TokenPair{}, err
+	}
+	refreshToken, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return auth.TokenPair{}, err
+	}
+
+	err = i.store.CreateRefreshTokenTx(ctx, tx, models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: auth.HashOpaqueToken(refreshToken),
+		ExpiresAt: time.Now().Add(configs.RefreshTokenExp),
+	})
+	if err != nil {
+		return auth.TokenPair{}, err
+	}
+
+	return auth.TokenPair{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+func (r tokenRefresher) Call(ctx context.Context, refreshToken string) (auth.TokenPair, error) {
+	var (
+		tokens auth.TokenPair
+		reused bool
+	)
+	err := r.store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		token, err := findRefreshTokenTx(ctx, r.store, tx, refreshToken)
+		if err != nil {
+			return err
+		}
+		if token.RevokedAt != nil || token.ExpiresAt.Before(time.Now()) {
+			return auth.ErrInvalidRefreshToken
+		}
+		if token.UsedAt != nil {
+			// a rotated token is presented again, so either the client or an
+			// attacker holds a stolen copy and the whole session is revoked
+			reused = true
+			return r.store.RevokeRefreshTokenFamilyTx(ctx, tx, token.FamilyID)
+		}
+
+		if err = r.store.MarkRefreshTokenUsedTx(ctx, tx, token.ID); err != nil {
+			return err
+		}
+		tokens, err = r.issueTx(ctx, tx, models.User{ID: token.UserID}, token.FamilyID)
+		return err
+	})
+	if err != nil {
+		return auth.TokenPair{}, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	if reused {
+		return auth.TokenPair{}, fmt.Errorf("failed to refresh token: %w", auth.ErrRefreshTokenReused)
+	}
+
+	return tokens, nil
+}
+
+func (t sessionTerminator) Call(ctx context.Context, refreshToken string) error {
+	err := t.store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		token, err := findRefreshTokenTx(ctx, t.store, tx, refreshToken)
+		if err != nil {
+			return err
+		}
+
+		return t.store.RevokeRefreshTokenFamilyTx(ctx, tx, token.FamilyID)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to log out: %w", err)
+	}
+
+	return nil
+}
+
+func findRefreshTokenTx(ctx context.Context, store storage.Storage, tx pgx.Tx, refreshToken string) (models.RefreshToken, error) {
+	token, err := store.FindRefreshTokenTx(ctx, tx, auth.HashOpaqueToken(refreshToken))
+	if err != nil {
+		var notFoundErr storage.ErrRefreshTokenNotFound
+		if errors.As(err, &notFoundErr) {
+			return token, auth.ErrInvalidRefreshToken
+		}
+		return token, err
+	}
+
+	return token, nil
+}
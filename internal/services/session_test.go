@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/ilya-burinskiy/gophermart/internal/auth"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/storage/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenRefresherCall(t *testing.T) {
+	keys, err := auth.NewKeySet(auth.NewHMACKey("test", []byte("secret")))
+	require.NoError(t, err)
+	now := time.Now()
+	testCases := []struct {
+		name        string
+		token       models.RefreshToken
+		findErr     error
+		wantRotate  bool
+		wantRevoke  bool
+		expectedErr error
+	}{
+		{
+			name:       "rotates valid token",
+			token:      models.RefreshToken{ID: 1, UserID: 2, FamilyID: "family", ExpiresAt: now.Add(time.Hour)},
+			wantRotate: true,
+		},
+		{
+			name:        "rejects unknown token",
+			findErr:     storage.ErrRefreshTokenNotFound{},
+			expectedErr: auth.ErrInvalidRefreshToken,
+		},
+		{
+			name:        "rejects expired token",
+			token:       models.RefreshToken{ID: 1, UserID: 2, FamilyID: "family", ExpiresAt: now.Add(-time.Hour)},
+			expectedErr: auth.ErrInvalidRefreshToken,
+		},
+		{
+			name:        "rejects revoked token",
+			token:       models.RefreshToken{ID: 1, UserID: 2, FamilyID: "family", ExpiresAt: now.Add(time.Hour), RevokedAt: &now},
+			expectedErr: auth.ErrInvalidRefreshToken,
+		},
+		{
+			name:        "revokes family on reuse",
+			token:       models.RefreshToken{ID: 1, UserID: 2, FamilyID: "family", ExpiresAt: now.Add(time.Hour), UsedAt: &now},
+			wantRevoke:  true,
+			expectedErr: auth.ErrRefreshTokenReused,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			storageMock := mocks.NewMockStorage(ctrl)
+			txMock := mocks.NewMockTx(ctrl)
+			storageMock.EXPECT().
+				WithinTranscaction(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, f func(context.Context, pgx.Tx) error) error {
+					return f(ctx, txMock)
+				})
+			storageMock.EXPECT().
+				FindRefreshTokenTx(gomock.Any(), txMock, auth.HashOpaqueToken("token")).
+				Return(tc.token, tc.findErr)
+			if tc.wantRotate {
+				storageMock.EXPECT().MarkRefreshTokenUsedTx(gomock.Any(), txMock, tc.token.ID).Return(nil)
+				storageMock.EXPECT().
+					CreateRefreshTokenTx(gomock.Any(), txMock, gomock.Any()).
+					DoAndReturn(func(ctx context.Context, tx pgx.Tx, token models.RefreshToken) error {
+						assert.Equal(t, tc.token.UserID, token.UserID)
+						assert.Equal(t, tc.token.FamilyID, token.FamilyID)
+						return nil
+					})
+			}
+			if tc.wantRevoke {
+				storageMock.EXPECT().RevokeRefreshTokenFamilyTx(gomock.Any(), txMock, tc.token.FamilyID).Return(nil)
+			}
+
+			tokens, err := NewTokenRefresher(storageMock, keys).Call(context.Background(), "token")
+			if tc.expectedErr != nil {
+				assert.True(t, errors.Is(err, tc.expectedErr))
+				return
+			}
+			require.NoError(t, err)
+			assert.NotEqual(t, "token", tokens.RefreshToken)
+			claims, err := keys.ParseJWTString(tokens.AccessToken)
+			require.NoError(t, err)
+			assert.Equal(t, tc.token.UserID, claims.UserID)
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/settlement"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+type SettlementWorker interface {
+	Run()
+}
+
+type SettlementWorkerConfig struct {
+	InstanceID    string
+	WorkersNum    int
+	PollInterval  time.Duration
+	LeaseDuration time.Duration
+	RetryPolicy   RetryPolicy
+}
+
+type settlementWorker struct {
+	client settlement.ApiClient
+	store  storage.Storage
+	logger *zap.Logger
+	config SettlementWorkerConfig
+	exitCh <-chan struct{}
+}
+
+// NewSettlementWorker polls the payment partner for pending withdrawals.
+// Unlike orders, withdrawals are never given up on after RetryPolicy's
+// MaxAttempts: releasing points the partner might have accepted is not safe,
+// so they are only released when the partner rejects the withdrawal
+func NewSettlementWorker(
+	client settlement.ApiClient,
+	store storage.Storage,
+	logger *zap.Logger,
+	config SettlementWorkerConfig,
+	exitCh <-chan struct{}) SettlementWorker {
+
+	return settlementWorker{
+		client: client,
+		store:  store,
+		logger: logger,
+		config: config,
+		exitCh: exitCh,
+	}
+}
+
+func (wrk settlementWorker) Run() {
+	jobsChannel := make(chan models.Withdrawal, wrk.config.WorkersNum)
+	ticker := time.NewTicker(wrk.config.PollInterval)
+	ctx := context.TODO()
+
+	for w := 1; w <= wrk.config.WorkersNum; w++ {
+		go wrk.processWithdrawal(jobsChannel)
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			withdrawals, err := wrk.store.ClaimWithdrawals(
+				ctx,
+				wrk.config.InstanceID,
+				wrk.config.WorkersNum,
+				wrk.config.LeaseDuration,
+			)
+			if err != nil {
+				wrk.logger.Info("run settlement worker", zap.Error(err))
+				continue
+			}
+
+			for _, withdrawal := range withdrawals {
+				jobsChannel <- withdrawal
+			}
+		case <-wrk.exitCh:
+			wrk.logger.Info("finishing settlement worker")
+			close(jobsChannel)
+			return
+		}
+	}
+}
+
+func (wrk settlementWorker) processWithdrawal(jobsChannel <-chan models.Withdrawal) {
+	ctx := context.TODO()
+	for withdrawal := range jobsChannel {
+		status, err := wrk.client.Settle(ctx, withdrawal)
+		if err != nil {
+			wrk.logger.Info("settlement worker error", zap.Error(err))
+			if err = wrk.recordFailure(ctx, withdrawal, err); err != nil {
+				wrk.logger.Info("settlement worker error", zap.Error(err))
+			}
+			continue
+		}
+
+		switch status {
+		case settlement.Pending:
+			err = wrk.store.RescheduleWithdrawal(
+				ctx,
+				withdrawal.ID,
+				wrk.config.InstanceID,
+				time.Now().Add(wrk.config.PollInterval),
+			)
+		case settlement.Confirmed:
+			err = wrk.confirm(ctx, withdrawal)
+		case settlement.Rejected:
+			err = wrk.release(ctx, withdrawal)
+		}
+		if err != nil {
+			wrk.logger.Info("settlement worker error", zap.Error(err))
+		}
+	}
+}
+
+func (wrk settlementWorker) recordFailure(ctx context.Context, withdrawal models.Withdrawal, cause error) error {
+	attempts := withdrawal.Attempts + 1
+	if attempts == wrk.config.RetryPolicy.MaxAttempts {
+		wrk.logger.Warn(
+			"withdrawal settlement keeps failing",
+			zap.String("number", withdrawal.OrderNumber),
+			zap.Int("attempts", attempts),
+			zap.Error(cause),
+		)
+	}
+
+	return wrk.store.RecordWithdrawalFailure(
+		ctx,
+		withdrawal.ID,
+		wrk.config.InstanceID,
+		cause.Error(),
+		time.Now().Add(wrk.config.RetryPolicy.Backoff(attempts)),
+	)
+}
+
+// confirm moves the held points to the spent ones
+func (wrk settlementWorker) confirm(ctx context.Context, withdrawal models.Withdrawal) error {
+	return wrk.store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		settled, err := wrk.store.SettleWithdrawalTx(ctx, tx, withdrawal.ID, models.ConfirmedWithdrawal)
+		if err != nil {
+			return fmt.Errorf("failed to confirm withdrawal: %w", err)
+		}
+		if !settled {
+			return nil
+		}
+
+		if err = wrk.store.SpendHeldBalanceTx(ctx, tx, withdrawal.UserID, withdrawal.Sum); err != nil {
+			return fmt.Errorf("failed to spend held points: %w", err)
+		}
+		err = wrk.store.CreateLedgerTransactionTx(ctx, tx, models.SettlementEntry, withdrawal.OrderNumber, []models.LedgerEntry{
+			{Account: models.HoldsAccount, Amount: -withdrawal.Sum},
+			{Account: models.WithdrawalsAccount, Amount: withdrawal.Sum},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record ledger transaction: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// release returns the held points to the user's balance
+func (wrk settlementWorker) release(ctx context.Context, withdrawal models.Withdrawal) error {
+	return wrk.store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		settled, err := wrk.store.SettleWithdrawalTx(ctx, tx, withdrawal.ID, models.FailedWithdrawal)
+		if err != nil {
+			return fmt.Errorf("failed to fail withdrawal: %w", err)
+		}
+		if !settled {
+			return nil
+		}
+
+		if err = wrk.store.ReleaseHeldBalanceTx(ctx, tx, withdrawal.UserID, withdrawal.Sum); err != nil {
+			return fmt.Errorf("failed to release held points: %w", err)
+		}
+		err = wrk.store.RestorePointLotsTx(ctx, tx, withdrawal.UserID, withdrawal.OrderNumber, withdrawal.Sum)
+		if err != nil {
+			return fmt.Errorf("failed to restore point lots: %w", err)
+		}
+
+		return recordLedgerTx(
+			ctx,
+			wrk.store,
+			tx,
+			models.ReleaseEntry,
+			withdrawal.OrderNumber,
+			withdrawal.UserID,
+			withdrawal.Sum,
+			models.HoldsAccount,
+		)
+	})
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/settlement"
+	"github.com/ilya-burinskiy/gophermart/internal/storage/mocks"
+	"go.uber.org/zap"
+)
+
+type settlementClientStub struct {
+	status settlement.Status
+	err    error
+}
+
+func (c settlementClientStub) Settle(ctx context.Context, withdrawal models.Withdrawal) (settlement.Status, error) {
+	return c.status, c.err
+}
+
+func newTestSettlementWorker(client settlement.ApiClient, storageMock *mocks.MockStorage) settlementWorker {
+	return NewSettlementWorker(
+		client,
+		storageMock,
+		zap.NewNop(),
+		SettlementWorkerConfig{
+			InstanceID:   "instance",
+			WorkersNum:   1,
+			PollInterval: time.Second,
+			RetryPolicy:  RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute},
+		},
+		nil,
+	).(settlementWorker)
+}
+
+func TestSettlementWorkerProcessWithdrawal(t *testing.T) {
+	withdrawal := models.Withdrawal{ID: 1, UserID: 2, OrderNumber: "12345", Sum: 500, Status: models.PendingWithdrawal}
+	testCases := []struct {
+		name   string
+		client settlementClientStub
+		expect func(storageMock *mocks.MockStorage, txMock *mocks.MockTx)
+	}{
+		{
+			name:   "keeps polling pending withdrawal",
+			client: settlementClientStub{status: settlement.Pending},
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+				storageMock.EXPECT().
+					RescheduleWithdrawal(gomock.Any(), withdrawal.ID, "instance", gomock.Any()).
+					Return(nil)
+			},
+		},
+		{
+			name:   "schedules retry on client error",
+			client: settlementClientStub{err: errors.New("service is unavailable")},
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+				storageMock.EXPECT().
+					RecordWithdrawalFailure(gomock.Any(), withdrawal.ID, "instance", "service is unavailable", gomock.Any()).
+					Return(nil)
+			},
+		},
+		{
+			name:   "spends held points of confirmed withdrawal",
+			client: settlementClientStub{status: settlement.Confirmed},
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+				expectTransaction(storageMock, txMock)
+				storageMock.EXPECT().
+					SettleWithdrawalTx(gomock.Any(), txMock, withdrawal.ID, models.ConfirmedWithdrawal).
+					Return(true, nil)
+				storageMock.EXPECT().
+					SpendHeldBalanceTx(gomock.Any(), txMock, withdrawal.UserID, withdrawal.Sum).
+					Return(nil)
+				storageMock.EXPECT().
+					CreateLedgerTransactionTx(
+						gomock.Any(),
+						txMock,
+						models.SettlementEntry,
+						withdrawal.OrderNumber,
+						[]models.LedgerEntry{
+							{Account: models.HoldsAccount, Amount: -withdrawal.Sum},
+							{Account: models.WithdrawalsAccount, Amount: withdrawal.Sum},
+						},
+					).
+					Return(nil)
+			},
+		},
+		{
+			name:   "releases held points of rejected withdrawal",
+			client: settlementClientStub{status: settlement.Rejected},
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+				expectTransaction(storageMock, txMock)
+				storageMock.EXPECT().
+					SettleWithdrawalTx(gomock.Any(), txMock, withdrawal.ID, models.FailedWithdrawal).
+					Return(true, nil)
+				storageMock.EXPECT().
+					ReleaseHeldBalanceTx(gomock.Any(), txMock, withdrawal.UserID, withdrawal.Sum).
+					Return(nil)
+				storageMock.EXPECT().
+					RestorePointLotsTx(gomock.Any(), txMock, withdrawal.UserID, withdrawal.OrderNumber, withdrawal.Sum).
+					Return(nil)
+				storageMock.EXPECT().
+					CreateLedgerTransactionTx(
+						gomock.Any(),
+						txMock,
+						models.ReleaseEntry,
+						withdrawal.OrderNumber,
+						[]models.LedgerEntry{
+							{Account: models.UserAccount, UserID: withdrawal.UserID, Amount: withdrawal.Sum},
+							{Account: models.HoldsAccount, Amount: -withdrawal.Sum},
+						},
+					).
+					Return(nil)
+			},
+		},
+		{
+			name:   "does not release points twice for settled withdrawal",
+			client: settlementClientStub{status: settlement.Rejected},
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+				expectTransaction(storageMock, txMock)
+				storageMock.EXPECT().
+					SettleWithdrawalTx(gomock.Any(), txMock, withdrawal.ID, models.FailedWithdrawal).
+					Return(false, nil)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			storageMock := mocks.NewMockStorage(ctrl)
+			txMock := mocks.NewMockTx(ctrl)
+			tc.expect(storageMock, txMock)
+
+			wrk := newTestSettlementWorker(tc.client, storageMock)
+			jobs := make(chan models.Withdrawal, 1)
+			jobs <- withdrawal
+			close(jobs)
+			wrk.processWithdrawal(jobs)
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ilya-burinskiy/gophermart/internal/auth"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	TOTPIssuer         = "Gophermart"
+	recoveryCodesCount = 10
+)
+
+var (
+	ErrOTPRequired = errors.New("one-time password is required")
+	ErrInvalidOTP  = errors.New("invalid one-time password")
+)
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TOTPEnroller interface {
+	Call(ctx context.Context, userID int) (TOTPEnrollment, error)
+}
+
+type TOTPConfirmer interface {
+	Call(ctx context.Context, userID int, code string) ([]string, error)
+}
+
+type totpEnroller struct {
+	store storage.Storage
+}
+
+type totpConfirmer struct {
+	store storage.Storage
+}
+
+func NewTOTPEnroller(store storage.Storage) TOTPEnroller {
+	return totpEnroller{
+		store: store,
+	}
+}
+
+func NewTOTPConfirmer(store storage.Storage) TOTPConfirmer {
+	return totpConfirmer{
+		store: store,
+	}
+}
+
+// Call generates a new secret that stays inactive until a code generated
+// from it is confirmed
+func (e totpEnroller) Call(ctx context.Context, userID int) (TOTPEnrollment, error) {
+	user, err := e.store.FindUserByID(ctx, userID)
+	if err != nil {
+		return TOTPEnrollment{}, fmt.Errorf("failed to enroll TOTP: %w", err)
+	}
+	if user.TOTPEnabled {
+		return TOTPEnrollment{}, storage.ErrTOTPAlreadyEnabled{UserID: userID}
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return TOTPEnrollment{}, fmt.Errorf("failed to enroll TOTP: %w", err)
+	}
+	if err = e.store.SetUserTOTPSecret(ctx, userID, secret); err != nil {
+		return TOTPEnrollment{}, fmt.Errorf("failed to enroll TOTP: %w", err)
+	}
+
+	return TOTPEnrollment{Secret: secret, URI: auth.TOTPURI(TOTPIssuer, user.Login, secret)}, nil
+}
+
+// Call enables two-factor authentication and returns recovery codes, which
+// are only stored hashed and cannot be shown again
+func (c totpConfirmer) Call(ctx context.Context, userID int, code string) ([]string, error) {
+	user, err := c.store.FindUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm TOTP: %w", err)
+	}
+	if user.TOTPEnabled {
+		return nil, storage.ErrTOTPAlreadyEnabled{UserID: userID}
+	}
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if user.TOTPSecret == "" || !ok {
+		return nil, ErrInvalidOTP
+	}
+
+	codes := make([]string, 0, recoveryCodesCount)
+	hashes := make([]string, 0, recoveryCodesCount)
+	for i := 0; i < recoveryCodesCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to confirm TOTP: %w", err)
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, auth.HashOpaqueToken(code))
+	}
+
+	err = c.store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		if err := c.store.EnableUserTOTPTx(ctx, tx, userID, step); err != nil {
+			return err
+		}
+
+		return c.store.ReplaceRecoveryCodesTx(ctx, tx, userID, hashes)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm TOTP: %w", err)
+	}
+
+	return codes, nil
+}
+
+// verifyTOTP accepts only a code that has not been used before
+func verifyTOTP(ctx context.Context, store storage.Storage, user models.User, code string) error {
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return ErrInvalidOTP
+	}
+
+	fresh, err := store.UseTOTPStep(ctx, user.ID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidOTP
+	}
+
+	return nil
+}
+
+type ErrStepUpLocked struct {
+	RetryAfter time.Duration
+}
+
+func (err ErrStepUpLocked) Error() string {
+	return fmt.Sprintf("too many invalid one-time passwords, retry after %s", err.RetryAfter)
+}
+
+// StepUpConfig requires a fresh TOTP code for moving more than Threshold
+// points from users with two-factor authentication enabled, zero threshold
+// disables the check. Invalid codes are throttled per user with Lockout, the
+// code would be easy to guess with a stolen session otherwise
+type StepUpConfig struct {
+	Threshold models.Money
+	Lockout   LockoutPolicy
+}
+
+type stepUpCheck struct {
+	store  storage.Storage
+	config StepUpConfig
+}
+
+func (c stepUpCheck) Call(ctx context.Context, userID int, sum models.Money, otp string) error {
+	if c.config.Threshold <= 0 || sum <= c.config.Threshold {
+		return nil
+	}
+
+	user, err := c.store.FindUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check one-time password: %w", err)
+	}
+	if !user.TOTPEnabled {
+		return nil
+	}
+
+	key := fmt.Sprintf("stepup:%d", userID)
+	lockedUntil, err := c.store.FindLoginLockout(ctx, []string{key})
+	if err != nil {
+		return fmt.Errorf("failed to check one-time password: %w", err)
+	}
+	if retryAfter := time.Until(lockedUntil); retryAfter > 0 {
+		return ErrStepUpLocked{RetryAfter: retryAfter}
+	}
+	if otp == "" {
+		return ErrOTPRequired
+	}
+
+	if err = verifyTOTP(ctx, c.store, user, otp); err != nil {
+		if errors.Is(err, ErrInvalidOTP) {
+			return c.recordFailure(ctx, key)
+		}
+		return fmt.Errorf("failed to check one-time password: %w", err)
+	}
+	if err = c.store.ResetLoginFailures(ctx, key); err != nil {
+		return fmt.Errorf("failed to check one-time password: %w", err)
+	}
+
+	return nil
+}
+
+// recordFailure counts the invalid code and returns ErrInvalidOTP unless the
+// attempt could not be recorded
+func (c stepUpCheck) recordFailure(ctx context.Context, key string) error {
+	failures, err := c.store.RecordLoginFailure(ctx, key, c.config.Lockout.Window)
+	if err != nil {
+		return fmt.Errorf("failed to check one-time password: %w", err)
+	}
+	if delay := c.config.Lockout.Delay(failures); delay > 0 {
+		if err = c.store.LockLogin(ctx, key, time.Now().Add(delay)); err != nil {
+			return fmt.Errorf("failed to check one-time password: %w", err)
+		}
+	}
+
+	return ErrInvalidOTP
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code
+func verifySecondFactor(ctx context.Context, store storage.Storage, user models.User, code string) error {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if !strings.Contains(code, "-") {
+		return verifyTOTP(ctx, store, user, code)
+	}
+
+	used, err := store.UseRecoveryCode(ctx, user.ID, auth.HashOpaqueToken(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidOTP
+	}
+
+	return nil
+}
+
+func generateRecoveryCode() (string, error) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	code := strings.ToLower(secret[:10])
+
+	return code[:5] + "-" + code[5:], nil
+}
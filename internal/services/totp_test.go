@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/ilya-burinskiy/gophermart/internal/auth"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/storage/mocks"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTPConfirmerCall(t *testing.T) {
+	secret, err := auth.GenerateTOTPSecret()
+	require.NoError(t, err)
+	code, err := auth.TOTPCode(secret, time.Now())
+	require.NoError(t, err)
+	user := models.User{ID: 1, Login: "login", TOTPSecret: secret}
+
+	t.Run("enables TOTP and stores hashed recovery codes", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		txMock := mocks.NewMockTx(ctrl)
+		var storedHashes []string
+		storageMock.EXPECT().FindUserByID(gomock.Any(), user.ID).Return(user, nil)
+		expectTransaction(storageMock, txMock)
+		storageMock.EXPECT().EnableUserTOTPTx(gomock.Any(), txMock, user.ID, gomock.Any()).Return(nil)
+		storageMock.EXPECT().
+			ReplaceRecoveryCodesTx(gomock.Any(), txMock, user.ID, gomock.Any()).
+			DoAndReturn(func(ctx context.Context, tx pgx.Tx, userID int, codeHashes []string) error {
+				storedHashes = codeHashes
+				return nil
+			})
+
+		codes, err := NewTOTPConfirmer(storageMock).Call(context.Background(), user.ID, code)
+
+		require.NoError(t, err)
+		require.Len(t, codes, recoveryCodesCount)
+		for i, code := range codes {
+			assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, code)
+			assert.Equal(t, auth.HashOpaqueToken(code), storedHashes[i])
+		}
+	})
+
+	t.Run("rejects invalid code", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		storageMock.EXPECT().FindUserByID(gomock.Any(), user.ID).Return(user, nil)
+
+		_, err := NewTOTPConfirmer(storageMock).Call(context.Background(), user.ID, "000000x")
+
+		assert.ErrorIs(t, err, ErrInvalidOTP)
+	})
+
+	t.Run("rejects already enabled TOTP", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		storageMock := mocks.NewMockStorage(ctrl)
+		enabledUser := user
+		enabledUser.TOTPEnabled = true
+		storageMock.EXPECT().FindUserByID(gomock.Any(), user.ID).Return(enabledUser, nil)
+
+		_, err := NewTOTPConfirmer(storageMock).Call(context.Background(), user.ID, code)
+
+		assert.ErrorAs(t, err, &storage.ErrTOTPAlreadyEnabled{})
+	})
+}
+
+func TestAuthenticateUserServiceSecondFactor(t *testing.T) {
+	keys, err := auth.NewKeySet(auth.NewHMACKey("test", []byte("secret")))
+	require.NoError(t, err)
+	hash, err := auth.HashPassword("password")
+	require.NoError(t, err)
+	secret, err := auth.GenerateTOTPSecret()
+	require.NoError(t, err)
+	code, err := auth.TOTPCode(secret, time.Now())
+	require.NoError(t, err)
+	user := models.User{ID: 1, Login: "login", EncryptedPassword: hash, TOTPSecret: secret, TOTPEnabled: true}
+	guard := LoginGuardConfig{
+		PerLogin: LockoutPolicy{FreeAttempts: 5, BaseDelay: time.Second, MaxDelay: time.Minute, Window: time.Hour},
+		PerIP:    LockoutPolicy{FreeAttempts: 5, BaseDelay: time.Second, MaxDelay: time.Minute, Window: time.Hour},
+	}
+
+	testCases := []struct {
+		name        string
+		otp         string
+		expect      func(storageMock *mocks.MockStorage)
+		expectedErr error
+	}{
+		{
+			name:        "requires one-time password",
+			expectedErr: ErrOTPRequired,
+		},
+		{
+			name: "rejects replayed TOTP code",
+			otp:  code,
+			expect: func(storageMock *mocks.MockStorage) {
+				storageMock.EXPECT().UseTOTPStep(gomock.Any(), user.ID, gomock.Any()).Return(false, nil)
+				storageMock.EXPECT().RecordLoginFailure(gomock.Any(), gomock.Any(), time.Hour).Return(1, nil).Times(2)
+			},
+			expectedErr: ErrInvalidOTP,
+		},
+		{
+			name: "accepts fresh TOTP code",
+			otp:  code,
+			expect: func(storageMock *mocks.MockStorage) {
+				storageMock.EXPECT().UseTOTPStep(gomock.Any(), user.ID, gomock.Any()).Return(true, nil)
+			},
+		},
+		{
+			name: "accepts unused recovery code",
+			otp:  " ABCDE-FGHIJ ",
+			expect: func(storageMock *mocks.MockStorage) {
+				storageMock.EXPECT().UseRecoveryCode(gomock.Any(), user.ID, auth.HashOpaqueToken("abcde-fghij")).Return(true, nil)
+			},
+		},
+		{
+			name: "rejects used recovery code",
+			otp:  "abcde-fghij",
+			expect: func(storageMock *mocks.MockStorage) {
+				storageMock.EXPECT().UseRecoveryCode(gomock.Any(), user.ID, auth.HashOpaqueToken("abcde-fghij")).Return(false, nil)
+				storageMock.EXPECT().RecordLoginFailure(gomock.Any(), gomock.Any(), time.Hour).Return(1, nil).Times(2)
+			},
+			expectedErr: ErrInvalidOTP,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			storageMock := mocks.NewMockStorage(ctrl)
+			storageMock.EXPECT().FindLoginLockout(gomock.Any(), gomock.Any()).Return(time.Time{}, nil)
+			storageMock.EXPECT().FindUserByLogin(gomock.Any(), user.Login).Return(user, nil)
+			if tc.expect != nil {
+				tc.expect(storageMock)
+			}
+			if tc.expectedErr == nil {
+				txMock := mocks.NewMockTx(ctrl)
+				storageMock.EXPECT().ResetLoginFailures(gomock.Any(), "login:login").Return(nil)
+				expectTransaction(storageMock, txMock)
+				storageMock.EXPECT().CreateRefreshTokenTx(gomock.Any(), txMock, gomock.Any()).Return(nil)
+			}
+
+			_, err := NewAuthenticateUserService(storageMock, keys, guard).
+				Call(context.Background(), user.Login, "password", tc.otp, "10.0.0.1")
+
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestWithdrawalCreatorRequiresOTPAboveThreshold(t *testing.T) {
+	secret, err := auth.GenerateTOTPSecret()
+	require.NoError(t, err)
+	user := models.User{ID: 1, Login: "login", TOTPSecret: secret, TOTPEnabled: true}
+
+	ctrl := gomock.NewController(t)
+	storageMock := mocks.NewMockStorage(ctrl)
+	storageMock.EXPECT().FindUserByID(gomock.Any(), user.ID).Return(user, nil)
+	storageMock.EXPECT().FindLoginLockout(gomock.Any(), []string{"stepup:1"}).Return(time.Time{}, nil)
+
+	_, err = NewWithdrawalCreator(storageMock, StepUpConfig{Threshold: 10000}).
+		Call(context.Background(), user.ID, "12345678903", 10001, "")
+
+	assert.ErrorIs(t, err, ErrOTPRequired)
+}
+
+func TestStepUpCheckCall(t *testing.T) {
+	secret, err := auth.GenerateTOTPSecret()
+	require.NoError(t, err)
+	code, err := auth.TOTPCode(secret, time.Now())
+	require.NoError(t, err)
+	user := models.User{ID: 1, Login: "login", TOTPSecret: secret, TOTPEnabled: true}
+	config := StepUpConfig{
+		Threshold: 10000,
+		Lockout:   LockoutPolicy{FreeAttempts: 5, BaseDelay: time.Second, MaxDelay: time.Minute, Window: time.Hour},
+	}
+
+	testCases := []struct {
+		name        string
+		sum         models.Money
+		otp         string
+		expect      func(storageMock *mocks.MockStorage)
+		expectedErr error
+	}{
+		{
+			name: "skips check up to threshold",
+			sum:  10000,
+		},
+		{
+			name: "accepts fresh TOTP code and resets failures",
+			sum:  10001,
+			otp:  code,
+			expect: func(storageMock *mocks.MockStorage) {
+				storageMock.EXPECT().FindUserByID(gomock.Any(), user.ID).Return(user, nil)
+				storageMock.EXPECT().FindLoginLockout(gomock.Any(), []string{"stepup:1"}).Return(time.Time{}, nil)
+				storageMock.EXPECT().UseTOTPStep(gomock.Any(), user.ID, gomock.Any()).Return(true, nil)
+				storageMock.EXPECT().ResetLoginFailures(gomock.Any(), "stepup:1").Return(nil)
+			},
+		},
+		{
+			name: "records invalid code",
+			sum:  10001,
+			otp:  "invalid",
+			expect: func(storageMock *mocks.MockStorage) {
+				storageMock.EXPECT().FindUserByID(gomock.Any(), user.ID).Return(user, nil)
+				storageMock.EXPECT().FindLoginLockout(gomock.Any(), []string{"stepup:1"}).Return(time.Time{}, nil)
+				storageMock.EXPECT().RecordLoginFailure(gomock.Any(), "stepup:1", time.Hour).Return(1, nil)
+			},
+			expectedErr: ErrInvalidOTP,
+		},
+		{
+			name: "locks step-up after too many invalid codes",
+			sum:  10001,
+			otp:  "invalid",
+			expect: func(storageMock *mocks.MockStorage) {
+				storageMock.EXPECT().FindUserByID(gomock.Any(), user.ID).Return(user, nil)
+				storageMock.EXPECT().FindLoginLockout(gomock.Any(), []string{"stepup:1"}).Return(time.Time{}, nil)
+				storageMock.EXPECT().RecordLoginFailure(gomock.Any(), "stepup:1", time.Hour).Return(6, nil)
+				storageMock.EXPECT().LockLogin(gomock.Any(), "stepup:1", gomock.Any()).Return(nil)
+			},
+			expectedErr: ErrInvalidOTP,
+		},
+		{
+			name: "rejects any code while locked",
+			sum:  10001,
+			otp:  code,
+			expect: func(storageMock *mocks.MockStorage) {
+				storageMock.EXPECT().FindUserByID(gomock.Any(), user.ID).Return(user, nil)
+				storageMock.EXPECT().
+					FindLoginLockout(gomock.Any(), []string{"stepup:1"}).
+					Return(time.Now().Add(time.Minute), nil)
+			},
+			expectedErr: ErrStepUpLocked{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			storageMock := mocks.NewMockStorage(ctrl)
+			if tc.expect != nil {
+				tc.expect(storageMock)
+			}
+
+			err := stepUpCheck{store: storageMock, config: config}.Call(context.Background(), user.ID, tc.sum, tc.otp)
+
+			var lockedErr ErrStepUpLocked
+			switch {
+			case tc.expectedErr == nil:
+				assert.NoError(t, err)
+			case errors.As(tc.expectedErr, &lockedErr):
+				assert.ErrorAs(t, err, &lockedErr)
+				assert.Positive(t, lockedErr.RetryAfter)
+			default:
+				assert.ErrorIs(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
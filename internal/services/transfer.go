@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+const transferCapPeriod = 24 * time.Hour
+
+var (
+	ErrSelfTransfer        = errors.New("points cannot be transferred to oneself")
+	ErrTransferCapExceeded = errors.New("daily transfer cap exceeded")
+	ErrUnknownRecipient    = errors.New("points cannot be transferred to this recipient")
+)
+
+type PointsTransferrer interface {
+	Call(ctx context.Context, senderID int, recipientLogin string, sum models.Money, otp string) (models.Transfer, error)
+}
+
+// NewPointsTransferrer limits the sum a user can transfer within 24 hours
+// to dailyCap, zero cap disables the limit. Like withdrawals, transfers above
+// the step-up threshold require a fresh TOTP code from users with two-factor
+// authentication enabled
+func NewPointsTransferrer(store storage.Storage, dailyCap models.Money, stepUp StepUpConfig) PointsTransferrer {
+	return pointsTransferrer{
+		store:    store,
+		dailyCap: dailyCap,
+		stepUp:   stepUpCheck{store: store, config: stepUp},
+	}
+}
+
+type pointsTransferrer struct {
+	store    storage.Storage
+	dailyCap models.Money
+	stepUp   stepUpCheck
+}
+
+// Call hands the sender's oldest points over to the recipient, who gets them
+// with their original accrual dates, so transfers do not postpone expiry.
+// An unknown recipient is reported only after all the other checks pass, so
+// finding out whether a login is registered takes a transfer that would
+// otherwise go through to it
+func (srv pointsTransferrer) Call(
+	ctx context.Context,
+	senderID int,
+	recipientLogin string,
+	sum models.Money,
+	otp string) (models.Transfer, error) {
+
+	if sum <= 0 {
+		return models.Transfer{}, ErrInvalidSum
+	}
+	if err := srv.stepUp.Call(ctx, senderID, sum, otp); err != nil {
+		return models.Transfer{}, err
+	}
+	userIDs := []int{senderID}
+	recipient, err := srv.store.FindUserByLogin(ctx, recipientLogin)
+	var notFoundErr storage.ErrUserNotFound
+	recipientKnown := !errors.As(err, &notFoundErr)
+	if err != nil && recipientKnown {
+		return models.Transfer{}, err
+	}
+	if recipientKnown {
+		if recipient.ID == senderID {
+			return models.Transfer{}, ErrSelfTransfer
+		}
+		userIDs = append(userIDs, recipient.ID)
+	}
+
+	var transfer models.Transfer
+	err = srv.store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		if err := srv.store.LockBalancesTx(ctx, tx, userIDs); err != nil {
+			return err
+		}
+		if err := srv.checkCap(ctx, tx, senderID, sum); err != nil {
+			return err
+		}
+
+		err := srv.store.DebitBalanceTx(ctx, tx, senderID, sum)
+		if err != nil {
+			var insufficientErr storage.ErrInsufficientBalance
+			if errors.As(err, &insufficientErr) {
+				return ErrNotEnoughAmount
+			}
+			return err
+		}
+		if !recipientKnown {
+			// rolls the debit back
+			return ErrUnknownRecipient
+		}
+		if err = srv.store.CreditBalanceTx(ctx, tx, recipient.ID, sum); err != nil {
+			return err
+		}
+		if err = srv.moveLots(ctx, tx, senderID, recipient.ID, sum); err != nil {
+			return err
+		}
+
+		transfer, err = srv.store.CreateTransferTx(ctx, tx, models.Transfer{
+			SenderID:    senderID,
+			RecipientID: recipient.ID,
+			Recipient:   recipient.Login,
+			Sum:         sum,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = srv.store.CreateLedgerTransactionTx(ctx, tx, models.TransferEntry, "", []models.LedgerEntry{
+			{Account: models.UserAccount, UserID: senderID, Amount: -sum},
+			{Account: models.UserAccount, UserID: recipient.ID, Amount: sum},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record ledger transaction: %w", err)
+		}
+
+		return nil
+	})
+
+	return transfer, err
+}
+
+func (srv pointsTransferrer) checkCap(ctx context.Context, tx pgx.Tx, senderID int, sum models.Money) error {
+	if srv.dailyCap <= 0 {
+		return nil
+	}
+
+	transferred, err := srv.store.TransferredSinceTx(ctx, tx, senderID, time.Now().Add(-transferCapPeriod))
+	if err != nil {
+		return err
+	}
+	if transferred+sum > srv.dailyCap {
+		return ErrTransferCapExceeded
+	}
+
+	return nil
+}
+
+func (srv pointsTransferrer) moveLots(ctx context.Context, tx pgx.Tx, senderID, recipientID int, sum models.Money) error {
+	lots, err := srv.store.ConsumePointLotsTx(ctx, tx, senderID, "", sum)
+	if err != nil {
+		return err
+	}
+
+	rest := sum
+	for _, lot := range lots {
+		err = srv.store.CreatePointLotTx(ctx, tx, models.PointLot{UserID: recipientID, Amount: lot.Amount, AccruedAt: lot.AccruedAt})
+		if err != nil {
+			return err
+		}
+		rest -= lot.Amount
+	}
+	if rest > 0 {
+		return srv.store.CreatePointLotTx(ctx, tx, models.PointLot{UserID: recipientID, Amount: rest})
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package services_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/services"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPointsTransferrerOpposingTransfers(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+
+	ctx := context.Background()
+	store, err := storage.NewDBStorage(dsn)
+	require.NoError(t, err)
+	defer store.Close()
+
+	suffix := time.Now().UnixNano()
+	first, err := store.CreateUser(ctx, fmt.Sprintf("first-%d", suffix), "password")
+	require.NoError(t, err)
+	second, err := store.CreateUser(ctx, fmt.Sprintf("second-%d", suffix), "password")
+	require.NoError(t, err)
+	err = store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		if err := store.CreditBalanceTx(ctx, tx, first.ID, 10000); err != nil {
+			return err
+		}
+		return store.CreditBalanceTx(ctx, tx, second.ID, 10000)
+	})
+	require.NoError(t, err)
+
+	transferrer := services.NewPointsTransferrer(store, 0, services.StepUpConfig{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := transferrer.Call(ctx, first.ID, second.Login, 100, "")
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := transferrer.Call(ctx, second.ID, first.Login, 100, "")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	for _, user := range []models.User{first, second} {
+		balance, err := store.FindBalanceByUserID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.Money(10000), balance.CurrentAmount)
+
+		entries, err := store.UserLedgerEntries(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Len(t, entries, 20)
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/ilya-burinskiy/gophermart/internal/auth"
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/storage/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPointsTransferrerCall(t *testing.T) {
+	secret, err := auth.GenerateTOTPSecret()
+	require.NoError(t, err)
+	sender := models.User{ID: 1, Login: "sender"}
+	senderWithTOTP := models.User{ID: 1, Login: "sender", TOTPSecret: secret, TOTPEnabled: true}
+	recipient := models.User{ID: 2, Login: "recipient"}
+	testCases := []struct {
+		name         string
+		recipient    string
+		sum          models.Money
+		dailyCap     models.Money
+		otpThreshold models.Money
+		otp          string
+		expect       func(storageMock *mocks.MockStorage, txMock *mocks.MockTx)
+		expectedErr  error
+	}{
+		{
+			name:      "moves points with their accrual dates to recipient",
+			recipient: recipient.Login,
+			sum:       1500,
+			dailyCap:  5000,
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+				storageMock.EXPECT().FindUserByLogin(gomock.Any(), recipient.Login).Return(recipient, nil)
+				expectTransaction(storageMock, txMock)
+				storageMock.EXPECT().LockBalancesTx(gomock.Any(), txMock, []int{sender.ID, recipient.ID}).Return(nil)
+				storageMock.EXPECT().TransferredSinceTx(gomock.Any(), txMock, sender.ID, gomock.Any()).Return(models.Money(3500), nil)
+				storageMock.EXPECT().DebitBalanceTx(gomock.Any(), txMock, sender.ID, models.Money(1500)).Return(nil)
+				storageMock.EXPECT().CreditBalanceTx(gomock.Any(), txMock, recipient.ID, models.Money(1500)).Return(nil)
+				lot := models.PointLot{ID: 7, UserID: sender.ID, Amount: 1000}
+				storageMock.EXPECT().
+					ConsumePointLotsTx(gomock.Any(), txMock, sender.ID, "", models.Money(1500)).
+					Return([]models.PointLot{lot}, nil)
+				storageMock.EXPECT().
+					CreatePointLotTx(gomock.Any(), txMock, models.PointLot{UserID: recipient.ID, Amount: 1000, AccruedAt: lot.AccruedAt}).
+					Return(nil)
+				storageMock.EXPECT().
+					CreatePointLotTx(gomock.Any(), txMock, models.PointLot{UserID: recipient.ID, Amount: 500}).
+					Return(nil)
+				storageMock.EXPECT().
+					CreateTransferTx(gomock.Any(), txMock, models.Transfer{
+						SenderID: sender.ID, RecipientID: recipient.ID, Recipient: recipient.Login, Sum: 1500,
+					}).
+					Return(models.Transfer{ID: 1}, nil)
+				storageMock.EXPECT().
+					CreateLedgerTransactionTx(gomock.Any(), txMock, models.TransferEntry, "", []models.LedgerEntry{
+						{Account: models.UserAccount, UserID: sender.ID, Amount: -1500},
+						{Account: models.UserAccount, UserID: recipient.ID, Amount: 1500},
+					}).
+					Return(nil)
+			},
+		},
+		{
+			name:      "rejects transfer exceeding daily cap",
+			recipient: recipient.Login,
+			sum:       1501,
+			dailyCap:  5000,
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+				storageMock.EXPECT().FindUserByLogin(gomock.Any(), recipient.Login).Return(recipient, nil)
+				expectTransaction(storageMock, txMock)
+				storageMock.EXPECT().LockBalancesTx(gomock.Any(), txMock, []int{sender.ID, recipient.ID}).Return(nil)
+				storageMock.EXPECT().TransferredSinceTx(gomock.Any(), txMock, sender.ID, gomock.Any()).Return(models.Money(3500), nil)
+			},
+			expectedErr: ErrTransferCapExceeded,
+		},
+		{
+			name:      "rejects transfer exceeding balance",
+			recipient: recipient.Login,
+			sum:       1500,
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+				storageMock.EXPECT().FindUserByLogin(gomock.Any(), recipient.Login).Return(recipient, nil)
+				expectTransaction(storageMock, txMock)
+				storageMock.EXPECT().LockBalancesTx(gomock.Any(), txMock, []int{sender.ID, recipient.ID}).Return(nil)
+				storageMock.EXPECT().
+					DebitBalanceTx(gomock.Any(), txMock, sender.ID, models.Money(1500)).
+					Return(storage.ErrInsufficientBalance{UserID: sender.ID, Amount: 1500})
+			},
+			expectedErr: ErrNotEnoughAmount,
+		},
+		{
+			name:      "rejects unknown recipient only after other checks pass",
+			recipient: "unknown",
+			sum:       1500,
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+				storageMock.EXPECT().FindUserByLogin(gomock.Any(), "unknown").Return(models.User{}, storage.ErrUserNotFound{})
+				expectTransaction(storageMock, txMock)
+				storageMock.EXPECT().LockBalancesTx(gomock.Any(), txMock, []int{sender.ID}).Return(nil)
+				storageMock.EXPECT().DebitBalanceTx(gomock.Any(), txMock, sender.ID, models.Money(1500)).Return(nil)
+			},
+			expectedErr: ErrUnknownRecipient,
+		},
+		{
+			name:      "reports insufficient balance for unknown recipient like for known one",
+			recipient: "unknown",
+			sum:       1500,
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+				storageMock.EXPECT().FindUserByLogin(gomock.Any(), "unknown").Return(models.User{}, storage.ErrUserNotFound{})
+				expectTransaction(storageMock, txMock)
+				storageMock.EXPECT().LockBalancesTx(gomock.Any(), txMock, []int{sender.ID}).Return(nil)
+				storageMock.EXPECT().
+					DebitBalanceTx(gomock.Any(), txMock, sender.ID, models.Money(1500)).
+					Return(storage.ErrInsufficientBalance{UserID: sender.ID, Amount: 1500})
+			},
+			expectedErr: ErrNotEnoughAmount,
+		},
+		{
+			name:      "rejects transfer to oneself",
+			recipient: sender.Login,
+			sum:       1500,
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+				storageMock.EXPECT().FindUserByLogin(gomock.Any(), sender.Login).Return(sender, nil)
+			},
+			expectedErr: ErrSelfTransfer,
+		},
+		{
+			name:         "requires otp above threshold",
+			recipient:    recipient.Login,
+			sum:          10001,
+			otpThreshold: 10000,
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+				storageMock.EXPECT().FindUserByID(gomock.Any(), sender.ID).Return(senderWithTOTP, nil)
+				storageMock.EXPECT().FindLoginLockout(gomock.Any(), []string{"stepup:1"}).Return(time.Time{}, nil)
+			},
+			expectedErr: ErrOTPRequired,
+		},
+		{
+			name:         "rejects invalid otp above threshold",
+			recipient:    recipient.Login,
+			sum:          10001,
+			otpThreshold: 10000,
+			otp:          "invalid",
+			expect: func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {
+				storageMock.EXPECT().FindUserByID(gomock.Any(), sender.ID).Return(senderWithTOTP, nil)
+				storageMock.EXPECT().FindLoginLockout(gomock.Any(), []string{"stepup:1"}).Return(time.Time{}, nil)
+				storageMock.EXPECT().RecordLoginFailure(gomock.Any(), "stepup:1", gomock.Any()).Return(1, nil)
+			},
+			expectedErr: ErrInvalidOTP,
+		},
+		{
+			name:        "rejects non positive sum",
+			recipient:   recipient.Login,
+			expect:      func(storageMock *mocks.MockStorage, txMock *mocks.MockTx) {},
+			expectedErr: ErrInvalidSum,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			storageMock := mocks.NewMockStorage(ctrl)
+			txMock := mocks.NewMockTx(ctrl)
+			tc.expect(storageMock, txMock)
+
+			_, err := NewPointsTransferrer(storageMock, tc.dailyCap, StepUpConfig{Threshold: tc.otpThreshold}).
+				Call(context.Background(), sender.ID, tc.recipient, tc.sum, tc.otp)
+
+			assert.ErrorIs(t, err, tc.expectedErr)
+		})
+	}
+}
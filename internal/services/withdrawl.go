@@ -3,34 +3,54 @@ package services
 import (
 	"context"
 	"errors"
-	"fmt"
+	"strings"
 
 	"github.com/ilya-burinskiy/gophermart/internal/models"
 	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
 	"github.com/jackc/pgx/v5"
 )
 
 var ErrNotEnoughAmount = errors.New("not enough amount on balance")
+var ErrInvalidSum = errors.New("sum must be positive")
+var ErrWithdrawalReversed = errors.New("withdrawal has already been reversed")
+var ErrWithdrawalNotConfirmed = errors.New("only confirmed withdrawals can be reversed")
+var ErrReversalReasonRequired = errors.New("reversal reason is required")
 
 type WithdrawalCreator interface {
-	Call(ctx context.Context, userID int, orderNumber string, sum int) (models.Withdrawal, error)
+	Call(ctx context.Context, userID int, orderNumber string, sum models.Money, otp string) (models.Withdrawal, error)
 }
 
-func NewWithdrawalCreator(store storage.Storage) WithdrawalCreator {
+// NewWithdrawalCreator requires a fresh TOTP code for withdrawals above the
+// step-up threshold from users with two-factor authentication enabled
+func NewWithdrawalCreator(store storage.Storage, stepUp StepUpConfig) WithdrawalCreator {
 	return withdrawalCreator{
-		store: store,
+		store:  store,
+		stepUp: stepUpCheck{store: store, config: stepUp},
 	}
 }
 
 type withdrawalCreator struct {
-	store storage.Storage
+	store  storage.Storage
+	stepUp stepUpCheck
 }
 
 func (srv withdrawalCreator) Call(
 	ctx context.Context,
 	userID int,
 	orderNumber string,
-	sum int) (models.Withdrawal, error) {
+	sum models.Money,
+	otp string) (models.Withdrawal, error) {
+
+	if err := validation.ValidateOrderNumber(orderNumber); err != nil {
+		return models.Withdrawal{}, err
+	}
+	if sum <= 0 {
+		return models.Withdrawal{}, ErrInvalidSum
+	}
+	if err := srv.stepUp.Call(ctx, userID, sum, otp); err != nil {
+		return models.Withdrawal{}, err
+	}
 
 	var withdrawal models.Withdrawal
 	err := srv.store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
@@ -40,33 +60,100 @@ func (srv withdrawalCreator) Call(
 			return err
 		}
 
-		balance, err := srv.store.FindBalanceByUserIDTx(ctx, tx, userID)
+		err = srv.store.HoldBalanceTx(ctx, tx, userID, sum)
 		if err != nil {
-			var notFoundErr storage.ErrBalanceNotFound
-			if errors.As(err, &notFoundErr) {
-				balance, err = srv.store.CreateBalanceTx(ctx, tx, userID, 0)
-				if err != nil {
-					return err
-				}
-			} else {
-				return fmt.Errorf("an unexpected error occured while trying to find balance: %w", err)
+			var insufficientErr storage.ErrInsufficientBalance
+			if errors.As(err, &insufficientErr) {
+				return ErrNotEnoughAmount
 			}
+
+			return err
+		}
+		if _, err = srv.store.ConsumePointLotsTx(ctx, tx, userID, orderNumber, sum); err != nil {
+			return err
 		}
 
-		if balance.CurrentAmount >= sum {
-			err = srv.store.UpdateBalanceWithdrawnAmountTx(ctx, tx, balance.ID, balance.WithdrawnAmount+sum)
-			if err != nil {
-				return err
-			}
-			err = srv.store.UpdateBalanceCurrentAmountTx(ctx, tx, balance.ID, balance.CurrentAmount-sum)
-			if err != nil {
-				return err
-			}
+		return recordLedgerTx(
+			ctx,
+			srv.store,
+			tx,
+			models.WithdrawalEntry,
+			orderNumber,
+			userID,
+			-sum,
+			models.HoldsAccount,
+		)
+	})
+
+	return withdrawal, err
+}
+
+type WithdrawalReverser interface {
+	Call(ctx context.Context, operatorID int, orderNumber, reason string) (models.Withdrawal, error)
+}
+
+func NewWithdrawalReverser(store storage.Storage) WithdrawalReverser {
+	return withdrawalReverser{
+		store: store,
+	}
+}
+
+type withdrawalReverser struct {
+	store storage.Storage
+}
+
+// Call returns the spent points to the user's balance, e.g. when the order
+// they were spent on is cancelled; a withdrawal is reversed at most once
+func (srv withdrawalReverser) Call(
+	ctx context.Context,
+	operatorID int,
+	orderNumber string,
+	reason string) (models.Withdrawal, error) {
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return models.Withdrawal{}, ErrReversalReasonRequired
+	}
 
-			return nil
+	var withdrawal models.Withdrawal
+	err := srv.store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		var err error
+		withdrawal, err = srv.store.FindWithdrawalForUpdateTx(ctx, tx, orderNumber)
+		if err != nil {
+			return err
+		}
+		if withdrawal.Reversed() {
+			return ErrWithdrawalReversed
+		}
+		if withdrawal.Status != models.ConfirmedWithdrawal {
+			return ErrWithdrawalNotConfirmed
+		}
+
+		reversedAt, err := srv.store.ReverseWithdrawalTx(ctx, tx, withdrawal.ID, operatorID, reason)
+		if err != nil {
+			return err
+		}
+		withdrawal.ReversedAt = &reversedAt
+		withdrawal.ReversedBy = operatorID
+		withdrawal.ReversalReason = reason
+
+		if err = srv.store.RefundBalanceTx(ctx, tx, withdrawal.UserID, withdrawal.Sum); err != nil {
+			return err
+		}
+		if err = srv.store.RestorePointLotsTx(ctx, tx, withdrawal.UserID, orderNumber, withdrawal.Sum); err != nil {
+			return err
 		}
 
-		return ErrNotEnoughAmount
+		return recordLedgerTx(
+			ctx,
+			srv.store,
+			tx,
+			models.ReversalEntry,
+			orderNumber,
+			withdrawal.UserID,
+			withdrawal.Sum,
+			models.WithdrawalsAccount,
+		)
 	})
 
 	return withdrawal, err
@@ -0,0 +1,176 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/services"
+	"github.com/ilya-burinskiy/gophermart/internal/storage"
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithdrawalCreatorConcurrentWithdrawals(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+
+	ctx := context.Background()
+	store, err := storage.NewDBStorage(dsn)
+	require.NoError(t, err)
+	defer store.Close()
+
+	suffix := time.Now().UnixNano()
+	user, err := store.CreateUser(ctx, fmt.Sprintf("withdrawer-%d", suffix), "password")
+	require.NoError(t, err)
+	err = store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		return store.CreditBalanceTx(ctx, tx, user.ID, 10000)
+	})
+	require.NoError(t, err)
+
+	creator := services.NewWithdrawalCreator(store, services.StepUpConfig{})
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+		rejected  int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			number := fmt.Sprintf("%d%d", suffix, i)
+			number += strconv.Itoa(validation.LuhnCheckDigit(number))
+			_, err := creator.Call(ctx, user.ID, number, 3000, "")
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.Is(err, services.ErrNotEnoughAmount):
+				rejected++
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 3, succeeded)
+	assert.Equal(t, 7, rejected)
+
+	balance, err := store.FindBalanceByUserID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.Money(1000), balance.CurrentAmount)
+	assert.Equal(t, models.Money(9000), balance.HeldAmount)
+	assert.Equal(t, models.Money(0), balance.WithdrawnAmount)
+}
+
+func TestWithdrawalReverserCall(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+
+	ctx := context.Background()
+	store, err := storage.NewDBStorage(dsn)
+	require.NoError(t, err)
+	defer store.Close()
+
+	suffix := time.Now().UnixNano()
+	user, err := store.CreateUser(ctx, fmt.Sprintf("reverser-%d", suffix), "password")
+	require.NoError(t, err)
+	err = store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		return store.CreditBalanceTx(ctx, tx, user.ID, 10000)
+	})
+	require.NoError(t, err)
+	orderNumber := fmt.Sprintf("%d", suffix)
+	orderNumber += strconv.Itoa(validation.LuhnCheckDigit(orderNumber))
+	withdrawal, err := services.NewWithdrawalCreator(store, services.StepUpConfig{}).Call(ctx, user.ID, orderNumber, 3000, "")
+	require.NoError(t, err)
+
+	reverser := services.NewWithdrawalReverser(store)
+	_, err = reverser.Call(ctx, user.ID, orderNumber, "order cancelled")
+	assert.ErrorIs(t, err, services.ErrWithdrawalNotConfirmed)
+
+	err = store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		if _, err := store.SettleWithdrawalTx(ctx, tx, withdrawal.ID, models.ConfirmedWithdrawal); err != nil {
+			return err
+		}
+		return store.SpendHeldBalanceTx(ctx, tx, user.ID, withdrawal.Sum)
+	})
+	require.NoError(t, err)
+	withdrawal, err = reverser.Call(ctx, user.ID, orderNumber, "order cancelled")
+	require.NoError(t, err)
+	assert.True(t, withdrawal.Reversed())
+
+	_, err = reverser.Call(ctx, user.ID, orderNumber, "order cancelled")
+	assert.ErrorIs(t, err, services.ErrWithdrawalReversed)
+
+	balance, err := store.FindBalanceByUserID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.Money(10000), balance.CurrentAmount)
+	assert.Equal(t, models.Money(0), balance.WithdrawnAmount)
+	assert.Equal(t, models.Money(0), balance.HeldAmount)
+
+	withdrawals, err := store.UserWithdrawals(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 1)
+	assert.Equal(t, "order cancelled", withdrawals[0].ReversalReason)
+	assert.NotNil(t, withdrawals[0].ReversedAt)
+}
+
+func TestWithdrawalCreatorConsumesOldestPoints(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+
+	ctx := context.Background()
+	store, err := storage.NewDBStorage(dsn)
+	require.NoError(t, err)
+	defer store.Close()
+
+	suffix := time.Now().UnixNano()
+	user, err := store.CreateUser(ctx, fmt.Sprintf("expiring-%d", suffix), "password")
+	require.NoError(t, err)
+	err = store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		if err := store.CreditBalanceTx(ctx, tx, user.ID, 1500); err != nil {
+			return err
+		}
+		oldLot := models.PointLot{UserID: user.ID, Amount: 500, AccruedAt: time.Now().AddDate(0, -13, 0)}
+		if err := store.CreatePointLotTx(ctx, tx, oldLot); err != nil {
+			return err
+		}
+		return store.CreatePointLotTx(ctx, tx, models.PointLot{UserID: user.ID, Amount: 1000})
+	})
+	require.NoError(t, err)
+
+	orderNumber := fmt.Sprintf("%d", suffix)
+	orderNumber += strconv.Itoa(validation.LuhnCheckDigit(orderNumber))
+	_, err = services.NewWithdrawalCreator(store, services.StepUpConfig{}).Call(ctx, user.ID, orderNumber, 300, "")
+	require.NoError(t, err)
+
+	expiring, err := store.ExpiringPoints(ctx, user.ID, 12, 0)
+	require.NoError(t, err)
+	assert.Equal(t, models.Money(200), expiring)
+
+	var expired models.Money
+	err = store.WithinTranscaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		expired, err = store.ExpirePointLotsTx(ctx, tx, user.ID, 12)
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.Money(200), expired)
+}
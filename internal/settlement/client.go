@@ -0,0 +1,101 @@
+package settlement
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+)
+
+type Status int
+
+const (
+	Pending Status = iota
+	Confirmed
+	Rejected
+)
+
+// ApiClient submits a withdrawal to the payment partner and reports its
+// settlement status. Submitting the same withdrawal again must be safe, the
+// partner identifies withdrawals by order number
+type ApiClient interface {
+	Settle(ctx context.Context, withdrawal models.Withdrawal) (Status, error)
+}
+
+type apiClient struct {
+	baseURL    string
+	httpClient http.Client
+}
+
+type settlementRequest struct {
+	Order string       `json:"order"`
+	Sum   models.Money `json:"sum"`
+}
+
+type settlementResponse struct {
+	Status string `json:"status"`
+}
+
+func NewClient(baseURL string) ApiClient {
+	return apiClient{
+		baseURL:    baseURL,
+		httpClient: http.Client{},
+	}
+}
+
+func (client apiClient) Settle(ctx context.Context, withdrawal models.Withdrawal) (Status, error) {
+	body, err := json.Marshal(settlementRequest{Order: withdrawal.OrderNumber, Sum: withdrawal.Sum})
+	if err != nil {
+		return Pending, fmt.Errorf("failed to build request: %w", err)
+	}
+	request, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		fmt.Sprintf("%s/api/settlements", client.baseURL),
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return Pending, fmt.Errorf("failed to build request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json; charset=utf-8")
+	request.Header.Set("Accept", "application/json; charset=utf-8")
+
+	res, err := client.httpClient.Do(request)
+	if err != nil {
+		return Pending, fmt.Errorf("failed to send request to settlement service: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return Pending, fmt.Errorf("unexpected settlement service response status %d", res.StatusCode)
+	}
+
+	var response settlementResponse
+	if err = json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return Pending, fmt.Errorf("failed to parse settlement service response: %w", err)
+	}
+	switch response.Status {
+	case "PENDING":
+		return Pending, nil
+	case "CONFIRMED":
+		return Confirmed, nil
+	case "REJECTED":
+		return Rejected, nil
+	}
+
+	return Pending, fmt.Errorf("unknown settlement status \"%s\"", response.Status)
+}
+
+type autoConfirmClient struct{}
+
+// NewAutoConfirmClient confirms every withdrawal at once, for deployments
+// without a payment partner
+func NewAutoConfirmClient() ApiClient {
+	return autoConfirmClient{}
+}
+
+func (client autoConfirmClient) Settle(ctx context.Context, withdrawal models.Withdrawal) (Status, error) {
+	return Confirmed, nil
+}
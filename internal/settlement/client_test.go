@@ -0,0 +1,82 @@
+package settlement_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ilya-burinskiy/gophermart/internal/models"
+	"github.com/ilya-burinskiy/gophermart/internal/settlement"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSettle(t *testing.T) {
+	testCases := []struct {
+		name       string
+		status     int
+		body       string
+		wantStatus settlement.Status
+		wantErr    bool
+	}{
+		{
+			name:       "returns pending status",
+			status:     http.StatusOK,
+			body:       `{"status":"PENDING"}`,
+			wantStatus: settlement.Pending,
+		},
+		{
+			name:       "returns confirmed status",
+			status:     http.StatusOK,
+			body:       `{"status":"CONFIRMED"}`,
+			wantStatus: settlement.Confirmed,
+		},
+		{
+			name:       "returns rejected status",
+			status:     http.StatusOK,
+			body:       `{"status":"REJECTED"}`,
+			wantStatus: settlement.Rejected,
+		},
+		{
+			name:    "returns error on unknown status",
+			status:  http.StatusOK,
+			body:    `{"status":"LOST"}`,
+			wantErr: true,
+		},
+		{
+			name:    "returns error on unexpected response status",
+			status:  http.StatusBadGateway,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "/api/settlements", r.URL.Path)
+				body, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.JSONEq(t, `{"order":"12345","sum":729.98}`, string(body))
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			client := settlement.NewClient(server.URL)
+			status, err := client.Settle(
+				context.Background(),
+				models.Withdrawal{OrderNumber: "12345", Sum: 72998},
+			)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantStatus, status)
+		})
+	}
+}
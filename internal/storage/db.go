@@ -5,6 +5,8 @@ import (
 	"embed"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
@@ -20,22 +22,85 @@ import (
 type Storage interface {
 	CreateUser(ctx context.Context, login, encryptedPassword string) (models.User, error)
 	FindUserByLogin(ctx context.Context, login string) (models.User, error)
+	FindUserByID(ctx context.Context, userID int) (models.User, error)
+	UpdateUserPasswordTx(ctx context.Context, tx pgx.Tx, userID int, encryptedPassword string) error
+	RehashUserPasswordTx(ctx context.Context, tx pgx.Tx, userID int, oldHash, newHash string) (bool, error)
+	SearchUsers(ctx context.Context, login string, limit int) ([]models.User, error)
+
+	SetUserTOTPSecret(ctx context.Context, userID int, secret string) error
+	EnableUserTOTPTx(ctx context.Context, tx pgx.Tx, userID int, step int64) error
+	UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error)
+	ReplaceRecoveryCodesTx(ctx context.Context, tx pgx.Tx, userID int, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error)
 	UserOrders(ctx context.Context, userID int) ([]models.Order, error)
 
 	CreateOrder(ctx context.Context, userID int, number string, status models.OrderStatus) (models.Order, error)
-	DeleteOrder(ctx context.Context, orderID int) error
 	FindOrderByNumber(ctx context.Context, number string) (models.Order, error)
-	UpdateOrderTx(ctx context.Context, tx pgx.Tx, orderID int, status models.OrderStatus, accrual int) error
-	NewOrders(ctx context.Context) ([]models.Order, error)
+	UpdateOrderTx(ctx context.Context, tx pgx.Tx, orderID int, owner string, status models.OrderStatus, accrual models.Money, nextAttemptAt time.Time) error
+	CompleteOrderTx(ctx context.Context, tx pgx.Tx, orderID int, owner string, status models.OrderStatus, accrual models.Money) (bool, error)
+	RecordOrderFailure(ctx context.Context, orderID int, owner string, status models.OrderStatus, lastError string, nextAttemptAt time.Time) error
+	RescheduleOrder(ctx context.Context, orderID int, owner string, nextAttemptAt time.Time) error
+	ClaimOrders(ctx context.Context, owner string, limit int, lease time.Duration) ([]models.Order, error)
+	ResetOrder(ctx context.Context, orderID int) (bool, error)
 
-	CreateBalanceTx(ctx context.Context, tx pgx.Tx, userID, currentAmount int) (models.Balance, error)
-	UpdateBalanceCurrentAmountTx(ctx context.Context, tx pgx.Tx, balanceID, amount int) error
-	UpdateBalanceWithdrawnAmountTx(ctx context.Context, tx pgx.Tx, balanceID, amount int) error
+	CreditBalanceTx(ctx context.Context, tx pgx.Tx, userID int, amount models.Money) error
+	HoldBalanceTx(ctx context.Context, tx pgx.Tx, userID int, amount models.Money) error
+	SpendHeldBalanceTx(ctx context.Context, tx pgx.Tx, userID int, amount models.Money) error
+	ReleaseHeldBalanceTx(ctx context.Context, tx pgx.Tx, userID int, amount models.Money) error
+	DebitBalanceTx(ctx context.Context, tx pgx.Tx, userID int, amount models.Money) error
 	FindBalanceByUserID(ctx context.Context, userID int) (models.Balance, error)
-	FindBalanceByUserIDTx(ctx context.Context, tx pgx.Tx, userID int) (models.Balance, error)
+	LockBalancesTx(ctx context.Context, tx pgx.Tx, userIDs []int) error
+
+	CreatePointLotTx(ctx context.Context, tx pgx.Tx, lot models.PointLot) error
+	ConsumePointLotsTx(ctx context.Context, tx pgx.Tx, userID int, orderNumber string, amount models.Money) ([]models.PointLot, error)
+	RestorePointLotsTx(ctx context.Context, tx pgx.Tx, userID int, orderNumber string, amount models.Money) error
+	UsersWithExpiredPoints(ctx context.Context, lifetimeMonths, limit int) ([]int, error)
+	ExpirePointLotsTx(ctx context.Context, tx pgx.Tx, userID int, lifetimeMonths int) (models.Money, error)
+	ExpiringPoints(ctx context.Context, userID int, lifetimeMonths int, within time.Duration) (models.Money, error)
 
 	UserWithdrawals(ctx context.Context, userID int) ([]models.Withdrawal, error)
-	CreateWithdrawalTx(ctx context.Context, tx pgx.Tx, userID int, orderNumber string, sum int) (models.Withdrawal, error)
+	CreateWithdrawalTx(ctx context.Context, tx pgx.Tx, userID int, orderNumber string, sum models.Money) (models.Withdrawal, error)
+	FindWithdrawalForUpdateTx(ctx context.Context, tx pgx.Tx, orderNumber string) (models.Withdrawal, error)
+	ReverseWithdrawalTx(ctx context.Context, tx pgx.Tx, withdrawalID, operatorID int, reason string) (time.Time, error)
+	RefundBalanceTx(ctx context.Context, tx pgx.Tx, userID int, amount models.Money) error
+	ClaimWithdrawals(ctx context.Context, owner string, limit int, lease time.Duration) ([]models.Withdrawal, error)
+	SettleWithdrawalTx(ctx context.Context, tx pgx.Tx, withdrawalID int, status models.WithdrawalStatus) (bool, error)
+	RescheduleWithdrawal(ctx context.Context, withdrawalID int, owner string, nextAttemptAt time.Time) error
+	RecordWithdrawalFailure(ctx context.Context, withdrawalID int, owner string, lastError string, nextAttemptAt time.Time) error
+
+	CreateLedgerTransactionTx(ctx context.Context, tx pgx.Tx, kind models.LedgerEntryKind, orderNumber string, entries []models.LedgerEntry) error
+	UserLedgerEntries(ctx context.Context, userID int) ([]models.LedgerEntry, error)
+
+	CreateTransferTx(ctx context.Context, tx pgx.Tx, transfer models.Transfer) (models.Transfer, error)
+	TransferredSinceTx(ctx context.Context, tx pgx.Tx, senderID int, since time.Time) (models.Money, error)
+
+	CreateBalanceAdjustmentTx(ctx context.Context, tx pgx.Tx, adjustment models.BalanceAdjustment) (models.BalanceAdjustment, error)
+	UserBalanceAdjustments(ctx context.Context, userID int) ([]models.BalanceAdjustment, error)
+
+	CreateRefreshTokenTx(ctx context.Context, tx pgx.Tx, token models.RefreshToken) error
+	FindRefreshTokenTx(ctx context.Context, tx pgx.Tx, tokenHash string) (models.RefreshToken, error)
+	MarkRefreshTokenUsedTx(ctx context.Context, tx pgx.Tx, tokenID int) error
+	RevokeRefreshTokenFamilyTx(ctx context.Context, tx pgx.Tx, familyID string) error
+	RevokeUserRefreshTokensTx(ctx context.Context, tx pgx.Tx, userID int) error
+
+	CreatePasswordResetToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	UsePasswordResetTokenTx(ctx context.Context, tx pgx.Tx, tokenHash string) (int, error)
+
+	FindLoginLockout(ctx context.Context, keys []string) (time.Time, error)
+	RecordLoginFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	DeleteStaleLoginAttempts(ctx context.Context, retention time.Duration) (int64, error)
+	ResetLoginFailures(ctx context.Context, key string) error
+
+	CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error)
+	UserAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, keyID int) error
+	RevokeUserAPIKeysTx(ctx context.Context, tx pgx.Tx, userID int) error
+	UseAPIKey(ctx context.Context, keyHash string) (models.APIKey, error)
+
+	ClaimIdempotencyKey(ctx context.Context, record models.IdempotencyKey, ttl time.Duration) (models.IdempotencyKey, bool, error)
+	SaveIdempotentResponse(ctx context.Context, record models.IdempotencyKey) error
+	ReleaseIdempotencyKey(ctx context.Context, userID int, key string) error
 
 	WithinTranscaction(ctx context.Context, f func(ctx context.Context, tx pgx.Tx) error) error
 	Close()
@@ -67,7 +132,7 @@ func (db *DBStorage) CreateUser(ctx context.Context, login, encryptedPassword st
 		pgx.NamedArgs{"login": login, "encryptedPassword": encryptedPassword},
 	)
 	var userID int
-	user := models.User{Login: login, EncryptedPassword: encryptedPassword}
+	user := models.User{Login: login, EncryptedPassword: encryptedPassword, Role: models.RegularRole}
 	err := row.Scan(&userID)
 	if err != nil {
 		var pgErr *pgconn.PgError
@@ -84,15 +149,13 @@ func (db *DBStorage) CreateUser(ctx context.Context, login, encryptedPassword st
 func (db *DBStorage) FindUserByLogin(ctx context.Context, login string) (models.User, error) {
 	row := db.pool.QueryRow(
 		ctx,
-		`SELECT "id", "encrypted_password"
+		`SELECT "id", "encrypted_password", "role", "totp_secret", "totp_enabled"
 		 FROM "users"
 		 WHERE "login" = @login`,
 		pgx.NamedArgs{"login": login},
 	)
 	user := models.User{Login: login}
-	var id int
-	var encryptedPassword string
-	err := row.Scan(&id, &encryptedPassword)
+	err := row.Scan(&user.ID, &user.EncryptedPassword, &user.Role, &user.TOTPSecret, &user.TOTPEnabled)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return user, ErrUserNotFound{User: user}
@@ -100,16 +163,189 @@ func (db *DBStorage) FindUserByLogin(ctx context.Context, login string) (models.
 		return user, fmt.Errorf("failed to find user: %w", err)
 	}
 
-	user.ID = id
-	user.EncryptedPassword = encryptedPassword
+	return user, nil
+}
+
+func (db *DBStorage) FindUserByID(ctx context.Context, userID int) (models.User, error) {
+	row := db.pool.QueryRow(
+		ctx,
+		`SELECT "login", "encrypted_password", "role", "totp_secret", "totp_enabled"
+		 FROM "users"
+		 WHERE "id" = @userID`,
+		pgx.NamedArgs{"userID": userID},
+	)
+	user := models.User{ID: userID}
+	err := row.Scan(&user.Login, &user.EncryptedPassword, &user.Role, &user.TOTPSecret, &user.TOTPEnabled)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return user, ErrUserNotFound{User: user}
+		}
+		return user, fmt.Errorf("failed to find user: %w", err)
+	}
 
 	return user, nil
 }
 
+func (db *DBStorage) UpdateUserPasswordTx(ctx context.Context, tx pgx.Tx, userID int, encryptedPassword string) error {
+	_, err := tx.Exec(
+		ctx,
+		`UPDATE "users" SET "encrypted_password" = @encryptedPassword WHERE "id" = @userID`,
+		pgx.NamedArgs{"userID": userID, "encryptedPassword": encryptedPassword},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update password of user id=%d: %w", userID, err)
+	}
+
+	return nil
+}
+
+// RehashUserPasswordTx replaces the hash only if it is still oldHash, so a
+// password changed in the meantime is not overwritten with the old one
+func (db *DBStorage) RehashUserPasswordTx(
+	ctx context.Context,
+	tx pgx.Tx,
+	userID int,
+	oldHash string,
+	newHash string) (bool, error) {
+
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE "users" SET "encrypted_password" = @newHash
+		 WHERE "id" = @userID AND "encrypted_password" = @oldHash`,
+		pgx.NamedArgs{"userID": userID, "oldHash": oldHash, "newHash": newHash},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to rehash password of user id=%d: %w", userID, err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// SearchUsers finds users whose login contains the given substring
+func (db *DBStorage) SearchUsers(ctx context.Context, login string, limit int) ([]models.User, error) {
+	pattern := "%" + likeEscaper.Replace(login) + "%"
+	rows, err := db.pool.Query(
+		ctx,
+		`SELECT "id", "login", "role", "totp_enabled"
+		 FROM "users"
+		 WHERE "login" ILIKE @pattern
+		 ORDER BY "login"
+		 LIMIT @limit`,
+		pgx.NamedArgs{"pattern": pattern, "limit": limit},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+
+	result, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.User, error) {
+		var user models.User
+		err := row.Scan(&user.ID, &user.Login, &user.Role, &user.TOTPEnabled)
+		return user, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+
+	return result, nil
+}
+
+func (db *DBStorage) SetUserTOTPSecret(ctx context.Context, userID int, secret string) error {
+	tag, err := db.pool.Exec(
+		ctx,
+		`UPDATE "users"
+		 SET "totp_secret" = @secret, "totp_last_step" = 0
+		 WHERE "id" = @userID AND NOT "totp_enabled"`,
+		pgx.NamedArgs{"userID": userID, "secret": secret},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set TOTP secret of user id=%d: %w", userID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTOTPAlreadyEnabled{UserID: userID}
+	}
+
+	return nil
+}
+
+func (db *DBStorage) EnableUserTOTPTx(ctx context.Context, tx pgx.Tx, userID int, step int64) error {
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE "users"
+		 SET "totp_enabled" = true, "totp_last_step" = @step
+		 WHERE "id" = @userID AND NOT "totp_enabled"`,
+		pgx.NamedArgs{"userID": userID, "step": step},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enable TOTP of user id=%d: %w", userID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTOTPAlreadyEnabled{UserID: userID}
+	}
+
+	return nil
+}
+
+// UseTOTPStep remembers the step of an accepted code and reports false when
+// the same or a later step has already been used
+func (db *DBStorage) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	tag, err := db.pool.Exec(
+		ctx,
+		`UPDATE "users"
+		 SET "totp_last_step" = @step
+		 WHERE "id" = @userID AND "totp_last_step" < @step`,
+		pgx.NamedArgs{"userID": userID, "step": step},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to use TOTP step: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (db *DBStorage) ReplaceRecoveryCodesTx(ctx context.Context, tx pgx.Tx, userID int, codeHashes []string) error {
+	_, err := tx.Exec(
+		ctx,
+		`DELETE FROM "recovery_codes" WHERE "user_id" = @userID`,
+		pgx.NamedArgs{"userID": userID},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	for _, codeHash := range codeHashes {
+		_, err = tx.Exec(
+			ctx,
+			`INSERT INTO "recovery_codes" ("user_id", "code_hash") VALUES (@userID, @codeHash)`,
+			pgx.NamedArgs{"userID": userID, "codeHash": codeHash},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create recovery code: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (db *DBStorage) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	tag, err := db.pool.Exec(
+		ctx,
+		`UPDATE "recovery_codes"
+		 SET "used_at" = now()
+		 WHERE "user_id" = @userID AND "code_hash" = @codeHash AND "used_at" IS NULL`,
+		pgx.NamedArgs{"userID": userID, "codeHash": codeHash},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
 func (db *DBStorage) UserOrders(ctx context.Context, userID int) ([]models.Order, error) {
 	rows, err := db.pool.Query(
 		ctx,
-		`SELECT "id", "user_id", "number", "status", "accrual", "created_at"
+		`SELECT "id", "user_id", "number", "status", "accrual", "created_at",
+		        "attempts", "last_error", "next_attempt_at"
 		 FROM "orders"
 		 WHERE "user_id" = @userID
 		 ORDER BY "created_at" DESC`,
@@ -165,15 +401,6 @@ func (db *DBStorage) CreateOrder(
 	return order, nil
 }
 
-func (db *DBStorage) DeleteOrder(ctx context.Context, orderID int) error {
-	_, err := db.pool.Exec(ctx, `DELETE FROM "orders" WHERE "id" = @id`, pgx.NamedArgs{"id": orderID})
-	if err != nil {
-		return fmt.Errorf("failed to delete order id=%d: %w", orderID, err)
-	}
-
-	return nil
-}
-
 func (db *DBStorage) FindOrderByNumber(ctx context.Context, number string) (models.Order, error) {
 	row := db.pool.QueryRow(
 		ctx,
@@ -183,7 +410,8 @@ func (db *DBStorage) FindOrderByNumber(ctx context.Context, number string) (mode
 		pgx.NamedArgs{"number": number},
 	)
 	order := models.Order{Number: number}
-	var id, userID, accrual int
+	var id, userID int
+	var accrual int64
 	var status models.OrderStatus
 	var createdAt time.Time
 	err := row.Scan(&id, &userID, &status, &accrual, &createdAt)
@@ -194,250 +422,1474 @@ func (db *DBStorage) FindOrderByNumber(ctx context.Context, number string) (mode
 		return order, fmt.Errorf("failed to find order: %w", err)
 	}
 
+	order.ID = id
 	order.UserID = userID
 	order.Status = status
-	order.Accrual = accrual
+	order.Accrual = models.Money(accrual)
 	order.CreatedAt = createdAt
 
 	return order, nil
 }
 
-func (db *DBStorage) NewOrders(ctx context.Context) ([]models.Order, error) {
+func (db *DBStorage) ClaimOrders(
+	ctx context.Context,
+	owner string,
+	limit int,
+	lease time.Duration) ([]models.Order, error) {
+
 	rows, err := db.pool.Query(
 		ctx,
-		`SELECT "id", "user_id", "number", "status", "accrual", "created_at"
-		 FROM "orders"
-		 WHERE "status" = @status`,
-		pgx.NamedArgs{"status": models.NewOrder},
+		`UPDATE "orders"
+		 SET "locked_by" = @owner, "locked_until" = now() + make_interval(secs => @leaseSeconds)
+		 WHERE "id" IN (
+		     SELECT "id"
+		     FROM "orders"
+		     WHERE "status" IN (@new, @registered, @processing)
+		       AND "next_attempt_at" <= now()
+		       AND ("locked_until" IS NULL OR "locked_until" < now())
+		     ORDER BY "next_attempt_at"
+		     LIMIT @limit
+		     FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING "id", "user_id", "number", "status", "accrual", "created_at",
+		           "attempts", "last_error", "next_attempt_at"`,
+		pgx.NamedArgs{
+			"owner":        owner,
+			"leaseSeconds": lease.Seconds(),
+			"new":          models.NewOrder,
+			"registered":   models.RegisteredOrder,
+			"processing":   models.ProcessingOrder,
+			"limit":        limit,
+		},
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch orders: %w", err)
+		return nil, fmt.Errorf("failed to claim orders: %w", err)
 	}
 
 	result, err := pgx.CollectRows(rows, rowToOrder)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch orders: %w", err)
+		return nil, fmt.Errorf("failed to claim orders: %w", err)
 	}
 
 	return result, nil
 }
 
-func (db *DBStorage) CreateBalanceTx(ctx context.Context, tx pgx.Tx, userID, currentAmount int) (models.Balance, error) {
-	row := tx.QueryRow(
+// ResetOrder puts a not yet finalized order back to the polling queue as if
+// it was just uploaded
+func (db *DBStorage) ResetOrder(ctx context.Context, orderID int) (bool, error) {
+	tag, err := db.pool.Exec(
 		ctx,
-		`INSERT INTO "balances" ("user_id", "current_amount")
-		 VALUES (@userID, @currentAmount) RETURNING "id"`,
-		pgx.NamedArgs{"userID": userID, "currentAmount": currentAmount},
+		`UPDATE "orders"
+		 SET "status" = @new, "attempts" = 0, "last_error" = '', "next_attempt_at" = now(),
+		     "locked_by" = NULL, "locked_until" = NULL
+		 WHERE "id" = @orderID AND "status" NOT IN (@processed, @invalid)`,
+		pgx.NamedArgs{
+			"new":       models.NewOrder,
+			"orderID":   orderID,
+			"processed": models.ProcessedOrder,
+			"invalid":   models.InvalidOrder,
+		},
 	)
-	var balanceID int
-	balance := models.Balance{
-		UserID:        userID,
-		CurrentAmount: currentAmount,
-	}
-	err := row.Scan(&balanceID)
 	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
-			return balance, ErrBalanceNotUnique{Balance: balance}
-		}
-
-		return balance, fmt.Errorf("failed to create balance: %w", err)
+		return false, fmt.Errorf("failed to reset order id=%d: %w", orderID, err)
 	}
-	balance.ID = balanceID
 
-	return balance, nil
+	return tag.RowsAffected() == 1, nil
 }
 
-func (db *DBStorage) UpdateBalanceCurrentAmountTx(ctx context.Context, tx pgx.Tx, balanceID, amount int) error {
+func (db *DBStorage) CreditBalanceTx(ctx context.Context, tx pgx.Tx, userID int, amount models.Money) error {
 	_, err := tx.Exec(
 		ctx,
-		`UPDATE "balances" SET "current_amount" = @currentAmount WHERE "id" = @balanceID`,
-		pgx.NamedArgs{"currentAmount": amount, "balanceID": balanceID},
+		`INSERT INTO "balances" ("user_id", "current_amount")
+		 VALUES (@userID, @amount)
+		 ON CONFLICT ("user_id") DO UPDATE
+		 SET "current_amount" = "balances"."current_amount" + EXCLUDED."current_amount"`,
+		pgx.NamedArgs{"userID": userID, "amount": int64(amount)},
 	)
 	if err != nil {
-		return fmt.Errorf("failed to update amount for balance id=%d: %w", balanceID, err)
+		return fmt.Errorf("failed to credit balance for user id=%d: %w", userID, err)
 	}
 
 	return nil
 }
 
-func (db *DBStorage) UpdateBalanceWithdrawnAmountTx(ctx context.Context, tx pgx.Tx, balanceID, amount int) error {
-	_, err := tx.Exec(
+// HoldBalanceTx moves amount from the current balance to the held one until
+// the withdrawal is settled
+func (db *DBStorage) HoldBalanceTx(ctx context.Context, tx pgx.Tx, userID int, amount models.Money) error {
+	tag, err := tx.Exec(
 		ctx,
-		`UPDATE "balances" SET "withdrawn_amount" = @withdrawnAmount WHERE "id" = @balanceID`,
-		pgx.NamedArgs{"withdrawnAmount": amount, "balanceID": balanceID},
+		`UPDATE "balances"
+		 SET "current_amount" = "current_amount" - @amount,
+		     "held_amount" = "held_amount" + @amount
+		 WHERE "user_id" = @userID AND "current_amount" >= @amount`,
+		pgx.NamedArgs{"userID": userID, "amount": int64(amount)},
 	)
 	if err != nil {
-		return fmt.Errorf("failed to update withdrawn amount for balance id=%d: %w", balanceID, err)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.CheckViolation {
+			return ErrInsufficientBalance{UserID: userID, Amount: amount}
+		}
+
+		return fmt.Errorf("failed to hold balance for user id=%d: %w", userID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInsufficientBalance{UserID: userID, Amount: amount}
 	}
 
 	return nil
 }
 
-func (db *DBStorage) FindBalanceByUserID(ctx context.Context, userID int) (models.Balance, error) {
-	row := db.pool.QueryRow(
+// SpendHeldBalanceTx counts a held amount as withdrawn once the withdrawal
+// is confirmed
+func (db *DBStorage) SpendHeldBalanceTx(ctx context.Context, tx pgx.Tx, userID int, amount models.Money) error {
+	tag, err := tx.Exec(
 		ctx,
-		`SELECT "id", "current_amount", "withdrawn_amount" FROM "balances" WHERE "user_id" = @userID`,
-		pgx.NamedArgs{"userID": userID},
+		`UPDATE "balances"
+		 SET "held_amount" = "held_amount" - @amount,
+		     "withdrawn_amount" = "withdrawn_amount" + @amount
+		 WHERE "user_id" = @userID`,
+		pgx.NamedArgs{"userID": userID, "amount": int64(amount)},
 	)
-	balance := models.Balance{UserID: userID}
-	var id, currentAmount, withdrawnAmount int
-	err := row.Scan(&id, &currentAmount, &withdrawnAmount)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return balance, ErrBalanceNotFound{Balance: balance}
-		}
-		return balance, fmt.Errorf("failed to find balance: %w", err)
+		return fmt.Errorf("failed to spend held balance for user id=%d: %w", userID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBalanceNotFound{Balance: models.Balance{UserID: userID}}
 	}
-	balance.ID = id
-	balance.CurrentAmount = currentAmount
-	balance.WithdrawnAmount = withdrawnAmount
 
-	return balance, nil
+	return nil
 }
 
-func (db *DBStorage) FindBalanceByUserIDTx(ctx context.Context, tx pgx.Tx, userID int) (models.Balance, error) {
-	row := tx.QueryRow(
+// ReleaseHeldBalanceTx returns a held amount to the current balance once the
+// withdrawal fails
+func (db *DBStorage) ReleaseHeldBalanceTx(ctx context.Context, tx pgx.Tx, userID int, amount models.Money) error {
+	tag, err := tx.Exec(
 		ctx,
-		`SELECT "id", "current_amount", "withdrawn_amount" FROM "balances" WHERE "user_id" = @userID`,
-		pgx.NamedArgs{"userID": userID},
+		`UPDATE "balances"
+		 SET "held_amount" = "held_amount" - @amount,
+		     "current_amount" = "current_amount" + @amount
+		 WHERE "user_id" = @userID`,
+		pgx.NamedArgs{"userID": userID, "amount": int64(amount)},
 	)
-	balance := models.Balance{UserID: userID}
-	var id, currentAmount, withdrawnAmount int
-	err := row.Scan(&id, &currentAmount, &withdrawnAmount)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return balance, ErrBalanceNotFound{Balance: balance}
-		}
-		return balance, fmt.Errorf("failed to find balance: %w", err)
+		return fmt.Errorf("failed to release held balance for user id=%d: %w", userID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBalanceNotFound{Balance: models.Balance{UserID: userID}}
 	}
-	balance.ID = id
-	balance.CurrentAmount = currentAmount
-	balance.WithdrawnAmount = withdrawnAmount
 
-	return balance, nil
+	return nil
 }
 
-func (db *DBStorage) UpdateOrderTx(ctx context.Context, tx pgx.Tx, orderID int, status models.OrderStatus, accrual int) error {
-	_, err := tx.Exec(
+// RefundBalanceTx returns a withdrawn amount to the current balance
+func (db *DBStorage) RefundBalanceTx(ctx context.Context, tx pgx.Tx, userID int, amount models.Money) error {
+	tag, err := tx.Exec(
 		ctx,
-		`UPDATE "orders" SET "status" = @status, "accrual" = @accrual WHERE "id" = @orderID`,
-		pgx.NamedArgs{"status": status, "accrual": accrual, "orderID": orderID},
+		`UPDATE "balances"
+		 SET "current_amount" = "current_amount" + @amount,
+		     "withdrawn_amount" = "withdrawn_amount" - @amount
+		 WHERE "user_id" = @userID`,
+		pgx.NamedArgs{"userID": userID, "amount": int64(amount)},
 	)
 	if err != nil {
-		return fmt.Errorf("failed to update status for order id=%d: %w", orderID, err)
+		return fmt.Errorf("failed to refund balance for user id=%d: %w", userID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBalanceNotFound{Balance: models.Balance{UserID: userID}}
 	}
 
 	return nil
 }
 
-func (db *DBStorage) UserWithdrawals(ctx context.Context, userID int) ([]models.Withdrawal, error) {
-	rows, err := db.pool.Query(
+// DebitBalanceTx takes amount off the current balance without counting it
+// as withdrawn
+func (db *DBStorage) DebitBalanceTx(ctx context.Context, tx pgx.Tx, userID int, amount models.Money) error {
+	tag, err := tx.Exec(
 		ctx,
-		`SELECT "id", "order_number", "user_id", "sum", "processed_at"
-		 FROM "withdrawals"
-		 WHERE "user_id" = @userID
-		 ORDER BY "processed_at"`,
-		pgx.NamedArgs{"userID": userID},
+		`UPDATE "balances"
+		 SET "current_amount" = "current_amount" - @amount
+		 WHERE "user_id" = @userID AND "current_amount" >= @amount`,
+		pgx.NamedArgs{"userID": userID, "amount": int64(amount)},
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch withdrawals: %w", err)
+		return fmt.Errorf("failed to debit balance for user id=%d: %w", userID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInsufficientBalance{UserID: userID, Amount: amount}
 	}
 
-	result, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Withdrawal, error) {
-		var (
-			id          int
-			orderNumber string
-			userID      int
-			sum         int
-			processedAt time.Time
-		)
-		err := row.Scan(&id, &orderNumber, &userID, &sum, &processedAt)
-
-		return models.Withdrawal{
-			ID:          id,
-			OrderNumber: orderNumber,
-			UserID:      userID,
-			Sum:         sum,
-			ProcessedAt: processedAt,
-		}, err
-	})
+	return nil
+}
+
+// LockBalancesTx locks the balances of the users, creating the missing ones,
+// always in the same order, so that transactions locking several balances
+// cannot deadlock. The insert takes row locks too, so it goes in that order
+// as well
+func (db *DBStorage) LockBalancesTx(ctx context.Context, tx pgx.Tx, userIDs []int) error {
+	userIDs = append([]int(nil), userIDs...)
+	sort.Ints(userIDs)
+	_, err := tx.Exec(
+		ctx,
+		`INSERT INTO "balances" ("user_id")
+		 SELECT unnest(@userIDs::bigint[])
+		 ON CONFLICT ("user_id") DO NOTHING`,
+		pgx.NamedArgs{"userIDs": userIDs},
+	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch withdrawals: %w", err)
+		return fmt.Errorf("failed to lock balances: %w", err)
 	}
 
-	return result, nil
+	_, err = tx.Exec(
+		ctx,
+		`SELECT 1 FROM "balances" WHERE "user_id" = ANY(@userIDs::bigint[]) ORDER BY "user_id" FOR UPDATE`,
+		pgx.NamedArgs{"userIDs": userIDs},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to lock balances: %w", err)
+	}
+
+	return nil
 }
 
-func (db *DBStorage) CreateWithdrawalTx(ctx context.Context, tx pgx.Tx, userID int, orderNumber string, sum int) (models.Withdrawal, error) {
-	currentTime := time.Now()
-	row := tx.QueryRow(
+func (db *DBStorage) CreatePointLotTx(ctx context.Context, tx pgx.Tx, lot models.PointLot) error {
+	if lot.AccruedAt.IsZero() {
+		lot.AccruedAt = time.Now()
+	}
+	_, err := tx.Exec(
 		ctx,
-		`INSERT INTO "withdrawals" ("order_number", "user_id", "sum", "processed_at")
-		 VALUES (@orderNumber, @userID, @sum, @processedAt) RETURNING "id"`,
-		pgx.NamedArgs{"orderNumber": orderNumber, "userID": userID, "sum": sum, "processedAt": currentTime},
+		`INSERT INTO "point_lots" ("user_id", "order_number", "amount", "remaining", "accrued_at")
+		 VALUES (@userID, NULLIF(@orderNumber, ''), @amount, @amount, @accruedAt)`,
+		pgx.NamedArgs{
+			"userID":      lot.UserID,
+			"orderNumber": lot.OrderNumber,
+			"amount":      int64(lot.Amount),
+			"accruedAt":   lot.AccruedAt,
+		},
 	)
-	var withdrawalID int
-	withdrawal := models.Withdrawal{
-		OrderNumber: orderNumber,
-		UserID:      userID,
-		Sum:         sum,
-		ProcessedAt: currentTime,
-	}
-	err := row.Scan(&withdrawalID)
 	if err != nil {
-		return withdrawal, fmt.Errorf("failed to save withdrawal: %w", err)
+		return fmt.Errorf("failed to create point lot for user id=%d: %w", lot.UserID, err)
 	}
-	withdrawal.ID = withdrawalID
 
-	return withdrawal, nil
+	return nil
 }
 
-func (db *DBStorage) WithinTranscaction(ctx context.Context, f func(ctx context.Context, tx pgx.Tx) error) error {
-	tx, err := db.pool.Begin(ctx)
+// ConsumePointLotsTx takes amount from the user's oldest lots and returns
+// the consumed parts. Balance checks are made on the balance itself, which
+// must be locked before calling this, the same as for any other lot change
+func (db *DBStorage) ConsumePointLotsTx(
+	ctx context.Context,
+	tx pgx.Tx,
+	userID int,
+	orderNumber string,
+	amount models.Money) ([]models.PointLot, error) {
+
+	rows, err := tx.Query(
+		ctx,
+		`SELECT "id", "user_id", COALESCE("order_number", ''), "amount", "remaining", "accrued_at"
+		 FROM "point_lots"
+		 WHERE "user_id" = @userID AND "remaining" > 0
+		 ORDER BY "accrued_at", "id"
+		 FOR UPDATE`,
+		pgx.NamedArgs{"userID": userID},
+	)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, fmt.Errorf("failed to find point lots for user id=%d: %w", userID, err)
+	}
+	lots, err := pgx.CollectRows(rows, rowToPointLot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find point lots for user id=%d: %w", userID, err)
 	}
 
-	if err = f(ctx, tx); err != nil {
-		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
-			return fmt.Errorf("failed to rollback transaction: %w", rollbackErr)
+	var consumed []models.PointLot
+	for _, lot := range lots {
+		if amount <= 0 {
+			break
 		}
-		return err
+		part := lot.Remaining
+		if part > amount {
+			part = amount
+		}
+
+		_, err = tx.Exec(
+			ctx,
+			`UPDATE "point_lots" SET "remaining" = "remaining" - @part WHERE "id" = @lotID`,
+			pgx.NamedArgs{"part": int64(part), "lotID": lot.ID},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to consume point lot id=%d: %w", lot.ID, err)
+		}
+		_, err = tx.Exec(
+			ctx,
+			`INSERT INTO "point_lot_debits" ("lot_id", "order_number", "amount")
+			 VALUES (@lotID, NULLIF(@orderNumber, ''), @part)`,
+			pgx.NamedArgs{"lotID": lot.ID, "orderNumber": orderNumber, "part": int64(part)},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to consume point lot id=%d: %w", lot.ID, err)
+		}
+
+		lot.Amount = part
+		lot.Remaining -= part
+		consumed = append(consumed, lot)
+		amount -= part
 	}
 
-	if err = tx.Commit(ctx); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	return consumed, nil
+}
+
+// RestorePointLotsTx puts the points consumed for orderNumber back into the
+// lots they were taken from; whatever was not taken from a lot is restored
+// as a new one
+func (db *DBStorage) RestorePointLotsTx(
+	ctx context.Context,
+	tx pgx.Tx,
+	userID int,
+	orderNumber string,
+	amount models.Money) error {
+
+	var restored int64
+	err := tx.QueryRow(
+		ctx,
+		`WITH "debits" AS (
+		     DELETE FROM "point_lot_debits" "d"
+		     USING "point_lots" "l"
+		     WHERE "d"."lot_id" = "l"."id" AND "l"."user_id" = @userID AND "d"."order_number" = @orderNumber
+		     RETURNING "d"."lot_id", "d"."amount"
+		 ), "restored" AS (
+		     UPDATE "point_lots"
+		     SET "remaining" = "point_lots"."remaining" + "debits"."amount"
+		     FROM "debits"
+		     WHERE "point_lots"."id" = "debits"."lot_id"
+		     RETURNING "debits"."amount"
+		 )
+		 SELECT COALESCE(SUM("amount"), 0) FROM "restored"`,
+		pgx.NamedArgs{"userID": userID, "orderNumber": orderNumber},
+	).Scan(&restored)
+	if err != nil {
+		return fmt.Errorf("failed to restore point lots for order %s: %w", orderNumber, err)
+	}
+
+	if rest := amount - models.Money(restored); rest > 0 {
+		return db.CreatePointLotTx(ctx, tx, models.PointLot{UserID: userID, OrderNumber: orderNumber, Amount: rest})
 	}
 
 	return nil
 }
 
-func (db *DBStorage) Close() {
-	db.pool.Close()
+func (db *DBStorage) UsersWithExpiredPoints(ctx context.Context, lifetimeMonths, limit int) ([]int, error) {
+	rows, err := db.pool.Query(
+		ctx,
+		`SELECT DISTINCT "user_id"
+		 FROM "point_lots"
+		 WHERE "remaining" > 0 AND "accrued_at" + make_interval(months => @lifetimeMonths) <= now()
+		 LIMIT @limit`,
+		pgx.NamedArgs{"lifetimeMonths": lifetimeMonths, "limit": limit},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find users with expired points: %w", err)
+	}
+
+	result, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, fmt.Errorf("failed to find users with expired points: %w", err)
+	}
+
+	return result, nil
 }
 
-func rowToOrder(row pgx.CollectableRow) (models.Order, error) {
-	var (
-		id        int
-		userID    int
-		number    string
-		status    models.OrderStatus
-		accrual   int
-		createdAt time.Time
+// ExpirePointLotsTx empties the user's lots older than lifetimeMonths and
+// returns the expired amount. The balance row is locked first, so that
+// expiry takes the locks in the same order as withdrawals
+func (db *DBStorage) ExpirePointLotsTx(
+	ctx context.Context,
+	tx pgx.Tx,
+	userID int,
+	lifetimeMonths int) (models.Money, error) {
+
+	_, err := tx.Exec(
+		ctx,
+		`SELECT 1 FROM "balances" WHERE "user_id" = @userID FOR UPDATE`,
+		pgx.NamedArgs{"userID": userID},
 	)
-	err := row.Scan(&id, &userID, &number, &status, &accrual, &createdAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock balance for user id=%d: %w", userID, err)
+	}
 
-	return models.Order{
-		ID:        id,
-		UserID:    userID,
-		Number:    number,
-		Status:    status,
-		Accrual:   accrual,
-		CreatedAt: createdAt,
+	var expired int64
+	err = tx.QueryRow(
+		ctx,
+		`WITH "expired" AS (
+		     SELECT "id", "remaining"
+		     FROM "point_lots"
+		     WHERE "user_id" = @userID
+		       AND "remaining" > 0
+		       AND "accrued_at" + make_interval(months => @lifetimeMonths) <= now()
+		     FOR UPDATE
+		 ), "updated" AS (
+		     UPDATE "point_lots" SET "remaining" = 0
+		     FROM "expired"
+		     WHERE "point_lots"."id" = "expired"."id"
+		     RETURNING "expired"."remaining"
+		 )
+		 SELECT COALESCE(SUM("remaining"), 0) FROM "updated"`,
+		pgx.NamedArgs{"userID": userID, "lifetimeMonths": lifetimeMonths},
+	).Scan(&expired)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire point lots for user id=%d: %w", userID, err)
+	}
+
+	return models.Money(expired), nil
+}
+
+// ExpiringPoints sums the user's points that expire within the given period
+func (db *DBStorage) ExpiringPoints(
+	ctx context.Context,
+	userID int,
+	lifetimeMonths int,
+	within time.Duration) (models.Money, error) {
+
+	var expiring int64
+	err := db.pool.QueryRow(
+		ctx,
+		`SELECT COALESCE(SUM("remaining"), 0)
+		 FROM "point_lots"
+		 WHERE "user_id" = @userID
+		   AND "remaining" > 0
+		   AND "accrued_at" + make_interval(months => @lifetimeMonths) <= now() + make_interval(secs => @withinSeconds)`,
+		pgx.NamedArgs{"userID": userID, "lifetimeMonths": lifetimeMonths, "withinSeconds": within.Seconds()},
+	).Scan(&expiring)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum expiring points for user id=%d: %w", userID, err)
+	}
+
+	return models.Money(expiring), nil
+}
+
+func (db *DBStorage) FindBalanceByUserID(ctx context.Context, userID int) (models.Balance, error) {
+	row := db.pool.QueryRow(
+		ctx,
+		`SELECT "id", "current_amount", "withdrawn_amount", "held_amount" FROM "balances" WHERE "user_id" = @userID`,
+		pgx.NamedArgs{"userID": userID},
+	)
+	balance := models.Balance{UserID: userID}
+	var id int
+	var currentAmount, withdrawnAmount, heldAmount int64
+	err := row.Scan(&id, &currentAmount, &withdrawnAmount, &heldAmount)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return balance, ErrBalanceNotFound{Balance: balance}
+		}
+		return balance, fmt.Errorf("failed to find balance: %w", err)
+	}
+	balance.ID = id
+	balance.CurrentAmount = models.Money(currentAmount)
+	balance.WithdrawnAmount = models.Money(withdrawnAmount)
+	balance.HeldAmount = models.Money(heldAmount)
+
+	return balance, nil
+}
+
+func (db *DBStorage) UpdateOrderTx(
+	ctx context.Context,
+	tx pgx.Tx,
+	orderID int,
+	owner string,
+	status models.OrderStatus,
+	accrual models.Money,
+	nextAttemptAt time.Time) error {
+
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE "orders"
+		 SET "status" = @status, "accrual" = @accrual, "attempts" = 0, "last_error" = '',
+		     "next_attempt_at" = @nextAttemptAt, "locked_by" = NULL, "locked_until" = NULL
+		 WHERE "id" = @orderID AND "locked_by" = @owner AND "status" NOT IN (@processed, @invalid)`,
+		pgx.NamedArgs{
+			"status":        status,
+			"accrual":       int64(accrual),
+			"nextAttemptAt": nextAttemptAt,
+			"orderID":       orderID,
+			"owner":         owner,
+			"processed":     models.ProcessedOrder,
+			"invalid":       models.InvalidOrder,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update status for order id=%d: %w", orderID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrOrderLeaseLost{OrderID: orderID, Owner: owner}
+	}
+
+	return nil
+}
+
+// CompleteOrderTx reports false if the order is final already or owner has
+// lost its lease, the order is then left to whoever holds it
+func (db *DBStorage) CompleteOrderTx(
+	ctx context.Context,
+	tx pgx.Tx,
+	orderID int,
+	owner string,
+	status models.OrderStatus,
+	accrual models.Money) (bool, error) {
+
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE "orders"
+		 SET "status" = @status, "accrual" = @accrual, "attempts" = 0, "last_error" = '',
+		     "locked_by" = NULL, "locked_until" = NULL
+		 WHERE "id" = @orderID AND "locked_by" = @owner AND "status" NOT IN (@processed, @invalid)`,
+		pgx.NamedArgs{
+			"status":    status,
+			"accrual":   int64(accrual),
+			"orderID":   orderID,
+			"owner":     owner,
+			"processed": models.ProcessedOrder,
+			"invalid":   models.InvalidOrder,
+		},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to complete order id=%d: %w", orderID, err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (db *DBStorage) RecordOrderFailure(
+	ctx context.Context,
+	orderID int,
+	owner string,
+	status models.OrderStatus,
+	lastError string,
+	nextAttemptAt time.Time) error {
+
+	tag, err := db.pool.Exec(
+		ctx,
+		`UPDATE "orders"
+		 SET "status" = @status, "attempts" = "attempts" + 1,
+		     "last_error" = @lastError, "next_attempt_at" = @nextAttemptAt,
+		     "locked_by" = NULL, "locked_until" = NULL
+		 WHERE "id" = @orderID AND "locked_by" = @owner`,
+		pgx.NamedArgs{
+			"status":        status,
+			"lastError":     lastError,
+			"nextAttemptAt": nextAttemptAt,
+			"orderID":       orderID,
+			"owner":         owner,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record failure for order id=%d: %w", orderID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrOrderLeaseLost{OrderID: orderID, Owner: owner}
+	}
+
+	return nil
+}
+
+// RescheduleOrder hands the lease back without counting an attempt
+func (db *DBStorage) RescheduleOrder(
+	ctx context.Context,
+	orderID int,
+	owner string,
+	nextAttemptAt time.Time) error {
+
+	tag, err := db.pool.Exec(
+		ctx,
+		`UPDATE "orders"
+		 SET "next_attempt_at" = @nextAttemptAt, "locked_by" = NULL, "locked_until" = NULL
+		 WHERE "id" = @orderID AND "locked_by" = @owner`,
+		pgx.NamedArgs{"nextAttemptAt": nextAttemptAt, "orderID": orderID, "owner": owner},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to reschedule order id=%d: %w", orderID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrOrderLeaseLost{OrderID: orderID, Owner: owner}
+	}
+
+	return nil
+}
+
+func (db *DBStorage) UserWithdrawals(ctx context.Context, userID int) ([]models.Withdrawal, error) {
+	rows, err := db.pool.Query(
+		ctx,
+		`SELECT "id", "order_number", "user_id", "sum", "status", "processed_at", "settled_at",
+		        "reversed_at", COALESCE("reversed_by", 0), COALESCE("reversal_reason", ''),
+		        "attempts", "last_error", "next_attempt_at"
+		 FROM "withdrawals"
+		 WHERE "user_id" = @userID
+		 ORDER BY "processed_at"`,
+		pgx.NamedArgs{"userID": userID},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch withdrawals: %w", err)
+	}
+
+	result, err := pgx.CollectRows(rows, rowToWithdrawal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch withdrawals: %w", err)
+	}
+
+	return result, nil
+}
+
+func (db *DBStorage) CreateWithdrawalTx(
+	ctx context.Context,
+	tx pgx.Tx,
+	userID int,
+	orderNumber string,
+	sum models.Money) (models.Withdrawal, error) {
+
+	currentTime := time.Now()
+	row := tx.QueryRow(
+		ctx,
+		`INSERT INTO "withdrawals" ("order_number", "user_id", "sum", "status", "processed_at", "next_attempt_at")
+		 VALUES (@orderNumber, @userID, @sum, @status, @processedAt, @processedAt) RETURNING "id"`,
+		pgx.NamedArgs{
+			"orderNumber": orderNumber,
+			"userID":      userID,
+			"sum":         int64(sum),
+			"status":      models.PendingWithdrawal,
+			"processedAt": currentTime,
+		},
+	)
+	var withdrawalID int
+	withdrawal := models.Withdrawal{
+		OrderNumber:   orderNumber,
+		UserID:        userID,
+		Sum:           sum,
+		Status:        models.PendingWithdrawal,
+		ProcessedAt:   currentTime,
+		NextAttemptAt: currentTime,
+	}
+	err := row.Scan(&withdrawalID)
+	if err != nil {
+		return withdrawal, fmt.Errorf("failed to save withdrawal: %w", err)
+	}
+	withdrawal.ID = withdrawalID
+
+	return withdrawal, nil
+}
+
+func (db *DBStorage) FindWithdrawalForUpdateTx(ctx context.Context, tx pgx.Tx, orderNumber string) (models.Withdrawal, error) {
+	rows, err := tx.Query(
+		ctx,
+		`SELECT "id", "order_number", "user_id", "sum", "status", "processed_at", "settled_at",
+		        "reversed_at", COALESCE("reversed_by", 0), COALESCE("reversal_reason", ''),
+		        "attempts", "last_error", "next_attempt_at"
+		 FROM "withdrawals"
+		 WHERE "order_number" = @orderNumber
+		 FOR UPDATE`,
+		pgx.NamedArgs{"orderNumber": orderNumber},
+	)
+	if err != nil {
+		return models.Withdrawal{}, fmt.Errorf("failed to find withdrawal: %w", err)
+	}
+
+	withdrawal, err := pgx.CollectOneRow(rows, rowToWithdrawal)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Withdrawal{}, ErrWithdrawalNotFound{OrderNumber: orderNumber}
+		}
+		return models.Withdrawal{}, fmt.Errorf("failed to find withdrawal: %w", err)
+	}
+
+	return withdrawal, nil
+}
+
+func (db *DBStorage) ReverseWithdrawalTx(
+	ctx context.Context,
+	tx pgx.Tx,
+	withdrawalID int,
+	operatorID int,
+	reason string) (time.Time, error) {
+
+	row := tx.QueryRow(
+		ctx,
+		`UPDATE "withdrawals"
+		 SET "reversed_at" = now(), "reversed_by" = @operatorID, "reversal_reason" = @reason
+		 WHERE "id" = @withdrawalID AND "reversed_at" IS NULL
+		 RETURNING "reversed_at"`,
+		pgx.NamedArgs{"withdrawalID": withdrawalID, "operatorID": operatorID, "reason": reason},
+	)
+	var reversedAt time.Time
+	if err := row.Scan(&reversedAt); err != nil {
+		return time.Time{}, fmt.Errorf("failed to reverse withdrawal id=%d: %w", withdrawalID, err)
+	}
+
+	return reversedAt, nil
+}
+
+func (db *DBStorage) ClaimWithdrawals(
+	ctx context.Context,
+	owner string,
+	limit int,
+	lease time.Duration) ([]models.Withdrawal, error) {
+
+	rows, err := db.pool.Query(
+		ctx,
+		`UPDATE "withdrawals"
+		 SET "locked_by" = @owner, "locked_until" = now() + make_interval(secs => @leaseSeconds)
+		 WHERE "id" IN (
+		     SELECT "id"
+		     FROM "withdrawals"
+		     WHERE "status" = @pending
+		       AND "next_attempt_at" <= now()
+		       AND ("locked_until" IS NULL OR "locked_until" < now())
+		     ORDER BY "next_attempt_at"
+		     LIMIT @limit
+		     FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING "id", "order_number", "user_id", "sum", "status", "processed_at", "settled_at",
+		           "reversed_at", COALESCE("reversed_by", 0), COALESCE("reversal_reason", ''),
+		           "attempts", "last_error", "next_attempt_at"`,
+		pgx.NamedArgs{
+			"owner":        owner,
+			"leaseSeconds": lease.Seconds(),
+			"pending":      models.PendingWithdrawal,
+			"limit":        limit,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim withdrawals: %w", err)
+	}
+
+	result, err := pgx.CollectRows(rows, rowToWithdrawal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim withdrawals: %w", err)
+	}
+
+	return result, nil
+}
+
+func (db *DBStorage) SettleWithdrawalTx(
+	ctx context.Context,
+	tx pgx.Tx,
+	withdrawalID int,
+	status models.WithdrawalStatus) (bool, error) {
+
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE "withdrawals"
+		 SET "status" = @status, "settled_at" = now(), "locked_by" = NULL, "locked_until" = NULL
+		 WHERE "id" = @withdrawalID AND "status" = @pending`,
+		pgx.NamedArgs{
+			"status":       status,
+			"withdrawalID": withdrawalID,
+			"pending":      models.PendingWithdrawal,
+		},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to settle withdrawal id=%d: %w", withdrawalID, err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (db *DBStorage) RescheduleWithdrawal(
+	ctx context.Context,
+	withdrawalID int,
+	owner string,
+	nextAttemptAt time.Time) error {
+
+	tag, err := db.pool.Exec(
+		ctx,
+		`UPDATE "withdrawals"
+		 SET "next_attempt_at" = @nextAttemptAt, "locked_by" = NULL, "locked_until" = NULL
+		 WHERE "id" = @withdrawalID AND "locked_by" = @owner`,
+		pgx.NamedArgs{"nextAttemptAt": nextAttemptAt, "withdrawalID": withdrawalID, "owner": owner},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to reschedule withdrawal id=%d: %w", withdrawalID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWithdrawalLeaseLost{WithdrawalID: withdrawalID, Owner: owner}
+	}
+
+	return nil
+}
+
+func (db *DBStorage) RecordWithdrawalFailure(
+	ctx context.Context,
+	withdrawalID int,
+	owner string,
+	lastError string,
+	nextAttemptAt time.Time) error {
+
+	tag, err := db.pool.Exec(
+		ctx,
+		`UPDATE "withdrawals"
+		 SET "attempts" = "attempts" + 1, "last_error" = @lastError, "next_attempt_at" = @nextAttemptAt,
+		     "locked_by" = NULL, "locked_until" = NULL
+		 WHERE "id" = @withdrawalID AND "locked_by" = @owner`,
+		pgx.NamedArgs{
+			"lastError":     lastError,
+			"nextAttemptAt": nextAttemptAt,
+			"withdrawalID":  withdrawalID,
+			"owner":         owner,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record failure for withdrawal id=%d: %w", withdrawalID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWithdrawalLeaseLost{WithdrawalID: withdrawalID, Owner: owner}
+	}
+
+	return nil
+}
+
+func (db *DBStorage) CreateLedgerTransactionTx(
+	ctx context.Context,
+	tx pgx.Tx,
+	kind models.LedgerEntryKind,
+	orderNumber string,
+	entries []models.LedgerEntry) error {
+
+	row := tx.QueryRow(
+		ctx,
+		`INSERT INTO "ledger_transactions" ("kind", "order_number", "created_at")
+		 VALUES (@kind, @orderNumber, @createdAt) RETURNING "id"`,
+		pgx.NamedArgs{"kind": kind, "orderNumber": orderNumber, "createdAt": time.Now()},
+	)
+	var transactionID int
+	if err := row.Scan(&transactionID); err != nil {
+		return fmt.Errorf("failed to create ledger transaction: %w", err)
+	}
+
+	for _, entry := range entries {
+		var userID *int
+		if entry.Account == models.UserAccount {
+			userID = &entry.UserID
+		}
+		_, err := tx.Exec(
+			ctx,
+			`INSERT INTO "ledger_entries" ("transaction_id", "account", "user_id", "amount")
+			 VALUES (@transactionID, @account, @userID, @amount)`,
+			pgx.NamedArgs{
+				"transactionID": transactionID,
+				"account":       string(entry.Account),
+				"userID":        userID,
+				"amount":        int64(entry.Amount),
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create ledger entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (db *DBStorage) UserLedgerEntries(ctx context.Context, userID int) ([]models.LedgerEntry, error) {
+	rows, err := db.pool.Query(
+		ctx,
+		`SELECT e."id", e."transaction_id", e."amount", t."kind", t."order_number", t."created_at"
+		 FROM "ledger_entries" e
+		 JOIN "ledger_transactions" t ON t."id" = e."transaction_id"
+		 WHERE e."account" = @account AND e."user_id" = @userID
+		 ORDER BY t."created_at" DESC, e."id" DESC`,
+		pgx.NamedArgs{"account": string(models.UserAccount), "userID": userID},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch ledger entries: %w", err)
+	}
+
+	result, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.LedgerEntry, error) {
+		var (
+			id            int
+			transactionID int
+			amount        int64
+			kind          models.LedgerEntryKind
+			orderNumber   string
+			createdAt     time.Time
+		)
+		err := row.Scan(&id, &transactionID, &amount, &kind, &orderNumber, &createdAt)
+
+		return models.LedgerEntry{
+			ID:            id,
+			TransactionID: transactionID,
+			Account:       models.UserAccount,
+			UserID:        userID,
+			Amount:        models.Money(amount),
+			Kind:          kind,
+			OrderNumber:   orderNumber,
+			CreatedAt:     createdAt,
+		}, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch ledger entries: %w", err)
+	}
+
+	return result, nil
+}
+
+func (db *DBStorage) CreateTransferTx(ctx context.Context, tx pgx.Tx, transfer models.Transfer) (models.Transfer, error) {
+	row := tx.QueryRow(
+		ctx,
+		`INSERT INTO "transfers" ("sender_id", "recipient_id", "sum")
+		 VALUES (@senderID, @recipientID, @sum)
+		 RETURNING "id", "created_at"`,
+		pgx.NamedArgs{
+			"senderID":    transfer.SenderID,
+			"recipientID": transfer.RecipientID,
+			"sum":         int64(transfer.Sum),
+		},
+	)
+	if err := row.Scan(&transfer.ID, &transfer.CreatedAt); err != nil {
+		return models.Transfer{}, fmt.Errorf("failed to create transfer: %w", err)
+	}
+
+	return transfer, nil
+}
+
+func (db *DBStorage) TransferredSinceTx(ctx context.Context, tx pgx.Tx, senderID int, since time.Time) (models.Money, error) {
+	var transferred int64
+	err := tx.QueryRow(
+		ctx,
+		`SELECT COALESCE(SUM("sum"), 0) FROM "transfers" WHERE "sender_id" = @senderID AND "created_at" > @since`,
+		pgx.NamedArgs{"senderID": senderID, "since": since},
+	).Scan(&transferred)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum transfers of user id=%d: %w", senderID, err)
+	}
+
+	return models.Money(transferred), nil
+}
+
+func (db *DBStorage) CreateBalanceAdjustmentTx(
+	ctx context.Context,
+	tx pgx.Tx,
+	adjustment models.BalanceAdjustment) (models.BalanceAdjustment, error) {
+
+	row := tx.QueryRow(
+		ctx,
+		`INSERT INTO "balance_adjustments" ("user_id", "operator_id", "amount", "reason")
+		 VALUES (@userID, @operatorID, @amount, @reason)
+		 RETURNING "id", "created_at"`,
+		pgx.NamedArgs{
+			"userID":     adjustment.UserID,
+			"operatorID": adjustment.OperatorID,
+			"amount":     int64(adjustment.Amount),
+			"reason":     adjustment.Reason,
+		},
+	)
+	if err := row.Scan(&adjustment.ID, &adjustment.CreatedAt); err != nil {
+		return models.BalanceAdjustment{}, fmt.Errorf("failed to create balance adjustment: %w", err)
+	}
+
+	return adjustment, nil
+}
+
+func (db *DBStorage) UserBalanceAdjustments(ctx context.Context, userID int) ([]models.BalanceAdjustment, error) {
+	rows, err := db.pool.Query(
+		ctx,
+		`SELECT "id", "operator_id", "amount", "reason", "created_at"
+		 FROM "balance_adjustments"
+		 WHERE "user_id" = @userID
+		 ORDER BY "created_at" DESC, "id" DESC`,
+		pgx.NamedArgs{"userID": userID},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch balance adjustments: %w", err)
+	}
+
+	result, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.BalanceAdjustment, error) {
+		adjustment := models.BalanceAdjustment{UserID: userID}
+		var amount int64
+		err := row.Scan(&adjustment.ID, &adjustment.OperatorID, &amount, &adjustment.Reason, &adjustment.CreatedAt)
+		adjustment.Amount = models.Money(amount)
+		return adjustment, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch balance adjustments: %w", err)
+	}
+
+	return result, nil
+}
+
+func (db *DBStorage) CreateRefreshTokenTx(ctx context.Context, tx pgx.Tx, token models.RefreshToken) error {
+	_, err := tx.Exec(
+		ctx,
+		`INSERT INTO "refresh_tokens" ("user_id", "family_id", "token_hash", "expires_at")
+		 VALUES (@userID, @familyID, @tokenHash, @expiresAt)`,
+		pgx.NamedArgs{
+			"userID":    token.UserID,
+			"familyID":  token.FamilyID,
+			"tokenHash": token.TokenHash,
+			"expiresAt": token.ExpiresAt,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DBStorage) FindRefreshTokenTx(ctx context.Context, tx pgx.Tx, tokenHash string) (models.RefreshToken, error) {
+	row := tx.QueryRow(
+		ctx,
+		`SELECT "id", "user_id", "family_id", "expires_at", "used_at", "revoked_at"
+		 FROM "refresh_tokens"
+		 WHERE "token_hash" = @tokenHash
+		 FOR UPDATE`,
+		pgx.NamedArgs{"tokenHash": tokenHash},
+	)
+	token := models.RefreshToken{TokenHash: tokenHash}
+	err := row.Scan(&token.ID, &token.UserID, &token.FamilyID, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return token, ErrRefreshTokenNotFound{}
+		}
+		return token, fmt.Errorf("failed to find refresh token: %w", err)
+	}
+
+	return token, nil
+}
+
+func (db *DBStorage) MarkRefreshTokenUsedTx(ctx context.Context, tx pgx.Tx, tokenID int) error {
+	_, err := tx.Exec(
+		ctx,
+		`UPDATE "refresh_tokens" SET "used_at" = now() WHERE "id" = @tokenID`,
+		pgx.NamedArgs{"tokenID": tokenID},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark refresh token id=%d as used: %w", tokenID, err)
+	}
+
+	return nil
+}
+
+func (db *DBStorage) RevokeRefreshTokenFamilyTx(ctx context.Context, tx pgx.Tx, familyID string) error {
+	_, err := tx.Exec(
+		ctx,
+		`UPDATE "refresh_tokens"
+		 SET "revoked_at" = now()
+		 WHERE "family_id" = @familyID AND "revoked_at" IS NULL`,
+		pgx.NamedArgs{"familyID": familyID},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DBStorage) RevokeUserRefreshTokensTx(ctx context.Context, tx pgx.Tx, userID int) error {
+	_, err := tx.Exec(
+		ctx,
+		`UPDATE "refresh_tokens"
+		 SET "revoked_at" = now()
+		 WHERE "user_id" = @userID AND "revoked_at" IS NULL`,
+		pgx.NamedArgs{"userID": userID},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens of user id=%d: %w", userID, err)
+	}
+
+	return nil
+}
+
+func (db *DBStorage) CreatePasswordResetToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := db.pool.Exec(
+		ctx,
+		`INSERT INTO "password_reset_tokens" ("user_id", "token_hash", "expires_at")
+		 VALUES (@userID, @tokenHash, @expiresAt)`,
+		pgx.NamedArgs{"userID": userID, "tokenHash": tokenHash, "expiresAt": expiresAt},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DBStorage) UsePasswordResetTokenTx(ctx context.Context, tx pgx.Tx, tokenHash string) (int, error) {
+	row := tx.QueryRow(
+		ctx,
+		`UPDATE "password_reset_tokens"
+		 SET "used_at" = now()
+		 WHERE "token_hash" = @tokenHash AND "used_at" IS NULL AND "expires_at" > now()
+		 RETURNING "user_id"`,
+		pgx.NamedArgs{"tokenHash": tokenHash},
+	)
+	var userID int
+	if err := row.Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrPasswordResetTokenNotFound{}
+		}
+		return 0, fmt.Errorf("failed to use password reset token: %w", err)
+	}
+
+	return userID, nil
+}
+
+func (db *DBStorage) FindLoginLockout(ctx context.Context, keys []string) (time.Time, error) {
+	row := db.pool.QueryRow(
+		ctx,
+		`SELECT max("locked_until")
+		 FROM "login_attempts"
+		 WHERE "key" = ANY(@keys) AND "locked_until" > now()`,
+		pgx.NamedArgs{"keys": keys},
+	)
+	var lockedUntil *time.Time
+	if err := row.Scan(&lockedUntil); err != nil {
+		return time.Time{}, fmt.Errorf("failed to find login lockout: %w", err)
+	}
+	if lockedUntil == nil {
+		return time.Time{}, nil
+	}
+
+	return *lockedUntil, nil
+}
+
+func (db *DBStorage) RecordLoginFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	row := db.pool.QueryRow(
+		ctx,
+		`INSERT INTO "login_attempts" ("key", "failures", "last_failure_at")
+		 VALUES (@key, 1, now())
+		 ON CONFLICT ("key") DO UPDATE
+		 SET "failures" = CASE
+		         WHEN "login_attempts"."last_failure_at" < now() - make_interval(secs => @windowSeconds) THEN 1
+		         ELSE "login_attempts"."failures" + 1
+		     END,
+		     "last_failure_at" = now()
+		 RETURNING "failures"`,
+		pgx.NamedArgs{"key": key, "windowSeconds": window.Seconds()},
+	)
+	var failures int
+	if err := row.Scan(&failures); err != nil {
+		return 0, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	return failures, nil
+}
+
+func (db *DBStorage) LockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := db.pool.Exec(
+		ctx,
+		`UPDATE "login_attempts" SET "locked_until" = @until WHERE "key" = @key`,
+		pgx.NamedArgs{"key": key, "until": until},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to lock login: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DBStorage) ResetLoginFailures(ctx context.Context, key string) error {
+	_, err := db.pool.Exec(
+		ctx,
+		`DELETE FROM "login_attempts" WHERE "key" = @key`,
+		pgx.NamedArgs{"key": key},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to reset login failures: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteStaleLoginAttempts removes unlocked attempts whose last failure is
+// older than retention, such failures are not counted anymore
+func (db *DBStorage) DeleteStaleLoginAttempts(ctx context.Context, retention time.Duration) (int64, error) {
+	tag, err := db.pool.Exec(
+		ctx,
+		`DELETE FROM "login_attempts"
+		 WHERE "last_failure_at" < now() - make_interval(secs => @retentionSeconds)
+		   AND ("locked_until" IS NULL OR "locked_until" < now())`,
+		pgx.NamedArgs{"retentionSeconds": retention.Seconds()},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete stale login attempts: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func (db *DBStorage) CreateAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	row := db.pool.QueryRow(
+		ctx,
+		`INSERT INTO "api_keys" ("user_id", "name", "prefix", "key_hash", "scopes")
+		 VALUES (@userID, @name, @prefix, @keyHash, @scopes)
+		 RETURNING "id", "created_at"`,
+		pgx.NamedArgs{
+			"userID":  key.UserID,
+			"name":    key.Name,
+			"prefix":  key.Prefix,
+			"keyHash": key.KeyHash,
+			"scopes":  key.Scopes,
+		},
+	)
+	if err := row.Scan(&key.ID, &key.CreatedAt); err != nil {
+		return models.APIKey{}, fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return key, nil
+}
+
+func (db *DBStorage) UserAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error) {
+	rows, err := db.pool.Query(
+		ctx,
+		`SELECT "id", "user_id", "name", "prefix", "scopes", "created_at", "last_used_at"
+		 FROM "api_keys"
+		 WHERE "user_id" = @userID AND "revoked_at" IS NULL
+		 ORDER BY "created_at"`,
+		pgx.NamedArgs{"userID": userID},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch api keys: %w", err)
+	}
+
+	result, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.APIKey, error) {
+		var key models.APIKey
+		err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Scopes, &key.CreatedAt, &key.LastUsedAt)
+		return key, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch api keys: %w", err)
+	}
+
+	return result, nil
+}
+
+func (db *DBStorage) RevokeAPIKey(ctx context.Context, userID, keyID int) error {
+	tag, err := db.pool.Exec(
+		ctx,
+		`UPDATE "api_keys"
+		 SET "revoked_at" = now()
+		 WHERE "id" = @keyID AND "user_id" = @userID AND "revoked_at" IS NULL`,
+		pgx.NamedArgs{"keyID": keyID, "userID": userID},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound{ID: keyID}
+	}
+
+	return nil
+}
+
+func (db *DBStorage) RevokeUserAPIKeysTx(ctx context.Context, tx pgx.Tx, userID int) error {
+	_, err := tx.Exec(
+		ctx,
+		`UPDATE "api_keys"
+		 SET "revoked_at" = now()
+		 WHERE "user_id" = @userID AND "revoked_at" IS NULL`,
+		pgx.NamedArgs{"userID": userID},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api keys of user id=%d: %w", userID, err)
+	}
+
+	return nil
+}
+
+// UseAPIKey finds an active key by its hash and marks it as used
+func (db *DBStorage) UseAPIKey(ctx context.Context, keyHash string) (models.APIKey, error) {
+	row := db.pool.QueryRow(
+		ctx,
+		`UPDATE "api_keys"
+		 SET "last_used_at" = now()
+		 WHERE "key_hash" = @keyHash AND "revoked_at" IS NULL
+		 RETURNING "id", "user_id", "name", "prefix", "scopes", "created_at", "last_used_at"`,
+		pgx.NamedArgs{"keyHash": keyHash},
+	)
+	key := models.APIKey{KeyHash: keyHash}
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Scopes, &key.CreatedAt, &key.LastUsedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.APIKey{}, ErrAPIKeyNotFound{}
+		}
+		return models.APIKey{}, fmt.Errorf("failed to use api key: %w", err)
+	}
+
+	return key, nil
+}
+
+// ClaimIdempotencyKey stores the key for the request unless it is already
+// taken by a request made within ttl, in which case the stored record is
+// returned
+func (db *DBStorage) ClaimIdempotencyKey(
+	ctx context.Context,
+	record models.IdempotencyKey,
+	ttl time.Duration) (models.IdempotencyKey, bool, error) {
+
+	tag, err := db.pool.Exec(
+		ctx,
+		`INSERT INTO "idempotency_keys" ("user_id", "key", "request_hash")
+		 VALUES (@userID, @key, @requestHash)
+		 ON CONFLICT ("user_id", "key") DO UPDATE
+		 SET "request_hash" = EXCLUDED."request_hash", "status_code" = NULL,
+		     "content_type" = '', "body" = NULL, "created_at" = now()
+		 WHERE "idempotency_keys"."created_at" < now() - make_interval(secs => @ttlSeconds)`,
+		pgx.NamedArgs{
+			"userID":      record.UserID,
+			"key":         record.Key,
+			"requestHash": record.RequestHash,
+			"ttlSeconds":  ttl.Seconds(),
+		},
+	)
+	if err != nil {
+		return models.IdempotencyKey{}, false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	if tag.RowsAffected() == 1 {
+		return record, true, nil
+	}
+
+	row := db.pool.QueryRow(
+		ctx,
+		`SELECT "request_hash", COALESCE("status_code", 0), "content_type", "body"
+		 FROM "idempotency_keys"
+		 WHERE "user_id" = @userID AND "key" = @key`,
+		pgx.NamedArgs{"userID": record.UserID, "key": record.Key},
+	)
+	existing := models.IdempotencyKey{UserID: record.UserID, Key: record.Key}
+	err = row.Scan(&existing.RequestHash, &existing.StatusCode, &existing.ContentType, &existing.Body)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.IdempotencyKey{}, false, ErrIdempotencyKeyNotFound{Key: record.Key}
+		}
+		return models.IdempotencyKey{}, false, fmt.Errorf("failed to find idempotency key: %w", err)
+	}
+
+	return existing, false, nil
+}
+
+func (db *DBStorage) SaveIdempotentResponse(ctx context.Context, record models.IdempotencyKey) error {
+	_, err := db.pool.Exec(
+		ctx,
+		`UPDATE "idempotency_keys"
+		 SET "status_code" = @statusCode, "content_type" = @contentType, "body" = @body
+		 WHERE "user_id" = @userID AND "key" = @key`,
+		pgx.NamedArgs{
+			"userID":      record.UserID,
+			"key":         record.Key,
+			"statusCode":  record.StatusCode,
+			"contentType": record.ContentType,
+			"body":        record.Body,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save idempotent response: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey frees a key whose request has not completed, so
+// that it can be retried
+func (db *DBStorage) ReleaseIdempotencyKey(ctx context.Context, userID int, key string) error {
+	_, err := db.pool.Exec(
+		ctx,
+		`DELETE FROM "idempotency_keys"
+		 WHERE "user_id" = @userID AND "key" = @key AND "status_code" IS NULL`,
+		pgx.NamedArgs{"userID": userID, "key": key},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DBStorage) WithinTranscaction(ctx context.Context, f func(ctx context.Context, tx pgx.Tx) error) error {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err = f(ctx, tx); err != nil {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+			return fmt.Errorf("failed to rollback transaction: %w", rollbackErr)
+		}
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DBStorage) Close() {
+	db.pool.Close()
+}
+
+func rowToPointLot(row pgx.CollectableRow) (models.PointLot, error) {
+	var (
+		lot       models.PointLot
+		amount    int64
+		remaining int64
+	)
+	err := row.Scan(&lot.ID, &lot.UserID, &lot.OrderNumber, &amount, &remaining, &lot.AccruedAt)
+	lot.Amount = models.Money(amount)
+	lot.Remaining = models.Money(remaining)
+
+	return lot, err
+}
+
+func rowToWithdrawal(row pgx.CollectableRow) (models.Withdrawal, error) {
+	var (
+		withdrawal models.Withdrawal
+		sum        int64
+	)
+	err := row.Scan(
+		&withdrawal.ID,
+		&withdrawal.OrderNumber,
+		&withdrawal.UserID,
+		&sum,
+		&withdrawal.Status,
+		&withdrawal.ProcessedAt,
+		&withdrawal.SettledAt,
+		&withdrawal.ReversedAt,
+		&withdrawal.ReversedBy,
+		&withdrawal.ReversalReason,
+		&withdrawal.Attempts,
+		&withdrawal.LastError,
+		&withdrawal.NextAttemptAt,
+	)
+	withdrawal.Sum = models.Money(sum)
+
+	return withdrawal, err
+}
+
+func rowToOrder(row pgx.CollectableRow) (models.Order, error) {
+	var (
+		id            int
+		userID        int
+		number        string
+		status        models.OrderStatus
+		accrual       int64
+		createdAt     time.Time
+		attempts      int
+		lastError     string
+		nextAttemptAt time.Time
+	)
+	err := row.Scan(&id, &userID, &number, &status, &accrual, &createdAt, &attempts, &lastError, &nextAttemptAt)
+
+	return models.Order{
+		ID:            id,
+		UserID:        userID,
+		Number:        number,
+		Status:        status,
+		Accrual:       models.Money(accrual),
+		CreatedAt:     createdAt,
+		Attempts:      attempts,
+		LastError:     lastError,
+		NextAttemptAt: nextAttemptAt,
 	}, err
 }
 
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 //go:embed db/migrations/*.sql
 var migrationsDir embed.FS
 
@@ -0,0 +1,4 @@
+ALTER TABLE "orders"
+    ADD COLUMN "attempts" integer NOT NULL DEFAULT 0,
+    ADD COLUMN "last_error" text NOT NULL DEFAULT '',
+    ADD COLUMN "next_attempt_at" timestamptz NOT NULL DEFAULT now();
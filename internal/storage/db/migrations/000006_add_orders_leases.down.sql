@@ -0,0 +1,5 @@
+DROP INDEX "orders_status_next_attempt_at_idx";
+
+ALTER TABLE "orders"
+    DROP COLUMN "locked_by",
+    DROP COLUMN "locked_until";
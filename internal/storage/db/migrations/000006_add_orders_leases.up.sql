@@ -0,0 +1,5 @@
+ALTER TABLE "orders"
+    ADD COLUMN "locked_by" varchar(255),
+    ADD COLUMN "locked_until" timestamptz;
+
+CREATE INDEX "orders_status_next_attempt_at_idx" ON "orders" ("status", "next_attempt_at");
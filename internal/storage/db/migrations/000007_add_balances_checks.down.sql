@@ -0,0 +1,3 @@
+ALTER TABLE "balances"
+    DROP CONSTRAINT "balances_current_amount_check",
+    DROP CONSTRAINT "balances_withdrawn_amount_check";
@@ -0,0 +1,3 @@
+ALTER TABLE "balances"
+    ADD CONSTRAINT "balances_current_amount_check" CHECK ("current_amount" >= 0),
+    ADD CONSTRAINT "balances_withdrawn_amount_check" CHECK ("withdrawn_amount" >= 0);
@@ -0,0 +1,9 @@
+ALTER TABLE "orders"
+    ALTER COLUMN "accrual" TYPE integer USING ("accrual" / 100)::integer;
+
+ALTER TABLE "balances"
+    ALTER COLUMN "current_amount" TYPE integer USING ("current_amount" / 100)::integer,
+    ALTER COLUMN "withdrawn_amount" TYPE integer USING ("withdrawn_amount" / 100)::integer;
+
+ALTER TABLE "withdrawals"
+    ALTER COLUMN "sum" TYPE integer USING ("sum" / 100)::integer;
@@ -0,0 +1,9 @@
+ALTER TABLE "orders"
+    ALTER COLUMN "accrual" TYPE bigint USING "accrual"::bigint * 100;
+
+ALTER TABLE "balances"
+    ALTER COLUMN "current_amount" TYPE bigint USING "current_amount"::bigint * 100,
+    ALTER COLUMN "withdrawn_amount" TYPE bigint USING "withdrawn_amount"::bigint * 100;
+
+ALTER TABLE "withdrawals"
+    ALTER COLUMN "sum" TYPE bigint USING "sum"::bigint * 100;
@@ -0,0 +1,5 @@
+DROP VIEW "ledger_balance_discrepancies";
+DROP TABLE "ledger_entries";
+DROP TABLE "ledger_transactions";
+DROP FUNCTION "check_ledger_transaction_balanced";
+DROP FUNCTION "forbid_ledger_changes";
@@ -0,0 +1,81 @@
+CREATE TABLE "ledger_transactions" (
+    "id" bigserial PRIMARY KEY,
+    "kind" integer NOT NULL,
+    "order_number" varchar(255) NOT NULL,
+    "created_at" timestamptz NOT NULL
+);
+
+CREATE TABLE "ledger_entries" (
+    "id" bigserial PRIMARY KEY,
+    "transaction_id" bigint references "ledger_transactions"("id") NOT NULL,
+    "account" varchar(64) NOT NULL,
+    "user_id" bigint references "users"("id"),
+    "amount" bigint NOT NULL,
+    CHECK (("account" = 'user') = ("user_id" IS NOT NULL))
+);
+
+CREATE INDEX "ledger_entries_user_id_idx" ON "ledger_entries" ("user_id");
+CREATE INDEX "ledger_entries_transaction_id_idx" ON "ledger_entries" ("transaction_id");
+
+CREATE FUNCTION "forbid_ledger_changes"() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "ledger_transactions_append_only"
+    BEFORE UPDATE OR DELETE ON "ledger_transactions"
+    FOR EACH ROW EXECUTE FUNCTION "forbid_ledger_changes"();
+
+CREATE TRIGGER "ledger_entries_append_only"
+    BEFORE UPDATE OR DELETE ON "ledger_entries"
+    FOR EACH ROW EXECUTE FUNCTION "forbid_ledger_changes"();
+
+CREATE FUNCTION "check_ledger_transaction_balanced"() RETURNS trigger AS $$
+BEGIN
+    IF (SELECT sum("amount") FROM "ledger_entries" WHERE "transaction_id" = NEW."transaction_id") <> 0 THEN
+        RAISE EXCEPTION 'ledger transaction % is not balanced', NEW."transaction_id";
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER "ledger_entries_balanced"
+    AFTER INSERT ON "ledger_entries"
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION "check_ledger_transaction_balanced"();
+
+INSERT INTO "ledger_transactions" ("kind", "order_number", "created_at")
+SELECT 0, "number", "created_at" FROM "orders" WHERE "status" = 4 AND "accrual" > 0;
+
+INSERT INTO "ledger_entries" ("transaction_id", "account", "user_id", "amount")
+SELECT t."id", 'user', o."user_id", o."accrual"
+FROM "ledger_transactions" t JOIN "orders" o ON o."number" = t."order_number"
+WHERE t."kind" = 0
+UNION ALL
+SELECT t."id", 'accruals', NULL, -o."accrual"
+FROM "ledger_transactions" t JOIN "orders" o ON o."number" = t."order_number"
+WHERE t."kind" = 0;
+
+INSERT INTO "ledger_transactions" ("kind", "order_number", "created_at")
+SELECT 1, "order_number", "processed_at" FROM "withdrawals";
+
+INSERT INTO "ledger_entries" ("transaction_id", "account", "user_id", "amount")
+SELECT t."id", 'user', w."user_id", -w."sum"
+FROM "ledger_transactions" t JOIN "withdrawals" w ON w."order_number" = t."order_number"
+WHERE t."kind" = 1
+UNION ALL
+SELECT t."id", 'withdrawals', NULL, w."sum"
+FROM "ledger_transactions" t JOIN "withdrawals" w ON w."order_number" = t."order_number"
+WHERE t."kind" = 1;
+
+CREATE VIEW "ledger_balance_discrepancies" AS
+SELECT b."user_id", b."current_amount", COALESCE(l."amount", 0) AS "ledger_amount"
+FROM "balances" b
+LEFT JOIN (
+    SELECT "user_id", sum("amount") AS "amount"
+    FROM "ledger_entries"
+    WHERE "account" = 'user'
+    GROUP BY "user_id"
+) l ON l."user_id" = b."user_id"
+WHERE b."current_amount" <> COALESCE(l."amount", 0);
@@ -0,0 +1,12 @@
+CREATE TABLE "refresh_tokens" (
+    "id" bigserial PRIMARY KEY,
+    "user_id" bigint references "users"("id") NOT NULL,
+    "family_id" varchar(64) NOT NULL,
+    "token_hash" varchar(64) UNIQUE NOT NULL,
+    "expires_at" timestamptz NOT NULL,
+    "used_at" timestamptz,
+    "revoked_at" timestamptz,
+    "created_at" timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX "refresh_tokens_family_id_idx" ON "refresh_tokens" ("family_id");
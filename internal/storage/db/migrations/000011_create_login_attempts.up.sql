@@ -0,0 +1,6 @@
+CREATE TABLE "login_attempts" (
+    "key" varchar(320) PRIMARY KEY,
+    "failures" integer NOT NULL DEFAULT 0,
+    "last_failure_at" timestamptz NOT NULL,
+    "locked_until" timestamptz
+);
@@ -0,0 +1,8 @@
+CREATE TABLE "password_reset_tokens" (
+    "id" bigserial PRIMARY KEY,
+    "user_id" bigint references "users"("id") NOT NULL,
+    "token_hash" varchar(64) UNIQUE NOT NULL,
+    "expires_at" timestamptz NOT NULL,
+    "used_at" timestamptz,
+    "created_at" timestamptz NOT NULL DEFAULT now()
+);
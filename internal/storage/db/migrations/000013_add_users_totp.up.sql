@@ -0,0 +1,12 @@
+ALTER TABLE "users"
+    ADD COLUMN "totp_secret" varchar(64) NOT NULL DEFAULT '',
+    ADD COLUMN "totp_enabled" boolean NOT NULL DEFAULT false,
+    ADD COLUMN "totp_last_step" bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE "recovery_codes" (
+    "id" bigserial PRIMARY KEY,
+    "user_id" bigint references "users"("id") NOT NULL,
+    "code_hash" varchar(64) NOT NULL,
+    "used_at" timestamptz,
+    UNIQUE ("user_id", "code_hash")
+);
@@ -0,0 +1,12 @@
+CREATE TABLE "api_keys" (
+    "id" bigserial PRIMARY KEY,
+    "user_id" bigint references "users"("id") NOT NULL,
+    "name" varchar(64) NOT NULL,
+    "prefix" varchar(16) NOT NULL,
+    "key_hash" varchar(64) UNIQUE NOT NULL,
+    "scopes" text[] NOT NULL,
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    "last_used_at" timestamptz,
+    "revoked_at" timestamptz
+);
+CREATE INDEX "api_keys_user_id_idx" ON "api_keys" ("user_id");
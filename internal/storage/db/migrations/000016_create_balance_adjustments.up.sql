@@ -0,0 +1,14 @@
+CREATE TABLE "balance_adjustments" (
+    "id" bigserial PRIMARY KEY,
+    "user_id" bigint references "users"("id") NOT NULL,
+    "operator_id" bigint references "users"("id") NOT NULL,
+    "amount" bigint NOT NULL CHECK ("amount" <> 0),
+    "reason" text NOT NULL CHECK (btrim("reason") <> ''),
+    "created_at" timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX "balance_adjustments_user_id_idx" ON "balance_adjustments" ("user_id");
+
+CREATE TRIGGER "balance_adjustments_append_only"
+    BEFORE UPDATE OR DELETE ON "balance_adjustments"
+    FOR EACH ROW EXECUTE FUNCTION "forbid_ledger_changes"();
@@ -0,0 +1,10 @@
+CREATE TABLE "idempotency_keys" (
+    "user_id" bigint references "users"("id") NOT NULL,
+    "key" varchar(255) NOT NULL,
+    "request_hash" varchar(64) NOT NULL,
+    "status_code" integer,
+    "content_type" varchar(255) NOT NULL DEFAULT '',
+    "body" bytea,
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY ("user_id", "key")
+);
@@ -0,0 +1,4 @@
+ALTER TABLE "withdrawals"
+    DROP COLUMN "reversed_at",
+    DROP COLUMN "reversed_by",
+    DROP COLUMN "reversal_reason";
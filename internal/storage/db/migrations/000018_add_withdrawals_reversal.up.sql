@@ -0,0 +1,4 @@
+ALTER TABLE "withdrawals"
+    ADD COLUMN "reversed_at" timestamptz,
+    ADD COLUMN "reversed_by" bigint references "users"("id"),
+    ADD COLUMN "reversal_reason" text;
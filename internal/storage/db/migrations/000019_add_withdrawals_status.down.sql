@@ -0,0 +1,8 @@
+ALTER TABLE "withdrawals"
+    DROP COLUMN "status",
+    DROP COLUMN "settled_at",
+    DROP COLUMN "attempts",
+    DROP COLUMN "last_error",
+    DROP COLUMN "next_attempt_at",
+    DROP COLUMN "locked_by",
+    DROP COLUMN "locked_until";
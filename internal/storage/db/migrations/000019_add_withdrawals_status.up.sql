@@ -0,0 +1,14 @@
+ALTER TABLE "withdrawals"
+    ADD COLUMN "status" integer NOT NULL DEFAULT 1,
+    ADD COLUMN "settled_at" timestamptz,
+    ADD COLUMN "attempts" integer NOT NULL DEFAULT 0,
+    ADD COLUMN "last_error" text NOT NULL DEFAULT '',
+    ADD COLUMN "next_attempt_at" timestamptz NOT NULL DEFAULT now(),
+    ADD COLUMN "locked_by" varchar(255),
+    ADD COLUMN "locked_until" timestamptz;
+
+UPDATE "withdrawals" SET "settled_at" = "processed_at";
+
+ALTER TABLE "withdrawals" ALTER COLUMN "status" SET DEFAULT 0;
+
+CREATE INDEX "withdrawals_status_next_attempt_at_idx" ON "withdrawals" ("status", "next_attempt_at");
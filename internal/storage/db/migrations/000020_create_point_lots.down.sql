@@ -0,0 +1,2 @@
+DROP TABLE "point_lot_debits";
+DROP TABLE "point_lots";
@@ -0,0 +1,23 @@
+CREATE TABLE "point_lots" (
+    "id" bigserial PRIMARY KEY,
+    "user_id" bigint references "users"("id") NOT NULL,
+    "order_number" varchar(255),
+    "amount" bigint NOT NULL CHECK ("amount" > 0),
+    "remaining" bigint NOT NULL CHECK ("remaining" >= 0 AND "remaining" <= "amount"),
+    "accrued_at" timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX "point_lots_user_id_accrued_at_idx" ON "point_lots" ("user_id", "accrued_at") WHERE "remaining" > 0;
+
+CREATE TABLE "point_lot_debits" (
+    "id" bigserial PRIMARY KEY,
+    "lot_id" bigint references "point_lots"("id") NOT NULL,
+    "order_number" varchar(255),
+    "amount" bigint NOT NULL CHECK ("amount" > 0)
+);
+
+CREATE INDEX "point_lot_debits_order_number_idx" ON "point_lot_debits" ("order_number");
+
+-- points accrued before lots were tracked start their lifetime now
+INSERT INTO "point_lots" ("user_id", "amount", "remaining")
+SELECT "user_id", "current_amount", "current_amount" FROM "balances" WHERE "current_amount" > 0;
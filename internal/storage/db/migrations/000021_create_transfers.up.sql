@@ -0,0 +1,9 @@
+CREATE TABLE "transfers" (
+    "id" bigserial PRIMARY KEY,
+    "sender_id" bigint references "users"("id") NOT NULL,
+    "recipient_id" bigint references "users"("id") NOT NULL CHECK ("recipient_id" <> "sender_id"),
+    "sum" bigint NOT NULL CHECK ("sum" > 0),
+    "created_at" timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX "transfers_sender_id_created_at_idx" ON "transfers" ("sender_id", "created_at");
@@ -0,0 +1,3 @@
+UPDATE "balances" SET "withdrawn_amount" = "withdrawn_amount" + "held_amount";
+
+ALTER TABLE "balances" DROP COLUMN "held_amount";
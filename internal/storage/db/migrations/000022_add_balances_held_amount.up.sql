@@ -0,0 +1,13 @@
+ALTER TABLE "balances"
+    ADD COLUMN "held_amount" bigint NOT NULL DEFAULT 0 CONSTRAINT "balances_held_amount_check" CHECK ("held_amount" >= 0);
+
+UPDATE "balances"
+SET "held_amount" = "pending"."sum",
+    "withdrawn_amount" = "balances"."withdrawn_amount" - "pending"."sum"
+FROM (
+    SELECT "user_id", SUM("sum") AS "sum"
+    FROM "withdrawals"
+    WHERE "status" = 0
+    GROUP BY "user_id"
+) AS "pending"
+WHERE "balances"."user_id" = "pending"."user_id";
@@ -38,18 +38,84 @@ func (err ErrOrderNotFound) Error() string {
 	return fmt.Sprintf("order with number \"%s\" not found", err.Order.Number)
 }
 
-type ErrBalanceNotUnique struct {
+type ErrBalanceNotFound struct {
 	Balance models.Balance
 }
 
-func (err ErrBalanceNotUnique) Error() string {
-	return fmt.Sprintf("balance with \"user_id\"=%d already exists", err.Balance.UserID)
+func (err ErrBalanceNotFound) Error() string {
+	return fmt.Sprintf("balance with \"user_id\"=%d not found", err.Balance.UserID)
 }
 
-type ErrBalanceNotFound struct {
-	Balance models.Balance
+type ErrOrderLeaseLost struct {
+	OrderID int
+	Owner   string
 }
 
-func (err ErrBalanceNotFound) Error() string {
-	return fmt.Sprintf("balance with \"user_id\"=%d not found", err.Balance.UserID)
+func (err ErrOrderLeaseLost) Error() string {
+	return fmt.Sprintf("order id=%d is no longer leased by \"%s\"", err.OrderID, err.Owner)
+}
+
+type ErrInsufficientBalance struct {
+	UserID int
+	Amount models.Money
+}
+
+func (err ErrInsufficientBalance) Error() string {
+	return fmt.Sprintf("balance with \"user_id\"=%d has less than %s", err.UserID, err.Amount)
+}
+
+type ErrRefreshTokenNotFound struct{}
+
+func (err ErrRefreshTokenNotFound) Error() string {
+	return "refresh token not found"
+}
+
+type ErrPasswordResetTokenNotFound struct{}
+
+func (err ErrPasswordResetTokenNotFound) Error() string {
+	return "password reset token not found or expired"
+}
+
+type ErrTOTPAlreadyEnabled struct {
+	UserID int
+}
+
+func (err ErrTOTPAlreadyEnabled) Error() string {
+	return fmt.Sprintf("two-factor authentication is already enabled for user id=%d", err.UserID)
+}
+
+type ErrAPIKeyNotFound struct {
+	ID int
+}
+
+func (err ErrAPIKeyNotFound) Error() string {
+	if err.ID == 0 {
+		return "api key not found"
+	}
+	return fmt.Sprintf("api key id=%d not found", err.ID)
+}
+
+type ErrIdempotencyKeyNotFound struct {
+	Key string
+}
+
+func (err ErrIdempotencyKeyNotFound) Error() string {
+	return fmt.Sprintf("idempotency key \"%s\" not found", err.Key)
+}
+
+type ErrWithdrawalNotFound struct {
+	OrderNumber string
+}
+
+func (err ErrWithdrawalNotFound) Error() string {
+	return fmt.Sprintf("withdrawal for order \"%s\" not found", err.OrderNumber)
+}
+
+type ErrWithdrawalLeaseLost struct {
+	WithdrawalID int
+	Owner        string
+}
+
+func (err ErrWithdrawalLeaseLost) Error() string {
+	return fmt.Sprintf("withdrawal id=%d is no longer leased by \"%s\"", err.WithdrawalID, err.Owner)
 }
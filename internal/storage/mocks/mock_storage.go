@@ -7,6 +7,7 @@ package mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	models "github.com/ilya-burinskiy/gophermart/internal/models"
@@ -36,6 +37,52 @@ func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
 	return m.recorder
 }
 
+// ClaimIdempotencyKey mocks base method.
+func (m *MockStorage) ClaimIdempotencyKey(arg0 context.Context, arg1 models.IdempotencyKey, arg2 time.Duration) (models.IdempotencyKey, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimIdempotencyKey", arg0, arg1, arg2)
+	ret0, _ := ret[0].(models.IdempotencyKey)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ClaimIdempotencyKey indicates an expected call of ClaimIdempotencyKey.
+func (mr *MockStorageMockRecorder) ClaimIdempotencyKey(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimIdempotencyKey", reflect.TypeOf((*MockStorage)(nil).ClaimIdempotencyKey), arg0, arg1, arg2)
+}
+
+// ClaimOrders mocks base method.
+func (m *MockStorage) ClaimOrders(arg0 context.Context, arg1 string, arg2 int, arg3 time.Duration) ([]models.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimOrders", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]models.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimOrders indicates an expected call of ClaimOrders.
+func (mr *MockStorageMockRecorder) ClaimOrders(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimOrders", reflect.TypeOf((*MockStorage)(nil).ClaimOrders), arg0, arg1, arg2, arg3)
+}
+
+// ClaimWithdrawals mocks base method.
+func (m *MockStorage) ClaimWithdrawals(arg0 context.Context, arg1 string, arg2 int, arg3 time.Duration) ([]models.Withdrawal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimWithdrawals", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]models.Withdrawal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimWithdrawals indicates an expected call of ClaimWithdrawals.
+func (mr *MockStorageMockRecorder) ClaimWithdrawals(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimWithdrawals", reflect.TypeOf((*MockStorage)(nil).ClaimWithdrawals), arg0, arg1, arg2, arg3)
+}
+
 // Close mocks base method.
 func (m *MockStorage) Close() {
 	m.ctrl.T.Helper()
@@ -48,19 +95,78 @@ func (mr *MockStorageMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStorage)(nil).Close))
 }
 
-// CreateBalanceTx mocks base method.
-func (m *MockStorage) CreateBalanceTx(arg0 context.Context, arg1 pgx.Tx, arg2, arg3 int) (models.Balance, error) {
+// CompleteOrderTx mocks base method.
+func (m *MockStorage) CompleteOrderTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3 string, arg4 models.OrderStatus, arg5 models.Money) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateBalanceTx", arg0, arg1, arg2, arg3)
-	ret0, _ := ret[0].(models.Balance)
+	ret := m.ctrl.Call(m, "CompleteOrderTx", arg0, arg1, arg2, arg3, arg4, arg5)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompleteOrderTx indicates an expected call of CompleteOrderTx.
+func (mr *MockStorageMockRecorder) CompleteOrderTx(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteOrderTx", reflect.TypeOf((*MockStorage)(nil).CompleteOrderTx), arg0, arg1, arg2, arg3, arg4, arg5)
+}
+
+// ConsumePointLotsTx mocks base method.
+func (m *MockStorage) ConsumePointLotsTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3 string, arg4 models.Money) ([]models.PointLot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumePointLotsTx", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].([]models.PointLot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumePointLotsTx indicates an expected call of ConsumePointLotsTx.
+func (mr *MockStorageMockRecorder) ConsumePointLotsTx(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumePointLotsTx", reflect.TypeOf((*MockStorage)(nil).ConsumePointLotsTx), arg0, arg1, arg2, arg3, arg4)
+}
+
+// CreateAPIKey mocks base method.
+func (m *MockStorage) CreateAPIKey(arg0 context.Context, arg1 models.APIKey) (models.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAPIKey", arg0, arg1)
+	ret0, _ := ret[0].(models.APIKey)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// CreateBalanceTx indicates an expected call of CreateBalanceTx.
-func (mr *MockStorageMockRecorder) CreateBalanceTx(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+// CreateAPIKey indicates an expected call of CreateAPIKey.
+func (mr *MockStorageMockRecorder) CreateAPIKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAPIKey", reflect.TypeOf((*MockStorage)(nil).CreateAPIKey), arg0, arg1)
+}
+
+// CreateBalanceAdjustmentTx mocks base method.
+func (m *MockStorage) CreateBalanceAdjustmentTx(arg0 context.Context, arg1 pgx.Tx, arg2 models.BalanceAdjustment) (models.BalanceAdjustment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateBalanceAdjustmentTx", arg0, arg1, arg2)
+	ret0, _ := ret[0].(models.BalanceAdjustment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateBalanceAdjustmentTx indicates an expected call of CreateBalanceAdjustmentTx.
+func (mr *MockStorageMockRecorder) CreateBalanceAdjustmentTx(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBalanceAdjustmentTx", reflect.TypeOf((*MockStorage)(nil).CreateBalanceAdjustmentTx), arg0, arg1, arg2)
+}
+
+// CreateLedgerTransactionTx mocks base method.
+func (m *MockStorage) CreateLedgerTransactionTx(arg0 context.Context, arg1 pgx.Tx, arg2 models.LedgerEntryKind, arg3 string, arg4 []models.LedgerEntry) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateLedgerTransactionTx", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateLedgerTransactionTx indicates an expected call of CreateLedgerTransactionTx.
+func (mr *MockStorageMockRecorder) CreateLedgerTransactionTx(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBalanceTx", reflect.TypeOf((*MockStorage)(nil).CreateBalanceTx), arg0, arg1, arg2, arg3)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLedgerTransactionTx", reflect.TypeOf((*MockStorage)(nil).CreateLedgerTransactionTx), arg0, arg1, arg2, arg3, arg4)
 }
 
 // CreateOrder mocks base method.
@@ -78,6 +184,63 @@ func (mr *MockStorageMockRecorder) CreateOrder(arg0, arg1, arg2, arg3 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrder", reflect.TypeOf((*MockStorage)(nil).CreateOrder), arg0, arg1, arg2, arg3)
 }
 
+// CreatePasswordResetToken mocks base method.
+func (m *MockStorage) CreatePasswordResetToken(arg0 context.Context, arg1 int, arg2 string, arg3 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePasswordResetToken", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePasswordResetToken indicates an expected call of CreatePasswordResetToken.
+func (mr *MockStorageMockRecorder) CreatePasswordResetToken(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePasswordResetToken", reflect.TypeOf((*MockStorage)(nil).CreatePasswordResetToken), arg0, arg1, arg2, arg3)
+}
+
+// CreatePointLotTx mocks base method.
+func (m *MockStorage) CreatePointLotTx(arg0 context.Context, arg1 pgx.Tx, arg2 models.PointLot) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePointLotTx", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePointLotTx indicates an expected call of CreatePointLotTx.
+func (mr *MockStorageMockRecorder) CreatePointLotTx(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePointLotTx", reflect.TypeOf((*MockStorage)(nil).CreatePointLotTx), arg0, arg1, arg2)
+}
+
+// CreateRefreshTokenTx mocks base method.
+func (m *MockStorage) CreateRefreshTokenTx(arg0 context.Context, arg1 pgx.Tx, arg2 models.RefreshToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateRefreshTokenTx", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateRefreshTokenTx indicates an expected call of CreateRefreshTokenTx.
+func (mr *MockStorageMockRecorder) CreateRefreshTokenTx(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRefreshTokenTx", reflect.TypeOf((*MockStorage)(nil).CreateRefreshTokenTx), arg0, arg1, arg2)
+}
+
+// CreateTransferTx mocks base method.
+func (m *MockStorage) CreateTransferTx(arg0 context.Context, arg1 pgx.Tx, arg2 models.Transfer) (models.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateTransferTx", arg0, arg1, arg2)
+	ret0, _ := ret[0].(models.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateTransferTx indicates an expected call of CreateTransferTx.
+func (mr *MockStorageMockRecorder) CreateTransferTx(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTransferTx", reflect.TypeOf((*MockStorage)(nil).CreateTransferTx), arg0, arg1, arg2)
+}
+
 // CreateUser mocks base method.
 func (m *MockStorage) CreateUser(arg0 context.Context, arg1, arg2 string) (models.User, error) {
 	m.ctrl.T.Helper()
@@ -94,7 +257,7 @@ func (mr *MockStorageMockRecorder) CreateUser(arg0, arg1, arg2 interface{}) *gom
 }
 
 // CreateWithdrawalTx mocks base method.
-func (m *MockStorage) CreateWithdrawalTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3 string, arg4 int) (models.Withdrawal, error) {
+func (m *MockStorage) CreateWithdrawalTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3 string, arg4 models.Money) (models.Withdrawal, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "CreateWithdrawalTx", arg0, arg1, arg2, arg3, arg4)
 	ret0, _ := ret[0].(models.Withdrawal)
@@ -108,18 +271,91 @@ func (mr *MockStorageMockRecorder) CreateWithdrawalTx(arg0, arg1, arg2, arg3, ar
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWithdrawalTx", reflect.TypeOf((*MockStorage)(nil).CreateWithdrawalTx), arg0, arg1, arg2, arg3, arg4)
 }
 
-// DeleteOrder mocks base method.
-func (m *MockStorage) DeleteOrder(arg0 context.Context, arg1 int) error {
+// CreditBalanceTx mocks base method.
+func (m *MockStorage) CreditBalanceTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3 models.Money) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteOrder", arg0, arg1)
+	ret := m.ctrl.Call(m, "CreditBalanceTx", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// DeleteOrder indicates an expected call of DeleteOrder.
-func (mr *MockStorageMockRecorder) DeleteOrder(arg0, arg1 interface{}) *gomock.Call {
+// CreditBalanceTx indicates an expected call of CreditBalanceTx.
+func (mr *MockStorageMockRecorder) CreditBalanceTx(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteOrder", reflect.TypeOf((*MockStorage)(nil).DeleteOrder), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreditBalanceTx", reflect.TypeOf((*MockStorage)(nil).CreditBalanceTx), arg0, arg1, arg2, arg3)
+}
+
+// DebitBalanceTx mocks base method.
+func (m *MockStorage) DebitBalanceTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3 models.Money) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DebitBalanceTx", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DebitBalanceTx indicates an expected call of DebitBalanceTx.
+func (mr *MockStorageMockRecorder) DebitBalanceTx(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DebitBalanceTx", reflect.TypeOf((*MockStorage)(nil).DebitBalanceTx), arg0, arg1, arg2, arg3)
+}
+
+// DeleteStaleLoginAttempts mocks base method.
+func (m *MockStorage) DeleteStaleLoginAttempts(arg0 context.Context, arg1 time.Duration) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteStaleLoginAttempts", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteStaleLoginAttempts indicates an expected call of DeleteStaleLoginAttempts.
+func (mr *MockStorageMockRecorder) DeleteStaleLoginAttempts(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteStaleLoginAttempts", reflect.TypeOf((*MockStorage)(nil).DeleteStaleLoginAttempts), arg0, arg1)
+}
+
+// EnableUserTOTPTx mocks base method.
+func (m *MockStorage) EnableUserTOTPTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableUserTOTPTx", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableUserTOTPTx indicates an expected call of EnableUserTOTPTx.
+func (mr *MockStorageMockRecorder) EnableUserTOTPTx(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableUserTOTPTx", reflect.TypeOf((*MockStorage)(nil).EnableUserTOTPTx), arg0, arg1, arg2, arg3)
+}
+
+// ExpirePointLotsTx mocks base method.
+func (m *MockStorage) ExpirePointLotsTx(arg0 context.Context, arg1 pgx.Tx, arg2, arg3 int) (models.Money, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpirePointLotsTx", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(models.Money)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExpirePointLotsTx indicates an expected call of ExpirePointLotsTx.
+func (mr *MockStorageMockRecorder) ExpirePointLotsTx(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpirePointLotsTx", reflect.TypeOf((*MockStorage)(nil).ExpirePointLotsTx), arg0, arg1, arg2, arg3)
+}
+
+// ExpiringPoints mocks base method.
+func (m *MockStorage) ExpiringPoints(arg0 context.Context, arg1, arg2 int, arg3 time.Duration) (models.Money, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpiringPoints", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(models.Money)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExpiringPoints indicates an expected call of ExpiringPoints.
+func (mr *MockStorageMockRecorder) ExpiringPoints(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpiringPoints", reflect.TypeOf((*MockStorage)(nil).ExpiringPoints), arg0, arg1, arg2, arg3)
 }
 
 // FindBalanceByUserID mocks base method.
@@ -137,19 +373,19 @@ func (mr *MockStorageMockRecorder) FindBalanceByUserID(arg0, arg1 interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindBalanceByUserID", reflect.TypeOf((*MockStorage)(nil).FindBalanceByUserID), arg0, arg1)
 }
 
-// FindBalanceByUserIDTx mocks base method.
-func (m *MockStorage) FindBalanceByUserIDTx(arg0 context.Context, arg1 pgx.Tx, arg2 int) (models.Balance, error) {
+// FindLoginLockout mocks base method.
+func (m *MockStorage) FindLoginLockout(arg0 context.Context, arg1 []string) (time.Time, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindBalanceByUserIDTx", arg0, arg1, arg2)
-	ret0, _ := ret[0].(models.Balance)
+	ret := m.ctrl.Call(m, "FindLoginLockout", arg0, arg1)
+	ret0, _ := ret[0].(time.Time)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// FindBalanceByUserIDTx indicates an expected call of FindBalanceByUserIDTx.
-func (mr *MockStorageMockRecorder) FindBalanceByUserIDTx(arg0, arg1, arg2 interface{}) *gomock.Call {
+// FindLoginLockout indicates an expected call of FindLoginLockout.
+func (mr *MockStorageMockRecorder) FindLoginLockout(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindBalanceByUserIDTx", reflect.TypeOf((*MockStorage)(nil).FindBalanceByUserIDTx), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindLoginLockout", reflect.TypeOf((*MockStorage)(nil).FindLoginLockout), arg0, arg1)
 }
 
 // FindOrderByNumber mocks base method.
@@ -167,6 +403,36 @@ func (mr *MockStorageMockRecorder) FindOrderByNumber(arg0, arg1 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOrderByNumber", reflect.TypeOf((*MockStorage)(nil).FindOrderByNumber), arg0, arg1)
 }
 
+// FindRefreshTokenTx mocks base method.
+func (m *MockStorage) FindRefreshTokenTx(arg0 context.Context, arg1 pgx.Tx, arg2 string) (models.RefreshToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindRefreshTokenTx", arg0, arg1, arg2)
+	ret0, _ := ret[0].(models.RefreshToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindRefreshTokenTx indicates an expected call of FindRefreshTokenTx.
+func (mr *MockStorageMockRecorder) FindRefreshTokenTx(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindRefreshTokenTx", reflect.TypeOf((*MockStorage)(nil).FindRefreshTokenTx), arg0, arg1, arg2)
+}
+
+// FindUserByID mocks base method.
+func (m *MockStorage) FindUserByID(arg0 context.Context, arg1 int) (models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindUserByID", arg0, arg1)
+	ret0, _ := ret[0].(models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindUserByID indicates an expected call of FindUserByID.
+func (mr *MockStorageMockRecorder) FindUserByID(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUserByID", reflect.TypeOf((*MockStorage)(nil).FindUserByID), arg0, arg1)
+}
+
 // FindUserByLogin mocks base method.
 func (m *MockStorage) FindUserByLogin(arg0 context.Context, arg1 string) (models.User, error) {
 	m.ctrl.T.Helper()
@@ -182,61 +448,551 @@ func (mr *MockStorageMockRecorder) FindUserByLogin(arg0, arg1 interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUserByLogin", reflect.TypeOf((*MockStorage)(nil).FindUserByLogin), arg0, arg1)
 }
 
-// NewOrders mocks base method.
-func (m *MockStorage) NewOrders(arg0 context.Context) ([]models.Order, error) {
+// FindWithdrawalForUpdateTx mocks base method.
+func (m *MockStorage) FindWithdrawalForUpdateTx(arg0 context.Context, arg1 pgx.Tx, arg2 string) (models.Withdrawal, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "NewOrders", arg0)
-	ret0, _ := ret[0].([]models.Order)
+	ret := m.ctrl.Call(m, "FindWithdrawalForUpdateTx", arg0, arg1, arg2)
+	ret0, _ := ret[0].(models.Withdrawal)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// NewOrders indicates an expected call of NewOrders.
-func (mr *MockStorageMockRecorder) NewOrders(arg0 interface{}) *gomock.Call {
+// FindWithdrawalForUpdateTx indicates an expected call of FindWithdrawalForUpdateTx.
+func (mr *MockStorageMockRecorder) FindWithdrawalForUpdateTx(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewOrders", reflect.TypeOf((*MockStorage)(nil).NewOrders), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindWithdrawalForUpdateTx", reflect.TypeOf((*MockStorage)(nil).FindWithdrawalForUpdateTx), arg0, arg1, arg2)
 }
 
-// UpdateBalanceCurrentAmountTx mocks base method.
-func (m *MockStorage) UpdateBalanceCurrentAmountTx(arg0 context.Context, arg1 pgx.Tx, arg2, arg3 int) error {
+// HoldBalanceTx mocks base method.
+func (m *MockStorage) HoldBalanceTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3 models.Money) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateBalanceCurrentAmountTx", arg0, arg1, arg2, arg3)
+	ret := m.ctrl.Call(m, "HoldBalanceTx", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// UpdateBalanceCurrentAmountTx indicates an expected call of UpdateBalanceCurrentAmountTx.
-func (mr *MockStorageMockRecorder) UpdateBalanceCurrentAmountTx(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+// HoldBalanceTx indicates an expected call of HoldBalanceTx.
+func (mr *MockStorageMockRecorder) HoldBalanceTx(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBalanceCurrentAmountTx", reflect.TypeOf((*MockStorage)(nil).UpdateBalanceCurrentAmountTx), arg0, arg1, arg2, arg3)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HoldBalanceTx", reflect.TypeOf((*MockStorage)(nil).HoldBalanceTx), arg0, arg1, arg2, arg3)
 }
 
-// UpdateBalanceWithdrawnAmountTx mocks base method.
-func (m *MockStorage) UpdateBalanceWithdrawnAmountTx(arg0 context.Context, arg1 pgx.Tx, arg2, arg3 int) error {
+// LockBalancesTx mocks base method.
+func (m *MockStorage) LockBalancesTx(arg0 context.Context, arg1 pgx.Tx, arg2 []int) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateBalanceWithdrawnAmountTx", arg0, arg1, arg2, arg3)
+	ret := m.ctrl.Call(m, "LockBalancesTx", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// UpdateBalanceWithdrawnAmountTx indicates an expected call of UpdateBalanceWithdrawnAmountTx.
-func (mr *MockStorageMockRecorder) UpdateBalanceWithdrawnAmountTx(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+// LockBalancesTx indicates an expected call of LockBalancesTx.
+func (mr *MockStorageMockRecorder) LockBalancesTx(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBalanceWithdrawnAmountTx", reflect.TypeOf((*MockStorage)(nil).UpdateBalanceWithdrawnAmountTx), arg0, arg1, arg2, arg3)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockBalancesTx", reflect.TypeOf((*MockStorage)(nil).LockBalancesTx), arg0, arg1, arg2)
+}
+
+// LockLogin mocks base method.
+func (m *MockStorage) LockLogin(arg0 context.Context, arg1 string, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LockLogin", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LockLogin indicates an expected call of LockLogin.
+func (mr *MockStorageMockRecorder) LockLogin(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockLogin", reflect.TypeOf((*MockStorage)(nil).LockLogin), arg0, arg1, arg2)
+}
+
+// MarkRefreshTokenUsedTx mocks base method.
+func (m *MockStorage) MarkRefreshTokenUsedTx(arg0 context.Context, arg1 pgx.Tx, arg2 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkRefreshTokenUsedTx", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkRefreshTokenUsedTx indicates an expected call of MarkRefreshTokenUsedTx.
+func (mr *MockStorageMockRecorder) MarkRefreshTokenUsedTx(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkRefreshTokenUsedTx", reflect.TypeOf((*MockStorage)(nil).MarkRefreshTokenUsedTx), arg0, arg1, arg2)
+}
+
+// RecordLoginFailure mocks base method.
+func (m *MockStorage) RecordLoginFailure(arg0 context.Context, arg1 string, arg2 time.Duration) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordLoginFailure", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RecordLoginFailure indicates an expected call of RecordLoginFailure.
+func (mr *MockStorageMockRecorder) RecordLoginFailure(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordLoginFailure", reflect.TypeOf((*MockStorage)(nil).RecordLoginFailure), arg0, arg1, arg2)
+}
+
+// RecordOrderFailure mocks base method.
+func (m *MockStorage) RecordOrderFailure(arg0 context.Context, arg1 int, arg2 string, arg3 models.OrderStatus, arg4 string, arg5 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordOrderFailure", arg0, arg1, arg2, arg3, arg4, arg5)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordOrderFailure indicates an expected call of RecordOrderFailure.
+func (mr *MockStorageMockRecorder) RecordOrderFailure(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordOrderFailure", reflect.TypeOf((*MockStorage)(nil).RecordOrderFailure), arg0, arg1, arg2, arg3, arg4, arg5)
+}
+
+// RecordWithdrawalFailure mocks base method.
+func (m *MockStorage) RecordWithdrawalFailure(arg0 context.Context, arg1 int, arg2, arg3 string, arg4 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordWithdrawalFailure", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordWithdrawalFailure indicates an expected call of RecordWithdrawalFailure.
+func (mr *MockStorageMockRecorder) RecordWithdrawalFailure(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordWithdrawalFailure", reflect.TypeOf((*MockStorage)(nil).RecordWithdrawalFailure), arg0, arg1, arg2, arg3, arg4)
+}
+
+// RefundBalanceTx mocks base method.
+func (m *MockStorage) RefundBalanceTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3 models.Money) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefundBalanceTx", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RefundBalanceTx indicates an expected call of RefundBalanceTx.
+func (mr *MockStorageMockRecorder) RefundBalanceTx(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefundBalanceTx", reflect.TypeOf((*MockStorage)(nil).RefundBalanceTx), arg0, arg1, arg2, arg3)
+}
+
+// RehashUserPasswordTx mocks base method.
+func (m *MockStorage) RehashUserPasswordTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3, arg4 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RehashUserPasswordTx", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RehashUserPasswordTx indicates an expected call of RehashUserPasswordTx.
+func (mr *MockStorageMockRecorder) RehashUserPasswordTx(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RehashUserPasswordTx", reflect.TypeOf((*MockStorage)(nil).RehashUserPasswordTx), arg0, arg1, arg2, arg3, arg4)
+}
+
+// ReleaseHeldBalanceTx mocks base method.
+func (m *MockStorage) ReleaseHeldBalanceTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3 models.Money) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseHeldBalanceTx", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseHeldBalanceTx indicates an expected call of ReleaseHeldBalanceTx.
+func (mr *MockStorageMockRecorder) ReleaseHeldBalanceTx(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseHeldBalanceTx", reflect.TypeOf((*MockStorage)(nil).ReleaseHeldBalanceTx), arg0, arg1, arg2, arg3)
+}
+
+// ReleaseIdempotencyKey mocks base method.
+func (m *MockStorage) ReleaseIdempotencyKey(arg0 context.Context, arg1 int, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseIdempotencyKey", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseIdempotencyKey indicates an expected call of ReleaseIdempotencyKey.
+func (mr *MockStorageMockRecorder) ReleaseIdempotencyKey(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseIdempotencyKey", reflect.TypeOf((*MockStorage)(nil).ReleaseIdempotencyKey), arg0, arg1, arg2)
+}
+
+// ReplaceRecoveryCodesTx mocks base method.
+func (m *MockStorage) ReplaceRecoveryCodesTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3 []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceRecoveryCodesTx", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplaceRecoveryCodesTx indicates an expected call of ReplaceRecoveryCodesTx.
+func (mr *MockStorageMockRecorder) ReplaceRecoveryCodesTx(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceRecoveryCodesTx", reflect.TypeOf((*MockStorage)(nil).ReplaceRecoveryCodesTx), arg0, arg1, arg2, arg3)
+}
+
+// RescheduleOrder mocks base method.
+func (m *MockStorage) RescheduleOrder(arg0 context.Context, arg1 int, arg2 string, arg3 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RescheduleOrder", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RescheduleOrder indicates an expected call of RescheduleOrder.
+func (mr *MockStorageMockRecorder) RescheduleOrder(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RescheduleOrder", reflect.TypeOf((*MockStorage)(nil).RescheduleOrder), arg0, arg1, arg2, arg3)
+}
+
+// RescheduleWithdrawal mocks base method.
+func (m *MockStorage) RescheduleWithdrawal(arg0 context.Context, arg1 int, arg2 string, arg3 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RescheduleWithdrawal", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RescheduleWithdrawal indicates an expected call of RescheduleWithdrawal.
+func (mr *MockStorageMockRecorder) RescheduleWithdrawal(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RescheduleWithdrawal", reflect.TypeOf((*MockStorage)(nil).RescheduleWithdrawal), arg0, arg1, arg2, arg3)
+}
+
+// ResetLoginFailures mocks base method.
+func (m *MockStorage) ResetLoginFailures(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetLoginFailures", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetLoginFailures indicates an expected call of ResetLoginFailures.
+func (mr *MockStorageMockRecorder) ResetLoginFailures(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetLoginFailures", reflect.TypeOf((*MockStorage)(nil).ResetLoginFailures), arg0, arg1)
+}
+
+// ResetOrder mocks base method.
+func (m *MockStorage) ResetOrder(arg0 context.Context, arg1 int) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetOrder", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResetOrder indicates an expected call of ResetOrder.
+func (mr *MockStorageMockRecorder) ResetOrder(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetOrder", reflect.TypeOf((*MockStorage)(nil).ResetOrder), arg0, arg1)
+}
+
+// RestorePointLotsTx mocks base method.
+func (m *MockStorage) RestorePointLotsTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3 string, arg4 models.Money) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestorePointLotsTx", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestorePointLotsTx indicates an expected call of RestorePointLotsTx.
+func (mr *MockStorageMockRecorder) RestorePointLotsTx(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestorePointLotsTx", reflect.TypeOf((*MockStorage)(nil).RestorePointLotsTx), arg0, arg1, arg2, arg3, arg4)
+}
+
+// ReverseWithdrawalTx mocks base method.
+func (m *MockStorage) ReverseWithdrawalTx(arg0 context.Context, arg1 pgx.Tx, arg2, arg3 int, arg4 string) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReverseWithdrawalTx", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReverseWithdrawalTx indicates an expected call of ReverseWithdrawalTx.
+func (mr *MockStorageMockRecorder) ReverseWithdrawalTx(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReverseWithdrawalTx", reflect.TypeOf((*MockStorage)(nil).ReverseWithdrawalTx), arg0, arg1, arg2, arg3, arg4)
+}
+
+// RevokeAPIKey mocks base method.
+func (m *MockStorage) RevokeAPIKey(arg0 context.Context, arg1, arg2 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockStorageMockRecorder) RevokeAPIKey(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockStorage)(nil).RevokeAPIKey), arg0, arg1, arg2)
+}
+
+// RevokeRefreshTokenFamilyTx mocks base method.
+func (m *MockStorage) RevokeRefreshTokenFamilyTx(arg0 context.Context, arg1 pgx.Tx, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeRefreshTokenFamilyTx", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeRefreshTokenFamilyTx indicates an expected call of RevokeRefreshTokenFamilyTx.
+func (mr *MockStorageMockRecorder) RevokeRefreshTokenFamilyTx(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeRefreshTokenFamilyTx", reflect.TypeOf((*MockStorage)(nil).RevokeRefreshTokenFamilyTx), arg0, arg1, arg2)
+}
+
+// RevokeUserAPIKeysTx mocks base method.
+func (m *MockStorage) RevokeUserAPIKeysTx(arg0 context.Context, arg1 pgx.Tx, arg2 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeUserAPIKeysTx", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeUserAPIKeysTx indicates an expected call of RevokeUserAPIKeysTx.
+func (mr *MockStorageMockRecorder) RevokeUserAPIKeysTx(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeUserAPIKeysTx", reflect.TypeOf((*MockStorage)(nil).RevokeUserAPIKeysTx), arg0, arg1, arg2)
+}
+
+// RevokeUserRefreshTokensTx mocks base method.
+func (m *MockStorage) RevokeUserRefreshTokensTx(arg0 context.Context, arg1 pgx.Tx, arg2 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeUserRefreshTokensTx", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeUserRefreshTokensTx indicates an expected call of RevokeUserRefreshTokensTx.
+func (mr *MockStorageMockRecorder) RevokeUserRefreshTokensTx(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeUserRefreshTokensTx", reflect.TypeOf((*MockStorage)(nil).RevokeUserRefreshTokensTx), arg0, arg1, arg2)
+}
+
+// SaveIdempotentResponse mocks base method.
+func (m *MockStorage) SaveIdempotentResponse(arg0 context.Context, arg1 models.IdempotencyKey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveIdempotentResponse", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveIdempotentResponse indicates an expected call of SaveIdempotentResponse.
+func (mr *MockStorageMockRecorder) SaveIdempotentResponse(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveIdempotentResponse", reflect.TypeOf((*MockStorage)(nil).SaveIdempotentResponse), arg0, arg1)
+}
+
+// SearchUsers mocks base method.
+func (m *MockStorage) SearchUsers(arg0 context.Context, arg1 string, arg2 int) ([]models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchUsers", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchUsers indicates an expected call of SearchUsers.
+func (mr *MockStorageMockRecorder) SearchUsers(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchUsers", reflect.TypeOf((*MockStorage)(nil).SearchUsers), arg0, arg1, arg2)
+}
+
+// SetUserTOTPSecret mocks base method.
+func (m *MockStorage) SetUserTOTPSecret(arg0 context.Context, arg1 int, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserTOTPSecret", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserTOTPSecret indicates an expected call of SetUserTOTPSecret.
+func (mr *MockStorageMockRecorder) SetUserTOTPSecret(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserTOTPSecret", reflect.TypeOf((*MockStorage)(nil).SetUserTOTPSecret), arg0, arg1, arg2)
+}
+
+// SettleWithdrawalTx mocks base method.
+func (m *MockStorage) SettleWithdrawalTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3 models.WithdrawalStatus) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SettleWithdrawalTx", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SettleWithdrawalTx indicates an expected call of SettleWithdrawalTx.
+func (mr *MockStorageMockRecorder) SettleWithdrawalTx(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SettleWithdrawalTx", reflect.TypeOf((*MockStorage)(nil).SettleWithdrawalTx), arg0, arg1, arg2, arg3)
+}
+
+// SpendHeldBalanceTx mocks base method.
+func (m *MockStorage) SpendHeldBalanceTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3 models.Money) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SpendHeldBalanceTx", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SpendHeldBalanceTx indicates an expected call of SpendHeldBalanceTx.
+func (mr *MockStorageMockRecorder) SpendHeldBalanceTx(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SpendHeldBalanceTx", reflect.TypeOf((*MockStorage)(nil).SpendHeldBalanceTx), arg0, arg1, arg2, arg3)
+}
+
+// TransferredSinceTx mocks base method.
+func (m *MockStorage) TransferredSinceTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3 time.Time) (models.Money, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TransferredSinceTx", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(models.Money)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TransferredSinceTx indicates an expected call of TransferredSinceTx.
+func (mr *MockStorageMockRecorder) TransferredSinceTx(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransferredSinceTx", reflect.TypeOf((*MockStorage)(nil).TransferredSinceTx), arg0, arg1, arg2, arg3)
 }
 
 // UpdateOrderTx mocks base method.
-func (m *MockStorage) UpdateOrderTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3 models.OrderStatus, arg4 int) error {
+func (m *MockStorage) UpdateOrderTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3 string, arg4 models.OrderStatus, arg5 models.Money, arg6 time.Time) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateOrderTx", arg0, arg1, arg2, arg3, arg4)
+	ret := m.ctrl.Call(m, "UpdateOrderTx", arg0, arg1, arg2, arg3, arg4, arg5, arg6)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateOrderTx indicates an expected call of UpdateOrderTx.
-func (mr *MockStorageMockRecorder) UpdateOrderTx(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) UpdateOrderTx(arg0, arg1, arg2, arg3, arg4, arg5, arg6 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrderTx", reflect.TypeOf((*MockStorage)(nil).UpdateOrderTx), arg0, arg1, arg2, arg3, arg4)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrderTx", reflect.TypeOf((*MockStorage)(nil).UpdateOrderTx), arg0, arg1, arg2, arg3, arg4, arg5, arg6)
+}
+
+// UpdateUserPasswordTx mocks base method.
+func (m *MockStorage) UpdateUserPasswordTx(arg0 context.Context, arg1 pgx.Tx, arg2 int, arg3 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserPasswordTx", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUserPasswordTx indicates an expected call of UpdateUserPasswordTx.
+func (mr *MockStorageMockRecorder) UpdateUserPasswordTx(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserPasswordTx", reflect.TypeOf((*MockStorage)(nil).UpdateUserPasswordTx), arg0, arg1, arg2, arg3)
+}
+
+// UseAPIKey mocks base method.
+func (m *MockStorage) UseAPIKey(arg0 context.Context, arg1 string) (models.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseAPIKey", arg0, arg1)
+	ret0, _ := ret[0].(models.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseAPIKey indicates an expected call of UseAPIKey.
+func (mr *MockStorageMockRecorder) UseAPIKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseAPIKey", reflect.TypeOf((*MockStorage)(nil).UseAPIKey), arg0, arg1)
+}
+
+// UsePasswordResetTokenTx mocks base method.
+func (m *MockStorage) UsePasswordResetTokenTx(arg0 context.Context, arg1 pgx.Tx, arg2 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UsePasswordResetTokenTx", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UsePasswordResetTokenTx indicates an expected call of UsePasswordResetTokenTx.
+func (mr *MockStorageMockRecorder) UsePasswordResetTokenTx(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UsePasswordResetTokenTx", reflect.TypeOf((*MockStorage)(nil).UsePasswordResetTokenTx), arg0, arg1, arg2)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockStorage) UseRecoveryCode(arg0 context.Context, arg1 int, arg2 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockStorageMockRecorder) UseRecoveryCode(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockStorage)(nil).UseRecoveryCode), arg0, arg1, arg2)
+}
+
+// UseTOTPStep mocks base method.
+func (m *MockStorage) UseTOTPStep(arg0 context.Context, arg1 int, arg2 int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPStep", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseTOTPStep indicates an expected call of UseTOTPStep.
+func (mr *MockStorageMockRecorder) UseTOTPStep(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPStep", reflect.TypeOf((*MockStorage)(nil).UseTOTPStep), arg0, arg1, arg2)
+}
+
+// UserAPIKeys mocks base method.
+func (m *MockStorage) UserAPIKeys(arg0 context.Context, arg1 int) ([]models.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UserAPIKeys", arg0, arg1)
+	ret0, _ := ret[0].([]models.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UserAPIKeys indicates an expected call of UserAPIKeys.
+func (mr *MockStorageMockRecorder) UserAPIKeys(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserAPIKeys", reflect.TypeOf((*MockStorage)(nil).UserAPIKeys), arg0, arg1)
+}
+
+// UserBalanceAdjustments mocks base method.
+func (m *MockStorage) UserBalanceAdjustments(arg0 context.Context, arg1 int) ([]models.BalanceAdjustment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UserBalanceAdjustments", arg0, arg1)
+	ret0, _ := ret[0].([]models.BalanceAdjustment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UserBalanceAdjustments indicates an expected call of UserBalanceAdjustments.
+func (mr *MockStorageMockRecorder) UserBalanceAdjustments(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserBalanceAdjustments", reflect.TypeOf((*MockStorage)(nil).UserBalanceAdjustments), arg0, arg1)
+}
+
+// UserLedgerEntries mocks base method.
+func (m *MockStorage) UserLedgerEntries(arg0 context.Context, arg1 int) ([]models.LedgerEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UserLedgerEntries", arg0, arg1)
+	ret0, _ := ret[0].([]models.LedgerEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UserLedgerEntries indicates an expected call of UserLedgerEntries.
+func (mr *MockStorageMockRecorder) UserLedgerEntries(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserLedgerEntries", reflect.TypeOf((*MockStorage)(nil).UserLedgerEntries), arg0, arg1)
 }
 
 // UserOrders mocks base method.
@@ -269,6 +1025,21 @@ func (mr *MockStorageMockRecorder) UserWithdrawals(arg0, arg1 interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserWithdrawals", reflect.TypeOf((*MockStorage)(nil).UserWithdrawals), arg0, arg1)
 }
 
+// UsersWithExpiredPoints mocks base method.
+func (m *MockStorage) UsersWithExpiredPoints(arg0 context.Context, arg1, arg2 int) ([]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UsersWithExpiredPoints", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UsersWithExpiredPoints indicates an expected call of UsersWithExpiredPoints.
+func (mr *MockStorageMockRecorder) UsersWithExpiredPoints(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UsersWithExpiredPoints", reflect.TypeOf((*MockStorage)(nil).UsersWithExpiredPoints), arg0, arg1, arg2)
+}
+
 // WithinTranscaction mocks base method.
 func (m *MockStorage) WithinTranscaction(arg0 context.Context, arg1 func(context.Context, pgx.Tx) error) error {
 	m.ctrl.T.Helper()
@@ -0,0 +1,132 @@
+package validation
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	DefaultMinLoginLength    = 3
+	DefaultMaxLoginLength    = 255
+	DefaultMinPasswordLength = 8
+	// argon2id takes passwords of any length, the limit only bounds the
+	// input hashed on every login attempt
+	MaxPasswordBytes = 1024
+)
+
+type Violation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type ErrInvalidCredentials struct {
+	Violations []Violation
+}
+
+func (err ErrInvalidCredentials) Error() string {
+	messages := make([]string, 0, len(err.Violations))
+	for _, violation := range err.Violations {
+		messages = append(messages, violation.Message)
+	}
+
+	return "invalid credentials: " + strings.Join(messages, "; ")
+}
+
+type CredentialsPolicy struct {
+	MinLoginLength    int
+	MaxLoginLength    int
+	MinPasswordLength int
+	Blocklist         map[string]struct{}
+}
+
+func NewCredentialsPolicy(minPasswordLength int, blocklistFile string) (CredentialsPolicy, error) {
+	policy := CredentialsPolicy{
+		MinLoginLength:    DefaultMinLoginLength,
+		MaxLoginLength:    DefaultMaxLoginLength,
+		MinPasswordLength: DefaultMinPasswordLength,
+	}
+	if minPasswordLength > 0 {
+		policy.MinPasswordLength = minPasswordLength
+	}
+	if blocklistFile != "" {
+		blocklist, err := LoadPasswordBlocklist(blocklistFile)
+		if err != nil {
+			return policy, err
+		}
+		policy.Blocklist = blocklist
+	}
+
+	return policy, nil
+}
+
+func LoadPasswordBlocklist(file string) (map[string]struct{}, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open password blocklist: %w", err)
+	}
+	defer f.Close()
+
+	blocklist := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if password := strings.TrimSpace(scanner.Text()); password != "" {
+			blocklist[strings.ToLower(password)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read password blocklist: %w", err)
+	}
+
+	return blocklist, nil
+}
+
+func (p CredentialsPolicy) Validate(login, password string) error {
+	var violations []Violation
+	addViolation := func(field, rule, format string, args ...interface{}) {
+		violations = append(violations, Violation{Field: field, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	loginLength := utf8.RuneCountInString(login)
+	if loginLength < p.MinLoginLength || loginLength > p.MaxLoginLength {
+		addViolation("login", "length", "login length must be between %d and %d", p.MinLoginLength, p.MaxLoginLength)
+	}
+	if !validLoginCharset(login) {
+		addViolation("login", "charset", "login may contain only latin letters, digits and \".\", \"_\", \"-\", \"@\"")
+	}
+
+	if utf8.RuneCountInString(password) < p.MinPasswordLength {
+		addViolation("password", "min_length", "password must be at least %d characters long", p.MinPasswordLength)
+	}
+	if len(password) > MaxPasswordBytes {
+		addViolation("password", "max_bytes", "password must not be longer than %d bytes", MaxPasswordBytes)
+	}
+	if password != "" && strings.EqualFold(password, login) {
+		addViolation("password", "same_as_login", "password must differ from login")
+	}
+	if _, ok := p.Blocklist[strings.ToLower(password)]; ok {
+		addViolation("password", "breached", "password is known to be breached")
+	}
+
+	if len(violations) > 0 {
+		return ErrInvalidCredentials{Violations: violations}
+	}
+
+	return nil
+}
+
+func validLoginCharset(login string) bool {
+	for _, r := range login {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == '-', r == '@':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,55 @@
+package validation_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialsPolicyValidate(t *testing.T) {
+	blocklistFile := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(blocklistFile, []byte("Password1\n\nqwertyuiop\n"), 0o600))
+	policy, err := validation.NewCredentialsPolicy(0, blocklistFile)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		login     string
+		password  string
+		wantRules []string
+	}{
+		{name: "accepts valid credentials", login: "john.doe@example", password: "correct horse battery"},
+		{name: "rejects empty credentials", wantRules: []string{"length", "min_length"}},
+		{name: "rejects too long login", login: strings.Repeat("a", 256), password: "correct horse", wantRules: []string{"length"}},
+		{name: "rejects login with spaces", login: "john doe", password: "correct horse", wantRules: []string{"charset"}},
+		{name: "rejects short password", login: "john", password: "short", wantRules: []string{"min_length"}},
+		{name: "accepts password over former bcrypt limit", login: "john", password: strings.Repeat("a", 73)},
+		{name: "rejects too long password", login: "john", password: strings.Repeat("a", validation.MaxPasswordBytes+1), wantRules: []string{"max_bytes"}},
+		{name: "rejects password equal to login", login: "johnsmith", password: "JohnSmith", wantRules: []string{"same_as_login"}},
+		{name: "rejects breached password", login: "john", password: "password1", wantRules: []string{"breached"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := policy.Validate(tc.login, tc.password)
+			if tc.wantRules == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var invalidErr validation.ErrInvalidCredentials
+			require.True(t, errors.As(err, &invalidErr))
+			rules := make([]string, 0, len(invalidErr.Violations))
+			for _, violation := range invalidErr.Violations {
+				rules = append(rules, violation.Rule)
+			}
+			assert.Equal(t, tc.wantRules, rules)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package validation
+
+import "fmt"
+
+const (
+	MinOrderNumberLength = 2
+	MaxOrderNumberLength = 255
+)
+
+type ErrInvalidOrderNumber struct {
+	Number string
+	Reason string
+}
+
+func (err ErrInvalidOrderNumber) Error() string {
+	return fmt.Sprintf("invalid order number \"%s\": %s", err.Number, err.Reason)
+}
+
+func ValidateOrderNumber(number string) error {
+	if len(number) < MinOrderNumberLength || len(number) > MaxOrderNumberLength {
+		return ErrInvalidOrderNumber{
+			Number: number,
+			Reason: fmt.Sprintf("length must be between %d and %d", MinOrderNumberLength, MaxOrderNumberLength),
+		}
+	}
+
+	for i := 0; i < len(number); i++ {
+		if number[i] < '0' || number[i] > '9' {
+			return ErrInvalidOrderNumber{Number: number, Reason: "must contain only digits"}
+		}
+	}
+	if luhnSum(number, false)%10 != 0 {
+		return ErrInvalidOrderNumber{Number: number, Reason: "checksum mismatch"}
+	}
+
+	return nil
+}
+
+// LuhnCheckDigit returns the digit that makes number followed by it pass the
+// checksum, number must contain only digits
+func LuhnCheckDigit(number string) int {
+	return (10 - luhnSum(number, true)%10) % 10
+}
+
+// luhnSum doubles every second digit from the right, starting with the
+// rightmost one if doubleLast
+func luhnSum(number string, doubleLast bool) int {
+	sum := 0
+	double := doubleLast
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := int(number[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+
+	return sum
+}
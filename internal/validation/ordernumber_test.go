@@ -0,0 +1,84 @@
+package validation_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ilya-burinskiy/gophermart/internal/validation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateOrderNumber(t *testing.T) {
+	testCases := []struct {
+		name    string
+		number  string
+		wantErr bool
+	}{
+		{name: "accepts valid number", number: "12345678903"},
+		{name: "accepts valid card number", number: "4561261212345467"},
+		{name: "accepts shortest valid number", number: "18"},
+		{name: "rejects checksum mismatch", number: "12345678904", wantErr: true},
+		{name: "rejects empty number", number: "", wantErr: true},
+		{name: "rejects too short number", number: "0", wantErr: true},
+		{name: "rejects too long number", number: strings.Repeat("0", validation.MaxOrderNumberLength+1), wantErr: true},
+		{name: "rejects letters", number: "1234567890a", wantErr: true},
+		{name: "rejects spaces", number: "1234 5678 903", wantErr: true},
+		{name: "rejects signs", number: "-12345678903", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validation.ValidateOrderNumber(tc.number)
+			if !tc.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+
+			var invalidErr validation.ErrInvalidOrderNumber
+			assert.True(t, errors.As(err, &invalidErr))
+		})
+	}
+}
+
+func TestLuhnCheckDigit(t *testing.T) {
+	for _, number := range []string{"12345678903", "4561261212345467", "18"} {
+		payload, last := number[:len(number)-1], int(number[len(number)-1]-'0')
+		assert.Equal(t, last, validation.LuhnCheckDigit(payload), number)
+	}
+}
+
+func FuzzValidateOrderNumber(f *testing.F) {
+	for _, seed := range []string{"12345678903", "4561261212345467", "18", "0", "", "abc", "1234 5678"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, number string) {
+		err := validation.ValidateOrderNumber(number)
+		if err != nil {
+			var invalidErr validation.ErrInvalidOrderNumber
+			if !errors.As(err, &invalidErr) {
+				t.Fatalf("unexpected error type %T", err)
+			}
+			return
+		}
+
+		if len(number) < validation.MinOrderNumberLength || len(number) > validation.MaxOrderNumberLength {
+			t.Fatalf("accepted number with length %d", len(number))
+		}
+		for _, r := range number {
+			if r < '0' || r > '9' {
+				t.Fatalf("accepted number with non digit %q", r)
+			}
+		}
+		if validation.LuhnCheckDigit(number[:len(number)-1]) != int(number[len(number)-1]-'0') {
+			t.Fatalf("accepted number %q with invalid checksum", number)
+		}
+
+		last := number[len(number)-1]
+		mutated := number[:len(number)-1] + string('0'+(last-'0'+1)%10)
+		if validation.ValidateOrderNumber(mutated) == nil {
+			t.Fatalf("accepted both %q and %q", number, mutated)
+		}
+	})
+}